@@ -0,0 +1,261 @@
+package bdata
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/mod"
+)
+
+const (
+	AuditActionBinCreate            = "bin.create"
+	AuditActionBinCreateApproximate = "bin.create_approximate"
+	//已有的确切数据被替换, before为替换前的数据
+	AuditActionBinUpdate         = "bin.update"
+	AuditActionBankNameCreate    = "bank_name.create"
+	AuditActionCountryNameCreate = "country_name.create"
+)
+
+var auditFileName = "audit.log"
+
+var audit = auditLog{}
+
+//只追加的审计日志, 每条记录包含上一条记录的hash
+type auditLog struct {
+	mutex    sync.Mutex
+	filepath string
+	seq      int64
+	lastHash string
+}
+
+//AuditQuery 审计日志查询条件, 为空表示不过滤
+type AuditQuery struct {
+	Action string
+	Key    string
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+//AuditVerifyResult 审计日志校验结果
+type AuditVerifyResult struct {
+	Valid   bool   `json:"valid"`
+	Entries int64  `json:"entries"`
+	Line    int    `json:"line,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+//打开数据目录下的审计日志, 读取最后一条记录以继续hash链
+func openAuditLog(dataDir string) error {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	audit.filepath = AuditFilePath(dataDir)
+	audit.seq = 0
+	audit.lastHash = ""
+	return scanAuditLog(audit.filepath, func(line int, entry mod.AuditEntry) bool {
+		audit.seq = entry.Seq
+		audit.lastHash = entry.Hash
+		return true
+	})
+}
+
+//追加一条审计记录, before及after为修改前后的值, 不存在时为nil
+func writeAudit(actor mod.Actor, action, key string, before, after interface{}) error {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if audit.filepath == "" {
+		return errors.New("审计日志未打开")
+	}
+
+	entry := mod.AuditEntry{
+		Seq:      audit.seq + 1,
+		Time:     time.Now().UTC(),
+		Actor:    actor,
+		Action:   action,
+		Key:      key,
+		PrevHash: audit.lastHash}
+	var err error
+	if entry.Before, err = json.Marshal(before); err != nil {
+		return err
+	}
+	if entry.After, err = json.Marshal(after); err != nil {
+		return err
+	}
+	if entry.Hash, err = auditHash(entry); err != nil {
+		return err
+	}
+
+	var data []byte
+	if data, err = json.Marshal(entry); err != nil {
+		return err
+	}
+	var file *os.File
+	if file, err = os.OpenFile(audit.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	audit.seq = entry.Seq
+	audit.lastHash = entry.Hash
+	return nil
+}
+
+//修改已经生效, 审计日志写入失败时只记录错误
+func auditMutation(actor mod.Actor, action, key string, before, after interface{}) {
+	if err := writeAudit(actor, action, key, before, after); err != nil {
+		logger.Errorf("写入审计日志失败, error: %s, action: %s, key: %s", err, action, key)
+	}
+	publishChange(action, key, after)
+}
+
+func auditHash(entry mod.AuditEntry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(entry.PrevHash), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func scanAuditLog(filepath string, fn func(line int, entry mod.AuditEntry) bool) error {
+	file, err := os.Open(filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry mod.AuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return errors.New(fmt.Sprintf("%s:%d: %s", filepath, line, err))
+		}
+		if !fn(line, entry) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+//QueryAudit 查询当前数据目录的审计日志, 按时间升序, Limit大于0时只返回最后Limit条
+func QueryAudit(q AuditQuery) ([]mod.AuditEntry, error) {
+	audit.mutex.Lock()
+	filepath := audit.filepath
+	audit.mutex.Unlock()
+	if filepath == "" {
+		return nil, errors.New("审计日志未打开")
+	}
+
+	result := make([]mod.AuditEntry, 0, 64)
+	err := scanAuditLog(filepath, func(line int, entry mod.AuditEntry) bool {
+		if q.Action != "" && entry.Action != q.Action {
+			return true
+		}
+		if q.Key != "" && entry.Key != q.Key {
+			return true
+		}
+		if q.Actor != "" && entry.Actor.ApiKey != q.Actor && entry.Actor.ClientIp != q.Actor {
+			return true
+		}
+		if !q.From.IsZero() && entry.Time.Before(q.From) {
+			return true
+		}
+		if !q.To.IsZero() && entry.Time.After(q.To) {
+			return true
+		}
+		result = append(result, entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+//VerifyAuditLog 校验审计日志的序号及hash链, 任何修改, 删除或插入都会导致校验失败
+func VerifyAuditLog(filepath string) (AuditVerifyResult, error) {
+	result := AuditVerifyResult{Valid: true}
+	prevHash := ""
+	var hashErr error
+	err := scanAuditLog(filepath, func(line int, entry mod.AuditEntry) bool {
+		fail := func(reason string) bool {
+			result.Valid = false
+			result.Line = line
+			result.Reason = reason
+			return false
+		}
+		if entry.Seq != result.Entries+1 {
+			return fail(fmt.Sprintf("序号不连续, 应为%d, 实际为%d", result.Entries+1, entry.Seq))
+		}
+		if entry.PrevHash != prevHash {
+			return fail("prev_hash与上一条记录不一致")
+		}
+		var hash string
+		if hash, hashErr = auditHash(entry); hashErr != nil {
+			return false
+		}
+		if hash != entry.Hash {
+			return fail("hash不匹配, 记录已被修改")
+		}
+		prevHash = entry.Hash
+		result.Entries++
+		return true
+	})
+	if err == nil {
+		err = hashErr
+	}
+	if err != nil {
+		//无法解析的行同样视为被篡改
+		result.Valid = false
+		result.Reason = err.Error()
+	}
+	return result, nil
+}
+
+//VerifyCurrentAuditLog 校验当前数据目录的审计日志
+func VerifyCurrentAuditLog() (AuditVerifyResult, error) {
+	audit.mutex.Lock()
+	filepath := audit.filepath
+	audit.mutex.Unlock()
+	if filepath == "" {
+		return AuditVerifyResult{}, errors.New("审计日志未打开")
+	}
+	return VerifyAuditLog(filepath)
+}
+
+//AuditFilePath 数据目录下的审计日志文件
+func AuditFilePath(dataDir string) string {
+	return strings.Join([]string{dataDir, auditFileName}, "/")
+}
+
+//ApiKeyFingerprint api key的指纹, 审计日志中不保存key本身
+func ApiKeyFingerprint(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,161 @@
+package bdata
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//使用临时目录下的审计日志
+func useTestAudit(t *testing.T) string {
+	t.Helper()
+	audit.mutex.Lock()
+	savedFilepath, savedSeq, savedHash := audit.filepath, audit.seq, audit.lastHash
+	audit.mutex.Unlock()
+	t.Cleanup(func() {
+		audit.mutex.Lock()
+		audit.filepath, audit.seq, audit.lastHash = savedFilepath, savedSeq, savedHash
+		audit.mutex.Unlock()
+	})
+	dir := t.TempDir()
+	if err := openAuditLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+//写入测试用的审计记录
+func writeTestAudit(t *testing.T) {
+	t.Helper()
+	writes := []struct {
+		actor  mod.Actor
+		action string
+		key    string
+		after  interface{}
+	}{
+		{mod.Actor{ClientIp: "10.0.0.1"}, AuditActionBinCreate, "400000", testBinData(1, 400000, 400000, "TEST BANK")},
+		{mod.Actor{ApiKey: ApiKeyFingerprint("key")}, AuditActionBankNameCreate, "TEST BANK", "测试银行"},
+		{mod.Actor{ClientIp: "10.0.0.1"}, AuditActionBinCreate, "400001", testBinData(2, 400001, 400001, "TEST BANK")},
+	}
+	for _, w := range writes {
+		if err := writeAudit(w.actor, w.action, w.key, nil, w.after); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	dir := useTestAudit(t)
+	writeTestAudit(t)
+
+	//重新打开时继续hash链
+	if err := openAuditLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAudit(mod.Actor{}, AuditActionCountryNameCreate, "US", nil, "美国"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := VerifyCurrentAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Entries != 4 {
+		t.Errorf("verify %+v", result)
+	}
+	entries, _ := QueryAudit(AuditQuery{})
+	if len(entries) != 4 || entries[0].PrevHash != "" || entries[3].PrevHash != entries[2].Hash || string(entries[0].Before) != "null" {
+		t.Errorf("entries %+v", entries)
+	}
+}
+
+func TestQueryAudit(t *testing.T) {
+	useTestAudit(t)
+	writeTestAudit(t)
+	cases := []struct {
+		name string
+		q    AuditQuery
+		keys []string
+	}{
+		{"all", AuditQuery{}, []string{"400000", "TEST BANK", "400001"}},
+		{"action", AuditQuery{Action: AuditActionBinCreate}, []string{"400000", "400001"}},
+		{"key", AuditQuery{Key: "TEST BANK"}, []string{"TEST BANK"}},
+		{"client ip", AuditQuery{Actor: "10.0.0.1"}, []string{"400000", "400001"}},
+		{"api key", AuditQuery{Actor: ApiKeyFingerprint("key")}, []string{"TEST BANK"}},
+		{"limit keeps latest", AuditQuery{Limit: 2}, []string{"TEST BANK", "400001"}},
+		{"from future", AuditQuery{From: time.Now().Add(time.Hour)}, nil},
+		{"to past", AuditQuery{To: time.Now().Add(-time.Hour)}, nil},
+	}
+	for _, c := range cases {
+		entries, err := QueryAudit(c.q)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var keys []string
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+		if strings.Join(keys, ",") != strings.Join(c.keys, ",") {
+			t.Errorf("%s: keys %v, want %v", c.name, keys, c.keys)
+		}
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	dir := useTestAudit(t)
+	writeTestAudit(t)
+	content, err := os.ReadFile(AuditFilePath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	cases := []struct {
+		name   string
+		lines  []string
+		valid  bool
+		failAt int
+	}{
+		{"intact", lines, true, 0},
+		{"empty", nil, true, 0},
+		{"modified", []string{lines[0], strings.Replace(lines[1], "测试银行", "其他银行", 1), lines[2]}, false, 2},
+		{"deleted", []string{lines[0], lines[2]}, false, 2},
+		{"reordered", []string{lines[1], lines[0], lines[2]}, false, 1},
+		{"truncated head", lines[1:], false, 1},
+		{"garbage", []string{lines[0], "not json"}, false, 0},
+	}
+	for _, c := range cases {
+		path := dir + "/" + strings.Replace(c.name, " ", "_", -1) + ".log"
+		data := ""
+		if len(c.lines) > 0 {
+			data = strings.Join(c.lines, "\n") + "\n"
+		}
+		if err = os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := VerifyAuditLog(path)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if result.Valid != c.valid || result.Line != c.failAt || (!c.valid && result.Reason == "") {
+			t.Errorf("%s: %+v", c.name, result)
+		}
+	}
+}
+
+func TestApiKeyFingerprint(t *testing.T) {
+	if ApiKeyFingerprint("") != "" {
+		t.Error("fingerprint of empty key")
+	}
+	fingerprint := ApiKeyFingerprint("secret")
+	if !strings.HasPrefix(fingerprint, "sha256:") || len(fingerprint) != len("sha256:")+16 || strings.Contains(fingerprint, "secret") {
+		t.Errorf("fingerprint %s", fingerprint)
+	}
+	if fingerprint == ApiKeyFingerprint("other") {
+		t.Error("different keys have the same fingerprint")
+	}
+}
@@ -2,9 +2,13 @@ package bdata
 
 import (
 	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"kidshelloworld.com/bindb/mod"
 	"io"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 )
@@ -17,6 +21,7 @@ func read(filepath string, seekOffset int64) ([]string, int64, error) {
 	if file, err = os.Open(filepath); err != nil {
 		return nil, 0, err
 	}
+	defer file.Close()
 	if _, err := file.Seek(seekOffset, 0); err != nil {
 		return nil, 0, err
 	}
@@ -46,8 +51,68 @@ func read(filepath string, seekOffset int64) ([]string, int64, error) {
 	return result, fileInfo.Size(), nil
 }
 
+//读取文件的第一行
+func readHeader(filepath string) (string, error) {
+	var (
+		file *os.File
+		err  error
+	)
+	if file, err = os.Open(filepath); err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if scanner.Scan() {
+		return scanner.Text(), nil
+	}
+	return "", scanner.Err()
+}
+
+//按RFC 4180解析一行数据
+//兼容旧格式: 未加引号且列数过多时, 认为多出的逗号来自bank_name, 合并后的数据合法时repaired为true
+//合并后仍不合法时返回原始的列, 由调用方按列数错误处理
+func splitRecord(value string) (values []string, repaired bool, err error) {
+	reader := csv.NewReader(strings.NewReader(value))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if values, err = reader.Read(); err != nil {
+		if err == io.EOF {
+			return []string{""}, false, nil
+		}
+		return nil, false, err
+	}
+	if len(values) > binDataColumns && !strings.Contains(value, "\"") {
+		extra := len(values) - binDataColumns
+		bankName := strings.Join(values[10:11+extra], ",")
+		merged := append(append(values[:10:10], bankName), values[11+extra:]...)
+		if isLegacyRecord(merged) {
+			return merged, true, nil
+		}
+	}
+	return values, false, nil
+}
+
+//合并bank_name后其他列是否合法, 逗号出现在bank_name之前的列时, 之后的列会错位
+func isLegacyRecord(values []string) bool {
+	if values[3] != "" {
+		if _, err := strconv.ParseInt(values[3], 10, 8); err != nil {
+			return false
+		}
+	}
+	if !contains(knownLuhn, strings.ToLower(values[4])) || !contains(knownPrepaid, strings.ToLower(values[8])) {
+		return false
+	}
+	return values[9] == "" || IsCountryCode(values[9])
+}
+
 func parse(value string) ([]mod.BinData, error) {
-	values := strings.Split(value, ",")
+	values, _, err := splitRecord(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != binDataColumns {
+		return nil, errors.New(fmt.Sprintf("列数为%d, 应为%d", len(values), binDataColumns))
+	}
 	iinStart := values[1]
 	iinEnd := values[2]
 	var result []mod.BinData
@@ -56,7 +121,6 @@ func parse(value string) ([]mod.BinData, error) {
 	var (
 		id                              int64
 		startId, endId, currentIinStart uint32
-		err                             error
 	)
 	if startId, err = bin2Uint32(iinStart); err != nil {
 		return nil, err
@@ -66,8 +130,29 @@ func parse(value string) ([]mod.BinData, error) {
 		if endId, err = bin2Uint32(iinEnd); err != nil {
 			return nil, err
 		}
+		if endId < startId {
+			return nil, errors.New(fmt.Sprintf("iin_start %d 大于 iin_end %d", startId, endId))
+		}
 	}
 
+	base := mod.BaseBinData{
+		Schema:    values[5],
+		Brand:     values[6],
+		CardType:  values[7],
+		Country:   values[9],
+		BankName:  values[10],
+		BankLogo:  values[11],
+		BankUrl:   values[12],
+		BankPhone: values[13],
+		BankCity:  values[14]}
+	//银行名称统一为发卡行注册表中的规范名称
+	NormalizeIssuer(&base)
+	number := mod.BinData{}
+	if err = setColumn(&number, "number_length", values[3]); err != nil {
+		return nil, err
+	}
+	number.NumberLuhn = normalizeFlag(values[4], "n")
+
 	currentIinStart = startId
 	result = make([]mod.BinData, 0, endId-startId+1)
 	for {
@@ -78,18 +163,10 @@ func parse(value string) ([]mod.BinData, error) {
 		bindata.Id = id
 		bindata.IinStart = currentIinStart
 		bindata.IinEnd = currentIinStart
-		bindata.NumberLength = -1
-		bindata.NumberLuhn = ""
-		bindata.Schema = values[5]
-		bindata.Brand = values[6]
-		bindata.CardType = values[7]
+		bindata.NumberLength = number.NumberLength
+		bindata.NumberLuhn = number.NumberLuhn
 		bindata.Prepaid = values[8]
-		bindata.Country = values[9]
-		bindata.BankName = values[10]
-		bindata.BankLogo = values[11]
-		bindata.BankUrl = values[12]
-		bindata.BankPhone = values[13]
-		bindata.BankCity = values[14]
+		bindata.BaseBinData = base
 		result = append(result, bindata)
 		if currentIinStart == endId {
 			break
@@ -98,3 +175,170 @@ func parse(value string) ([]mod.BinData, error) {
 	}
 	return result, nil
 }
+
+//ReadBinDataFile 读取整个bin数据文件, 不包含header
+func ReadBinDataFile(filepath string) ([]string, error) {
+	lines, _, err := read(filepath, 0)
+	return lines, err
+}
+
+//ParseBinData 解析一行bin数据, 区间数据会展开为单个bin
+func ParseBinData(line string) ([]mod.BinData, error) {
+	return parse(line)
+}
+
+//FormatBinData 将bindata格式化为一行数据
+func FormatBinData(bindata mod.BinData) string {
+	return format(bindata.IinStart, bindata)
+}
+
+//AppendBinData 追加一条bin数据到文件, 文件不存在时会写入header
+func AppendBinData(filepath string, bindata mod.BinData) error {
+	return write2File(bindata.IinStart, filepath, bindata)
+}
+
+//BinDataHeader bin数据文件的header
+func BinDataHeader() string {
+	return binDataHeader
+}
+
+//IsBinDataFile 是否为bin数据文件(.bd或.bd2)
+func IsBinDataFile(filepath string) bool {
+	ext := path.Ext(filepath)
+	return binDataFileExt == ext || binDataApproximateFileExt == ext
+}
+
+//IsApproximateFile 是否为近似数据文件
+func IsApproximateFile(filepath string) bool {
+	return path.Ext(filepath) == binDataApproximateFileExt
+}
+
+//CompressRanges 将已排序的单个bin中属性相同且相邻的数据合并为区间
+func CompressRanges(data []mod.BinData) []mod.BinData {
+	result := make([]mod.BinData, 0, len(data))
+	for _, d := range data {
+		end := d.IinEnd
+		if end < d.IinStart {
+			end = d.IinStart
+		}
+		if n := len(result); n > 0 {
+			last := &result[n-1]
+			if last.IinEnd+1 == d.IinStart && sameAttributes(*last, d) {
+				last.IinEnd = end
+				continue
+			}
+		}
+		d.IinEnd = end
+		result = append(result, d)
+	}
+	return result
+}
+
+func sameAttributes(a, b mod.BinData) bool {
+	return a.BaseBinData == b.BaseBinData &&
+		a.NumberLength == b.NumberLength &&
+		a.NumberLuhn == b.NumberLuhn &&
+		a.Prepaid == b.Prepaid &&
+		a.Status == b.Status
+}
+
+//bin数据的属性列, 不包含id及区间
+var attributeColumns = []string{"number_length", "number_luhn", "scheme", "brand", "type", "prepaid", "country",
+	"bank_name", "bank_logo", "bank_url", "bank_phone", "bank_city"}
+
+//GetColumn 按列名读取bin数据的属性
+func GetColumn(d mod.BinData, column string) string {
+	return getColumn(d, column)
+}
+
+//按列名读取bin数据的属性
+func getColumn(d mod.BinData, column string) string {
+	switch column {
+	case "number_length":
+		if d.NumberLength > 0 {
+			return strconv.Itoa(int(d.NumberLength))
+		}
+		return ""
+	case "number_luhn":
+		return d.NumberLuhn
+	case "scheme":
+		return d.Schema
+	case "brand":
+		return d.Brand
+	case "type":
+		return d.CardType
+	case "prepaid":
+		return d.Prepaid
+	case "country":
+		return d.Country
+	case "bank_name":
+		return d.BankName
+	case "bank_logo":
+		return d.BankLogo
+	case "bank_url":
+		return d.BankUrl
+	case "bank_phone":
+		return d.BankPhone
+	case "bank_city":
+		return d.BankCity
+	}
+	return ""
+}
+
+//按列名设置bin数据的属性
+func setColumn(d *mod.BinData, column, value string) error {
+	switch column {
+	case "number_length":
+		if value == "" {
+			d.NumberLength = -1
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 8)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid number_length %s", value))
+		}
+		d.NumberLength = int8(n)
+	case "number_luhn":
+		d.NumberLuhn = value
+	case "scheme":
+		d.Schema = value
+	case "brand":
+		d.Brand = value
+	case "type":
+		d.CardType = value
+	case "prepaid":
+		d.Prepaid = value
+	case "country":
+		d.Country = value
+	case "bank_name":
+		d.BankName = value
+	case "bank_logo":
+		d.BankLogo = value
+	case "bank_url":
+		d.BankUrl = value
+	case "bank_phone":
+		d.BankPhone = value
+	case "bank_city":
+		d.BankCity = value
+	default:
+		return errors.New(fmt.Sprintf("unknown column %s", column))
+	}
+	return nil
+}
+
+//WriteBinDataFile 写入完整的bin数据文件(含header), 已存在时覆盖, 相邻且属性相同的bin合并为区间
+func WriteBinDataFile(filepath string, records []mod.BinData) error {
+	lines := make([]string, 0, len(records)+1)
+	lines = append(lines, binDataHeader)
+	for _, d := range CompressRanges(records) {
+		lines = append(lines, format(d.IinStart, d))
+	}
+	dir := path.Dir(filepath)
+	if _, err := os.Stat(dir); err != nil && os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, 0744); err != nil {
+			return err
+		}
+		addWatchDir(dir)
+	}
+	return writeLines(filepath, lines)
+}
@@ -0,0 +1,240 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//写入带header的数据文件
+func writeDataFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := binDataHeader + "\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBinData(id int64, start, end uint32, bank string) mod.BinData {
+	return mod.BinData{Id: id, IinStart: start, IinEnd: end, BaseBinData: mod.BaseBinData{Schema: "visa", Country: "US", BankName: bank}}
+}
+
+func TestCompressRanges(t *testing.T) {
+	cases := []struct {
+		name string
+		data []mod.BinData
+		want [][2]uint32
+	}{
+		{"empty", nil, nil},
+		{"adjacent", []mod.BinData{testBinData(1, 400000, 400000, "A"), testBinData(2, 400001, 400001, "A"), testBinData(3, 400002, 400002, "A")},
+			[][2]uint32{{400000, 400002}}},
+		{"gap", []mod.BinData{testBinData(1, 400000, 400000, "A"), testBinData(2, 400002, 400002, "A")},
+			[][2]uint32{{400000, 400000}, {400002, 400002}}},
+		{"different attributes", []mod.BinData{testBinData(1, 400000, 400000, "A"), testBinData(2, 400001, 400001, "B"), testBinData(3, 400002, 400002, "B")},
+			[][2]uint32{{400000, 400000}, {400001, 400002}}},
+		{"ranges", []mod.BinData{testBinData(1, 400000, 400009, "A"), testBinData(2, 400010, 0, "A"), testBinData(3, 400011, 400019, "A")},
+			[][2]uint32{{400000, 400019}}},
+	}
+	for _, c := range cases {
+		result := CompressRanges(c.data)
+		if len(result) != len(c.want) {
+			t.Errorf("%s: %d ranges, want %d", c.name, len(result), len(c.want))
+			continue
+		}
+		for i, d := range result {
+			if d.IinStart != c.want[i][0] || d.IinEnd != c.want[i][1] {
+				t.Errorf("%s: range %d [%d, %d], want %v", c.name, i, d.IinStart, d.IinEnd, c.want[i])
+			}
+		}
+	}
+	//合并后的区间保留第一条数据的id
+	if result := CompressRanges([]mod.BinData{testBinData(5, 400000, 400000, "A"), testBinData(6, 400001, 400001, "A")}); result[0].Id != 5 {
+		t.Errorf("id %d, want 5", result[0].Id)
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "ranges.bd"),
+		"1,400000,400002,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,500000,,,,mastercard,,debit,,GB,OTHER BANK,,,,")
+	writeDataFile(t, filepath.Join(dir, "20190601", "approximate.bd2"),
+		"3,600000,,,,visa,,credit,,US,GUESS BANK,,,,")
+
+	dataset, err := LoadDataset(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataset.Lines != 3 || len(dataset.Files) != 2 || len(dataset.Exact) != 4 || len(dataset.Approximate) != 1 {
+		t.Errorf("lines %d, files %v, exact %d, approximate %d", dataset.Lines, dataset.Files, len(dataset.Exact), len(dataset.Approximate))
+	}
+	bins := dataset.Bins()
+	if len(bins) != 4 || bins[0] != 400000 || bins[3] != 500000 {
+		t.Errorf("bins %v", bins)
+	}
+	if d, ok := dataset.Lookup(400001); !ok || d.Id != 1 {
+		t.Errorf("lookup %+v, %v", d, ok)
+	}
+	if _, err = LoadDataset(filepath.Join(dir, "missing")); err == nil {
+		t.Error("loaded missing path")
+	}
+}
+
+func TestSplitRecord(t *testing.T) {
+	cases := []struct {
+		name     string
+		line     string
+		bankName string
+		columns  int
+		repaired bool
+	}{
+		{"plain", "1,400000,,,,visa,,credit,,US,TEST BANK,,,,", "TEST BANK", binDataColumns, false},
+		{"quoted comma", "1,400000,,,,visa,,credit,,US,\"BANK, N.A.\",,,,", "BANK, N.A.", binDataColumns, false},
+		{"legacy comma", "1,400000,,,,visa,,credit,,US,BANK, N.A.,,,,", "BANK, N.A.", binDataColumns, true},
+		{"legacy commas", "1,400000,,,,visa,,credit,,US,A, B, C,,,,", "A, B, C", binDataColumns, true},
+		//逗号不在bank_name中, 合并后之后的列错位
+		{"comma in brand", "1,400000,,,,visa,BRAND, X,credit,,US,TEST BANK,,,,", "", binDataColumns + 1, false},
+		{"comma in prepaid", "1,400000,,,,visa,,credit,y, n,US,TEST BANK,,,,", "", binDataColumns + 1, false},
+		{"too few", "1,400000,visa", "", 3, false},
+		{"empty", "", "", 1, false},
+	}
+	for _, c := range cases {
+		values, repaired, err := splitRecord(c.line)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(values) != c.columns || repaired != c.repaired {
+			t.Errorf("%s: %d columns repaired %v, want %d %v", c.name, len(values), repaired, c.columns, c.repaired)
+			continue
+		}
+		if c.columns == binDataColumns && values[10] != c.bankName {
+			t.Errorf("%s: bank_name %q, want %q", c.name, values[10], c.bankName)
+		}
+	}
+}
+
+func TestFormatRecord(t *testing.T) {
+	cases := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"1", "TEST BANK", ""}, "1,TEST BANK,"},
+		{[]string{"1", "BANK, N.A."}, "1,\"BANK, N.A.\""},
+		{[]string{"1", "say \"hi\""}, "1,\"say \"\"hi\"\"\""},
+		{[]string{"1", "TEST\r\nBANK"}, "1,TEST BANK"},
+		{[]string{"1", "TEST\nBANK"}, "1,TEST BANK"},
+	}
+	for _, c := range cases {
+		if got := formatRecord(c.values); got != c.want {
+			t.Errorf("%q: %q, want %q", c.values, got, c.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name  string
+		line  string
+		count int
+		err   bool
+	}{
+		{"single", "1,400000,,16,y,visa,,credit,,US,TEST BANK,,,,", 1, false},
+		{"range", "1,400000,400009,16,y,visa,,credit,,US,TEST BANK,,,,", 10, false},
+		{"reversed range", "1,400009,400000,16,y,visa,,credit,,US,TEST BANK,,,,", 0, true},
+		{"columns", "1,400000,,16,y,visa", 0, true},
+		{"bad id", "x,400000,,16,y,visa,,credit,,US,TEST BANK,,,,", 0, true},
+		{"bad bin", "1,40000x,,16,y,visa,,credit,,US,TEST BANK,,,,", 0, true},
+	}
+	for _, c := range cases {
+		result, err := parse(c.line)
+		if (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.name, err)
+			continue
+		}
+		if len(result) != c.count {
+			t.Errorf("%s: %d records, want %d", c.name, len(result), c.count)
+		}
+	}
+	result, _ := parse("1,400000,400009,16,y,visa,,credit,,US,TEST BANK,,,,")
+	if result[9].IinStart != 400009 || result[9].IinEnd != 400009 || result[9].Id != 1 {
+		t.Errorf("last record %+v", result[9])
+	}
+}
+
+func TestFormatParseRoundTrip(t *testing.T) {
+	bindata := testBinData(7, 400000, 400000, "BANK, N.A.")
+	bindata.BankCity = "NEW\nYORK"
+	result, err := parse(FormatBinData(bindata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Id != 7 || result[0].BankName != "BANK, N.A." || result[0].BankCity != "NEW YORK" {
+		t.Errorf("round trip %+v", result)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.bd")
+	writeDataFile(t, path,
+		"1,400000,,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,400001,,,,visa,,credit,,US,BANK, N.A.,,,,",
+		"3,400002,visa")
+	original, _ := os.ReadFile(path)
+
+	result, err := MigrateFile(path, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lines != 3 || result.Rewritten != 1 || len(result.Failed) != 1 || result.Failed[0] != 4 {
+		t.Errorf("dry run %+v", result)
+	}
+	if content, _ := os.ReadFile(path); string(content) != string(original) {
+		t.Error("dry run rewrote the file")
+	}
+
+	if _, err = MigrateFile(path, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := os.ReadFile(path + ".bak"); string(backup) != string(original) {
+		t.Error("backup differs from the original")
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), "\"BANK, N.A.\"") || !strings.Contains(string(content), "3,400002,visa\n") {
+		t.Errorf("migrated content %q", content)
+	}
+	if result, _ = MigrateFile(path, false, false); result.Rewritten != 0 {
+		t.Errorf("second migration rewrote %d lines", result.Rewritten)
+	}
+}
+
+func TestMigrateFileHeaderless(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "headerless.bd")
+	lines := []string{
+		"1,400000,,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,400001,,,,visa,,credit,,US,BANK, N.A.,,,,",
+		"3,400002,visa",
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := MigrateFile(path, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//写入header及转义逗号, 第一行保留为数据
+	if result.Lines != 3 || result.Rewritten != 2 || len(result.Failed) != 1 || result.Failed[0] != 3 {
+		t.Errorf("result %+v", result)
+	}
+	content, _ := os.ReadFile(path)
+	want := binDataHeader + "\n" + lines[0] + "\n" + "2,400001,,,,visa,,credit,,US,\"BANK, N.A.\",,,,\n" + lines[2] + "\n"
+	if string(content) != want {
+		t.Errorf("migrated content %q, want %q", content, want)
+	}
+}
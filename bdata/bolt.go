@@ -0,0 +1,285 @@
+package bdata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+var (
+	boltFileName          = "bindata.db"
+	boltExactBucket       = []byte("exact")
+	boltApproximateBucket = []byte("approximate")
+	//已导入的数据文件及导入的字节数
+	boltFilesBucket = []byte("files")
+)
+
+//以bbolt存储的数据库, key为大端序的bin, 便于按区间遍历
+//数据文件仍然是数据源, 启动及文件变化时增量导入
+type boltDatabase struct {
+	db      *bolt.DB
+	dataDir string
+}
+
+func NewBoltDatabase() BinDatabase {
+	return &boltDatabase{}
+}
+
+//BoltFilePath 数据目录下默认的bbolt数据库文件
+func BoltFilePath(dataDir string) string {
+	return strings.Join([]string{dataDir, boltFileName}, "/")
+}
+
+func openBolt(dbPath string) (*bolt.DB, error) {
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltExactBucket, boltApproximateBucket, boltFilesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (b *boltDatabase) Init(cfg BinDataConfig) error {
+	dbPath := cfg.BoltPath
+	if dbPath == "" {
+		dbPath = BoltFilePath(cfg.DataDir)
+	}
+	var err error
+	if b.db, err = openBolt(dbPath); err != nil {
+		logger.Errorf("open bolt database error: %s, path: %s", err, dbPath)
+		return errors.New("初始化bolt数据库失败")
+	}
+	b.dataDir = cfg.DataDir
+
+	var imported int
+	if imported, err = importBoltFiles(b.db, cfg.DataDir); err != nil {
+		logger.Errorf("import bin data error: %s", err)
+		return errors.New("初始化bolt数据库失败")
+	}
+	logger.Infof("bolt数据库导入 %d 个bin, path: %s", imported, dbPath)
+
+	AddFileListener(func(event file.FileEvent) {
+		if !IsBinDataFile(event.Filepath) {
+			return
+		}
+		if _, err := importBoltFile(b.db, event.Filepath); err != nil {
+			logger.Errorf("import bin data error: %s, filepath: %s", err, event.Filepath)
+		}
+	})
+	return nil
+}
+
+func (b *boltDatabase) Close() error {
+	if b.db == nil {
+		return nil
+	}
+	return b.db.Close()
+}
+
+func (b *boltDatabase) ReadExact(bin uint32) (mod.BinData, error) {
+	var result mod.BinData
+	found := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltExactBucket).Get(binKey(bin))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &result)
+	})
+	if err != nil {
+		return NullBinData, err
+	}
+	if !found {
+		return NullBinData, notFound(bin)
+	}
+	return result, nil
+}
+
+func (b *boltDatabase) ReadApproximate(bin uint32) ([]mod.BinData, error) {
+	var result []mod.BinData
+	prefix := binKey(bin)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltApproximateBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			var d mod.BinData
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			result = append(result, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, notFound(bin)
+	}
+	return result, nil
+}
+
+func (b *boltDatabase) Scan(fn func(bindata mod.BinData) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltExactBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var d mod.BinData
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if !fn(d) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+//先写入按日期分区的数据文件, 再写入bbolt, 写入bbolt失败时重启后会从数据文件重新导入
+func (b *boltDatabase) Save(bin uint32, bindata mod.BinData, approximate bool) error {
+	if _, err := b.ReadExact(bin); err == nil && approximate {
+		return nil
+	}
+	if b.dataDir == "" {
+		return errors.New("存储地址未配置")
+	}
+	date := time.Now().Format(DatePatternCompact)
+	filename := binDataFileName
+	if approximate {
+		filename = binDataApproximateFileName
+	}
+	if err := write2File(bin, strings.Join([]string{b.dataDir, date, filename}, "/"), bindata); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putBinData(tx, bin, bindata, approximate)
+	})
+}
+
+//与内存数据库一致, 已存在的确切数据不覆盖
+func putBinData(tx *bolt.Tx, bin uint32, bindata mod.BinData, approximate bool) error {
+	value, err := json.Marshal(bindata)
+	if err != nil {
+		return err
+	}
+	if approximate {
+		key := make([]byte, 12)
+		binary.BigEndian.PutUint32(key, bin)
+		binary.BigEndian.PutUint64(key[4:], uint64(bindata.Id))
+		return tx.Bucket(boltApproximateBucket).Put(key, value)
+	}
+	bucket := tx.Bucket(boltExactBucket)
+	if bucket.Get(binKey(bin)) != nil {
+		return nil
+	}
+	return bucket.Put(binKey(bin), value)
+}
+
+//导入目录下所有数据文件, 已导入的部分会跳过
+func importBoltFiles(db *bolt.DB, dataDir string) (int, error) {
+	filepaths, err := searchBinDataFiles(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, filepath := range filepaths {
+		var n int
+		if n, err = importBoltFile(db, filepath); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+//增量导入数据文件, 文件变小时重新导入整个文件
+func importBoltFile(db *bolt.DB, filepath string) (int, error) {
+	fileInfo, err := os.Stat(filepath)
+	if err != nil {
+		return 0, err
+	}
+	var offset int64
+	err = db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltFilesBucket).Get([]byte(filepath)); v != nil {
+			offset = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if offset == fileInfo.Size() {
+		return 0, nil
+	}
+	if offset > fileInfo.Size() {
+		offset = 0
+	}
+
+	var (
+		lines    []string
+		filesize int64
+	)
+	if lines, filesize, err = read(filepath, offset); err != nil {
+		return 0, err
+	}
+	approximate := IsApproximateFile(filepath)
+	count := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, line := range lines {
+			data, err := parse(line)
+			if err != nil {
+				logger.Errorf("parse bin data error: %s, data: %s", err, line)
+				continue
+			}
+			for _, d := range data {
+				if err = putBinData(tx, d.IinStart, d, approximate); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(filesize))
+		return tx.Bucket(boltFilesBucket).Put([]byte(filepath), size)
+	})
+	return count, err
+}
+
+//BoltImport 将数据目录中的数据文件导入bbolt数据库, 返回导入的bin数量
+func BoltImport(dbPath, dataDir string) (int, error) {
+	db, err := openBolt(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return importBoltFiles(db, dataDir)
+}
+
+func binKey(bin uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, bin)
+	return key
+}
+
+func hasPrefix(key, prefix []byte) bool {
+	return len(key) >= len(prefix) && string(key[:len(prefix)]) == string(prefix)
+}
@@ -0,0 +1,140 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func openTestBolt(t *testing.T) *boltDatabase {
+	t.Helper()
+	savedListeners := fileEventListenerList
+	t.Cleanup(func() { fileEventListenerList = savedListeners })
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "ranges.bd"),
+		"1,400000,400002,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,400001,,,,visa,,credit,,US,OTHER BANK,,,,")
+	writeDataFile(t, filepath.Join(dir, "20190601", "approximate.bd2"),
+		"4,500000,,,,visa,,credit,,US,GUESS BANK,,,,",
+		"3,500000,,,,visa,,debit,,US,GUESS BANK,,,,")
+	b := NewBoltDatabase().(*boltDatabase)
+	if err := b.Init(BinDataConfig{DataDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBoltRead(t *testing.T) {
+	b := openTestBolt(t)
+	cases := []struct {
+		bin  uint32
+		id   int64
+		bank string
+	}{
+		{400000, 1, "TEST BANK"},
+		//已存在的确切数据不覆盖
+		{400001, 1, "TEST BANK"},
+		{400002, 1, "TEST BANK"},
+		{400003, 0, ""},
+	}
+	for _, c := range cases {
+		d, err := b.ReadExact(c.bin)
+		if c.id == 0 {
+			if !IsNotFound(err) {
+				t.Errorf("%d: err %v, want not found", c.bin, err)
+			}
+			continue
+		}
+		if err != nil || d.Id != c.id || d.BankName != c.bank {
+			t.Errorf("%d: %+v %v", c.bin, d, err)
+		}
+	}
+
+	//近似数据按id排序
+	list, err := b.ReadApproximate(500000)
+	if err != nil || len(list) != 2 || list[0].Id != 3 || list[1].Id != 4 {
+		t.Errorf("approximate %+v %v", list, err)
+	}
+	if _, err = b.ReadApproximate(400000); !IsNotFound(err) {
+		t.Errorf("err %v, want not found", err)
+	}
+
+	var bins []uint32
+	b.Scan(func(d mod.BinData) bool {
+		bins = append(bins, d.IinStart)
+		return len(bins) < 2
+	})
+	if len(bins) != 2 || bins[0] != 400000 || bins[1] != 400001 {
+		t.Errorf("scan %v", bins)
+	}
+}
+
+func TestBoltSave(t *testing.T) {
+	b := openTestBolt(t)
+	data := testBinData(10, 600000, 600000, "NEW BANK")
+	if err := b.Save(600000, data, false); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := b.ReadExact(600000); err != nil || d.Id != 10 {
+		t.Errorf("saved %+v %v", d, err)
+	}
+	//已有确切数据时忽略近似数据
+	if err := b.Save(600000, testBinData(11, 600000, 600000, "GUESS BANK"), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ReadApproximate(600000); !IsNotFound(err) {
+		t.Errorf("err %v, want not found", err)
+	}
+	//写入按日期分区的数据文件, 重新导入时跳过已导入的部分
+	files, _ := searchBinDataFiles(b.dataDir)
+	if len(files) != 3 {
+		t.Errorf("data files %v", files)
+	}
+	if n, err := importBoltFiles(b.db, b.dataDir); err != nil || n != 1 {
+		t.Errorf("reimported %d %v", n, err)
+	}
+}
+
+func TestImportBoltFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ranges.bd")
+	writeDataFile(t, path, "1,400000,400001,,,visa,,credit,,US,TEST BANK,,,,")
+	dbPath := filepath.Join(dir, "bindata.db")
+	if n, err := BoltImport(dbPath, dir); err != nil || n != 2 {
+		t.Fatalf("imported %d %v", n, err)
+	}
+	db, err := openBolt(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cases := []struct {
+		name   string
+		update func()
+		count  int
+	}{
+		{"unchanged", func() {}, 0},
+		{"appended", func() {
+			f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			f.WriteString("2,400002,,,,visa,,credit,,US,TEST BANK,,,,\nbroken\n")
+			f.Close()
+		}, 1},
+		{"shrunk", func() {
+			writeDataFile(t, path, "3,400009,,,,visa,,credit,,US,TEST BANK,,,,")
+		}, 1},
+	}
+	for _, c := range cases {
+		c.update()
+		if n, err := importBoltFile(db, path); err != nil || n != c.count {
+			t.Errorf("%s: imported %d %v, want %d", c.name, n, err, c.count)
+		}
+	}
+	b := &boltDatabase{db: db}
+	if d, err := b.ReadExact(400009); err != nil || d.Id != 3 {
+		t.Errorf("reimported %+v %v", d, err)
+	}
+}
@@ -0,0 +1,275 @@
+package bdata
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+const (
+	DefaultCacheTTL         = 10 * time.Minute
+	DefaultCacheNegativeTTL = time.Minute
+)
+
+//CacheStats 缓存的命中统计
+type CacheStats struct {
+	Size          int     `json:"size"`
+	Capacity      int     `json:"capacity"`
+	Hits          uint64  `json:"hits"`
+	NegativeHits  uint64  `json:"negative_hits"`
+	Misses        uint64  `json:"misses"`
+	Evictions     uint64  `json:"evictions"`
+	Expirations   uint64  `json:"expirations"`
+	Invalidations uint64  `json:"invalidations"`
+	HitRatio      float64 `json:"hit_ratio"`
+}
+
+type cacheKey struct {
+	bin         uint32
+	approximate bool
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	exact   mod.BinData
+	list    []mod.BinData
+	missing bool
+	expires time.Time
+}
+
+//带LRU缓存的数据库, 缓存查询到的结果及未找到的结果, 可包装任意数据库
+//Save及数据文件变化时失效
+type cachedDatabase struct {
+	backend     BinDatabase
+	mutex       sync.Mutex
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	items       map[cacheKey]*list.Element
+	lru         *list.List
+	//每次失效时递增, 查询期间发生失效时不写入缓存
+	generation uint64
+	stats      CacheStats
+}
+
+func newCachedDatabase(backend BinDatabase, capacity int, ttl, negativeTTL time.Duration) *cachedDatabase {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultCacheNegativeTTL
+	}
+	return &cachedDatabase{
+		backend:     backend,
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		items:       make(map[cacheKey]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+func (c *cachedDatabase) Init(cfg BinDataConfig) error {
+	if err := c.backend.Init(cfg); err != nil {
+		return err
+	}
+	//在数据库的监听之后执行, 数据重新加载后再清空缓存
+	//内存数据库在后台重新加载, 由refreshBinData在数据应用后清空
+	AddFileListener(func(event file.FileEvent) {
+		if _, ok := c.backend.(*memoryDatabase); ok {
+			return
+		}
+		if IsBinDataFile(event.Filepath) {
+			c.Purge()
+		}
+	})
+	return nil
+}
+
+func (c *cachedDatabase) Close() error {
+	if closer, ok := c.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *cachedDatabase) ReadExact(bin uint32) (mod.BinData, error) {
+	key := cacheKey{bin: bin}
+	if entry, ok := c.get(key); ok {
+		if entry.missing {
+			return NullBinData, notFound(bin)
+		}
+		return entry.exact, nil
+	}
+	generation := c.currentGeneration()
+	result, err := c.backend.ReadExact(bin)
+	if err != nil {
+		if IsNotFound(err) {
+			c.put(generation, &cacheEntry{key: key, missing: true})
+		}
+		return result, err
+	}
+	c.put(generation, &cacheEntry{key: key, exact: result})
+	return result, nil
+}
+
+func (c *cachedDatabase) ReadApproximate(bin uint32) ([]mod.BinData, error) {
+	key := cacheKey{bin: bin, approximate: true}
+	if entry, ok := c.get(key); ok {
+		if entry.missing {
+			return nil, notFound(bin)
+		}
+		return append([]mod.BinData(nil), entry.list...), nil
+	}
+	generation := c.currentGeneration()
+	result, err := c.backend.ReadApproximate(bin)
+	if err != nil {
+		if IsNotFound(err) {
+			c.put(generation, &cacheEntry{key: key, missing: true})
+		}
+		return result, err
+	}
+	c.put(generation, &cacheEntry{key: key, list: append([]mod.BinData(nil), result...)})
+	return result, nil
+}
+
+func (c *cachedDatabase) Save(bin uint32, bindata mod.BinData, approximate bool) error {
+	err := c.backend.Save(bin, bindata, approximate)
+	c.Invalidate(bin)
+	return err
+}
+
+func (c *cachedDatabase) Scan(fn func(bindata mod.BinData) bool) error {
+	return c.backend.Scan(fn)
+}
+
+//Invalidate 使bin的确切及近似结果失效
+func (c *cachedDatabase) Invalidate(bin uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	for _, key := range []cacheKey{{bin: bin}, {bin: bin, approximate: true}} {
+		if element, ok := c.items[key]; ok {
+			c.remove(element)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+//Purge 清空缓存
+func (c *cachedDatabase) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.stats.Invalidations += uint64(len(c.items))
+	c.items = make(map[cacheKey]*list.Element)
+	c.lru.Init()
+}
+
+func (c *cachedDatabase) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Size = len(c.items)
+	stats.Capacity = c.capacity
+	if total := stats.Hits + stats.NegativeHits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits+stats.NegativeHits) / float64(total)
+	}
+	return stats
+}
+
+func (c *cachedDatabase) currentGeneration() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+func (c *cachedDatabase) get(key cacheKey) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	if entry.missing {
+		c.stats.NegativeHits++
+	} else {
+		c.stats.Hits++
+	}
+	return entry, true
+}
+
+func (c *cachedDatabase) put(generation uint64, entry *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation {
+		return
+	}
+	ttl := c.ttl
+	if entry.missing {
+		ttl = c.negativeTTL
+	}
+	entry.expires = time.Now().Add(ttl)
+	if element, ok := c.items[entry.key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.items[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *cachedDatabase) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.items, element.Value.(*cacheEntry).key)
+}
+
+//当前数据库外层的缓存, 未启用时返回nil
+func currentCache() *cachedDatabase {
+	cache, _ := currentBinDatabase.(*cachedDatabase)
+	return cache
+}
+
+//去掉缓存, 返回实际的数据库
+func unwrapBinDatabase() BinDatabase {
+	if cache := currentCache(); cache != nil {
+		return cache.backend
+	}
+	return currentBinDatabase
+}
+
+//CurrentCacheStats 当前缓存的命中统计
+func CurrentCacheStats() (CacheStats, error) {
+	cache := currentCache()
+	if cache == nil {
+		return CacheStats{}, errors.New("缓存未启用")
+	}
+	return cache.Stats(), nil
+}
+
+//PurgeCache 清空当前缓存
+func PurgeCache() error {
+	cache := currentCache()
+	if cache == nil {
+		return errors.New("缓存未启用")
+	}
+	cache.Purge()
+	return nil
+}
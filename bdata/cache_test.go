@@ -0,0 +1,69 @@
+package bdata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//使用独立的内存数据库及缓存替换当前数据库
+func useTestCache(t *testing.T) *cachedDatabase {
+	t.Helper()
+	cache := newCachedDatabase(useTestMemory(t), 10, 0, 0)
+	currentBinDatabase = cache
+	return cache
+}
+
+func TestCacheGeneration(t *testing.T) {
+	cache := useTestCache(t)
+	memory.dataMap[400000] = mod.BinData{Id: 1, IinStart: 400000, IinEnd: 400000}
+
+	cases := []struct {
+		name       string
+		invalidate func()
+		cached     bool
+	}{
+		{"same generation", func() {}, true},
+		{"invalidated", func() { cache.Invalidate(400000) }, false},
+		{"purged", cache.Purge, false},
+	}
+	for _, c := range cases {
+		cache.Purge()
+		generation := cache.currentGeneration()
+		c.invalidate()
+		//失效之前查询到的结果不写入缓存
+		cache.put(generation, &cacheEntry{key: cacheKey{bin: 400000}, exact: memory.dataMap[400000]})
+		if _, ok := cache.get(cacheKey{bin: 400000}); ok != c.cached {
+			t.Errorf("%s: cached %v, want %v", c.name, ok, c.cached)
+		}
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	cache := useTestCache(t)
+	for i := 0; i < 2; i++ {
+		if _, err := cache.ReadExact(400000); !IsNotFound(err) {
+			t.Fatalf("err %v, want not found", err)
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.NegativeHits != 1 || stats.Size != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestRefreshBinDataPurgesCache(t *testing.T) {
+	cache := useTestCache(t)
+	if _, err := cache.ReadExact(400000); !IsNotFound(err) {
+		t.Fatalf("err %v, want not found", err)
+	}
+	path := filepath.Join(t.TempDir(), "ranges.bd")
+	writeDataFile(t, path, "1,400000,,,,visa,,credit,,US,TEST BANK,,,,")
+	refreshBinData(file.FileEvent{Filepath: path, FileCreated: true})
+
+	d, err := cache.ReadExact(400000)
+	if err != nil || d.BankName != "TEST BANK" {
+		t.Fatalf("after refresh %+v, %v", d, err)
+	}
+}
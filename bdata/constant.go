@@ -12,4 +12,6 @@ const (
 
 	BinDatabaseModeMemory = "memory"
 	BinDatabaseModeRedis  = "redis"
+	BinDatabaseModeBolt   = "bolt"
+	BinDatabaseModeSql    = "sql"
 )
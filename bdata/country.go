@@ -0,0 +1,184 @@
+package bdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+var (
+	//数据目录下修正国家信息的文件, 列为alpha2,alpha3,numeric,name,region,eu,eea,sanctioned, 为空的列保持内置的值
+	countryOverrideFileName = "countries_override.csv"
+	euMembers               = "AT BE BG HR CY CZ DK EE FI FR DE GR HU IE IT LV LT LU MT NL PL PT RO SK SI ES SE"
+	//欧洲经济区中的非欧盟国家
+	eeaOnlyMembers = "IS LI NO"
+	//受全面制裁的国家, 可通过覆盖文件修改
+	sanctionedCountries = "CU IR KP SY"
+)
+
+//国家信息, 按alpha-2索引, 并可按alpha-3, numeric, 名称查找
+type countryTable struct {
+	mutex    sync.RWMutex
+	byAlpha2 map[string]mod.Country
+	index    map[string]string
+}
+
+var countries = newCountryTable(nil)
+
+//内置的ISO 3166表, 再应用覆盖的记录
+func newCountryTable(overrides []map[string]string) *countryTable {
+	t := &countryTable{byAlpha2: make(map[string]mod.Country, 256), index: make(map[string]string, 1024)}
+	for _, line := range strings.Split(iso3166Table, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 5 {
+			continue
+		}
+		t.byAlpha2[fields[0]] = mod.Country{Alpha2: fields[0], Alpha3: fields[1], Numeric: fields[2], Name: fields[3], Region: fields[4]}
+	}
+	for _, code := range strings.Fields(euMembers) {
+		c := t.byAlpha2[code]
+		c.EU, c.EEA = true, true
+		t.byAlpha2[code] = c
+	}
+	for _, code := range strings.Fields(eeaOnlyMembers) {
+		c := t.byAlpha2[code]
+		c.EEA = true
+		t.byAlpha2[code] = c
+	}
+	for _, code := range strings.Fields(sanctionedCountries) {
+		c := t.byAlpha2[code]
+		c.Sanctioned = true
+		t.byAlpha2[code] = c
+	}
+	for _, o := range overrides {
+		code := strings.ToUpper(o["alpha2"])
+		c, ok := t.byAlpha2[code]
+		if !ok {
+			c = mod.Country{Alpha2: code}
+		}
+		for column, value := range o {
+			if value == "" {
+				continue
+			}
+			switch column {
+			case "alpha3":
+				c.Alpha3 = strings.ToUpper(value)
+			case "numeric":
+				c.Numeric = value
+			case "name":
+				c.Name = value
+			case "region":
+				c.Region = value
+			case "eu":
+				c.EU = normalizeFlag(value, "n") == "y"
+			case "eea":
+				c.EEA = normalizeFlag(value, "n") == "y"
+			case "sanctioned":
+				c.Sanctioned = normalizeFlag(value, "n") == "y"
+			}
+		}
+		t.byAlpha2[code] = c
+	}
+	for code, c := range t.byAlpha2 {
+		t.index[code] = code
+		if c.Alpha3 != "" {
+			t.index[c.Alpha3] = code
+		}
+		if c.Numeric != "" {
+			t.index[c.Numeric] = code
+		}
+		if c.Name != "" {
+			t.index[strings.ToUpper(c.Name)] = code
+		}
+	}
+	return t
+}
+
+//读取覆盖文件, 文件不存在时只使用内置的表
+func loadCountryOverrides(filepath string) error {
+	var overrides []map[string]string
+	f, err := os.Open(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer f.Close()
+		if overrides, err = readCountryOverrides(f); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", filepath, err))
+		}
+	}
+	table := newCountryTable(overrides)
+	countries.mutex.Lock()
+	countries.byAlpha2, countries.index = table.byAlpha2, table.index
+	countries.mutex.Unlock()
+	return nil
+}
+
+func readCountryOverrides(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	if !contains(header, "alpha2") {
+		return nil, errors.New("缺少alpha2列")
+	}
+	var result []map[string]string
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range values {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		if len(row["alpha2"]) != 2 {
+			return nil, errors.New(fmt.Sprintf("非法的alpha2 %q", row["alpha2"]))
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+//IsCountryCode 是否为合法的ISO 3166-1 alpha-2国家代码
+func IsCountryCode(code string) bool {
+	countries.mutex.RLock()
+	defer countries.mutex.RUnlock()
+	_, ok := countries.byAlpha2[code]
+	return ok
+}
+
+//LookupCountry 按alpha-2, alpha-3, numeric或英文名称查找国家, 不区分大小写
+func LookupCountry(value string) (mod.Country, bool) {
+	key := strings.ToUpper(strings.TrimSpace(value))
+	if n, err := strconv.Atoi(key); err == nil {
+		key = fmt.Sprintf("%03d", n)
+	}
+	countries.mutex.RLock()
+	defer countries.mutex.RUnlock()
+	code, ok := countries.index[key]
+	if !ok {
+		return mod.Country{}, false
+	}
+	return countries.byAlpha2[code], true
+}
@@ -0,0 +1,121 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupCountry(t *testing.T) {
+	cases := []struct {
+		value  string
+		alpha2 string
+		ok     bool
+	}{
+		{"DE", "DE", true},
+		{"de", "DE", true},
+		{"DEU", "DE", true},
+		{"276", "DE", true},
+		//numeric不足3位时补0
+		{"40", "AT", true},
+		{"Germany", "DE", true},
+		{" germany ", "DE", true},
+		{"XX", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		country, ok := LookupCountry(c.value)
+		if ok != c.ok || country.Alpha2 != c.alpha2 {
+			t.Errorf("%q: %+v %v", c.value, country, ok)
+		}
+	}
+	if !IsCountryCode("US") || IsCountryCode("us") || IsCountryCode("USA") {
+		t.Error("IsCountryCode accepts only alpha-2 codes")
+	}
+}
+
+func TestCountryFlags(t *testing.T) {
+	cases := []struct {
+		alpha2     string
+		eu, eea    bool
+		sanctioned bool
+	}{
+		{"DE", true, true, false},
+		{"NO", false, true, false},
+		{"CH", false, false, false},
+		{"KP", false, false, true},
+		{"US", false, false, false},
+	}
+	for _, c := range cases {
+		country, _ := LookupCountry(c.alpha2)
+		if country.EU != c.eu || country.EEA != c.eea || country.Sanctioned != c.sanctioned {
+			t.Errorf("%s: %+v", c.alpha2, country)
+		}
+	}
+}
+
+func TestReadCountryOverrides(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		rows  int
+		err   bool
+	}{
+		{"empty", "", 0, false},
+		{"header only", "alpha2,name\n", 0, false},
+		{"rows", "Alpha2, Sanctioned\nRU,yes\nXK,\n", 2, false},
+		{"missing alpha2 column", "code,name\nRU,Russia\n", 0, true},
+		{"invalid alpha2", "alpha2,name\nRUS,Russia\n", 0, true},
+	}
+	for _, c := range cases {
+		rows, err := readCountryOverrides(strings.NewReader(c.input))
+		if (err != nil) != c.err || len(rows) != c.rows {
+			t.Errorf("%s: %v %v", c.name, rows, err)
+		}
+	}
+}
+
+func TestLoadCountryOverrides(t *testing.T) {
+	countries.mutex.RLock()
+	savedByAlpha2, savedIndex := countries.byAlpha2, countries.index
+	countries.mutex.RUnlock()
+	t.Cleanup(func() {
+		countries.mutex.Lock()
+		countries.byAlpha2, countries.index = savedByAlpha2, savedIndex
+		countries.mutex.Unlock()
+	})
+
+	path := filepath.Join(t.TempDir(), countryOverrideFileName)
+	content := "alpha2,alpha3,numeric,name,region,eu,eea,sanctioned\n" +
+		"RU,,,,,,,yes\n" +
+		"CU,,,,,,,no\n" +
+		"XK,XKX,,Kosovo,Europe,,,\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadCountryOverrides(path); err != nil {
+		t.Fatal(err)
+	}
+	if ru, _ := LookupCountry("RU"); !ru.Sanctioned || ru.Name == "" {
+		t.Errorf("RU %+v", ru)
+	}
+	if cu, _ := LookupCountry("CU"); cu.Sanctioned {
+		t.Errorf("CU %+v", cu)
+	}
+	if xk, ok := LookupCountry("kosovo"); !ok || xk.Alpha2 != "XK" || xk.Alpha3 != "XKX" || !IsCountryCode("XK") {
+		t.Errorf("XK %+v %v", xk, ok)
+	}
+
+	//文件不存在时恢复内置的表
+	if err := loadCountryOverrides(path + ".missing"); err != nil {
+		t.Fatal(err)
+	}
+	if IsCountryCode("XK") {
+		t.Error("override kept after the file was removed")
+	}
+	os.WriteFile(path, []byte("alpha2\nRUS\n"), 0644)
+	if err := loadCountryOverrides(path); err == nil {
+		t.Error("loaded invalid override file")
+	}
+}
@@ -0,0 +1,133 @@
+package bdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//数据目录下按bin区间指定货币的文件, 列为iin_start,iin_end,currency, 用于发行多币种卡的银行
+var currencyOverrideFileName = "currencies_override.csv"
+
+//bin区间使用的货币
+type currencyRange struct {
+	start, end uint32
+	currency   string
+}
+
+type currencyTable struct {
+	mutex     sync.RWMutex
+	byCode    map[string]mod.Currency
+	byCountry map[string]string
+	//按区间大小升序, 区间重叠时取最小的区间
+	ranges []currencyRange
+}
+
+var currencies = newCurrencyTable()
+
+func newCurrencyTable() *currencyTable {
+	t := &currencyTable{byCode: make(map[string]mod.Currency, 180), byCountry: make(map[string]string, 256)}
+	for _, line := range strings.Split(iso4217Table, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 4 {
+			continue
+		}
+		minorUnits, _ := strconv.Atoi(fields[2])
+		t.byCode[fields[0]] = mod.Currency{Code: fields[0], Numeric: fields[1], MinorUnits: minorUnits, Name: fields[3]}
+	}
+	for _, pair := range strings.Fields(countryCurrencyTable) {
+		if kv := strings.SplitN(pair, ":", 2); len(kv) == 2 {
+			t.byCountry[kv[0]] = kv[1]
+		}
+	}
+	return t
+}
+
+//读取按bin区间指定货币的文件, 文件不存在时清空
+func loadCurrencyOverrides(filepath string) error {
+	var ranges []currencyRange
+	f, err := os.Open(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer f.Close()
+		if ranges, err = readCurrencyOverrides(f); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", filepath, err))
+		}
+	}
+	currencies.mutex.Lock()
+	currencies.ranges = ranges
+	currencies.mutex.Unlock()
+	return nil
+}
+
+func readCurrencyOverrides(r io.Reader) ([]currencyRange, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	var result []currencyRange
+	for line := 1; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && values[0] == "iin_start" {
+			continue
+		}
+		var cr currencyRange
+		if cr.start, err = bin2Uint32(strings.TrimSpace(values[0])); err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", line, err))
+		}
+		cr.end = cr.start
+		if end := strings.TrimSpace(values[1]); end != "" {
+			if cr.end, err = bin2Uint32(end); err != nil {
+				return nil, errors.New(fmt.Sprintf("line %d: %s", line, err))
+			}
+		}
+		if cr.end < cr.start {
+			return nil, errors.New(fmt.Sprintf("line %d: iin_start %d 大于 iin_end %d", line, cr.start, cr.end))
+		}
+		cr.currency = strings.ToUpper(strings.TrimSpace(values[2]))
+		if _, ok := currencies.byCode[cr.currency]; !ok {
+			return nil, errors.New(fmt.Sprintf("line %d: 未知的货币 %s", line, values[2]))
+		}
+		result = append(result, cr)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].end-result[i].start < result[j].end-result[j].start })
+	return result, nil
+}
+
+//LookupCurrency 按ISO 4217代码查找货币
+func LookupCurrency(code string) (mod.Currency, bool) {
+	currencies.mutex.RLock()
+	defer currencies.mutex.RUnlock()
+	c, ok := currencies.byCode[strings.ToUpper(code)]
+	return c, ok
+}
+
+//BinCurrency bin可能的账单货币, 优先使用覆盖文件中的区间, 否则使用发卡国家的货币
+func BinCurrency(bin uint32, country string) (mod.Currency, bool) {
+	currencies.mutex.RLock()
+	defer currencies.mutex.RUnlock()
+	for _, cr := range currencies.ranges {
+		if cr.start <= bin && bin <= cr.end {
+			return currencies.byCode[cr.currency], true
+		}
+	}
+	code, ok := currencies.byCountry[country]
+	if !ok {
+		return mod.Currency{}, false
+	}
+	return currencies.byCode[code], true
+}
@@ -0,0 +1,98 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	cases := []struct {
+		code       string
+		numeric    string
+		minorUnits int
+		ok         bool
+	}{
+		{"USD", "840", 2, true},
+		{"jpy", "392", 0, true},
+		{"BHD", "048", 3, true},
+		{"XXX1", "", 0, false},
+	}
+	for _, c := range cases {
+		currency, ok := LookupCurrency(c.code)
+		if ok != c.ok || currency.Numeric != c.numeric || currency.MinorUnits != c.minorUnits {
+			t.Errorf("%s: %+v %v", c.code, currency, ok)
+		}
+	}
+}
+
+func TestReadCurrencyOverrides(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		first string
+		rows  int
+		err   bool
+	}{
+		{"empty", "", "", 0, false},
+		{"header", "iin_start,iin_end,currency\n400000,400099,eur\n", "EUR", 1, false},
+		//按区间大小升序
+		{"sorted", "400000,400099,EUR\n400050,,GBP\n", "GBP", 2, false},
+		{"unknown currency", "400000,,ABC\n", "", 0, true},
+		{"reversed range", "400099,400000,EUR\n", "", 0, true},
+		{"bad bin", "40000x,,EUR\n", "", 0, true},
+		{"columns", "400000,EUR\n", "", 0, true},
+	}
+	for _, c := range cases {
+		ranges, err := readCurrencyOverrides(strings.NewReader(c.input))
+		if (err != nil) != c.err || len(ranges) != c.rows || (c.rows > 0 && ranges[0].currency != c.first) {
+			t.Errorf("%s: %+v %v", c.name, ranges, err)
+		}
+	}
+}
+
+func TestBinCurrency(t *testing.T) {
+	currencies.mutex.RLock()
+	saved := currencies.ranges
+	currencies.mutex.RUnlock()
+	t.Cleanup(func() {
+		currencies.mutex.Lock()
+		currencies.ranges = saved
+		currencies.mutex.Unlock()
+	})
+	path := filepath.Join(t.TempDir(), currencyOverrideFileName)
+	if err := os.WriteFile(path, []byte("iin_start,iin_end,currency\n400000,400099,EUR\n400050,,GBP\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadCurrencyOverrides(path); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		bin     uint32
+		country string
+		code    string
+	}{
+		{400000, "US", "EUR"},
+		//重叠时取最小的区间
+		{400050, "US", "GBP"},
+		{400100, "US", "USD"},
+		{400100, "JP", "JPY"},
+		{400100, "", ""},
+	}
+	for _, c := range cases {
+		currency, ok := BinCurrency(c.bin, c.country)
+		if ok != (c.code != "") || currency.Code != c.code {
+			t.Errorf("%d %s: %+v %v", c.bin, c.country, currency, ok)
+		}
+	}
+
+	//文件不存在时清空区间
+	if err := loadCurrencyOverrides(path + ".missing"); err != nil {
+		t.Fatal(err)
+	}
+	if currency, _ := BinCurrency(400000, "US"); currency.Code != "USD" {
+		t.Errorf("after removal %+v", currency)
+	}
+}
@@ -0,0 +1,102 @@
+package bdata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//Dataset 离线加载的bin数据, 不监听文件变化, 供命令行工具等使用
+type Dataset struct {
+	Exact       map[uint32]mod.BinData
+	Approximate map[uint32]map[int64]mod.BinData
+	Files       []string
+	Lines       int
+	//重放的write-ahead log中未压缩的记录数
+	WalEntries int
+	db         *memoryDatabase
+}
+
+//LoadDataset 加载数据目录或单个.bd/.bd2文件, 与内存数据库使用相同的加载逻辑
+//加载数据目录时重放其中未压缩的write-ahead log, 不修改write-ahead log及数据文件
+func LoadDataset(filepath string) (*Dataset, error) {
+	var (
+		fileInfo os.FileInfo
+		err      error
+	)
+	if fileInfo, err = os.Stat(filepath); err != nil {
+		return nil, err
+	}
+
+	m := newMemoryDatabase()
+	dataset := &Dataset{db: m}
+	if fileInfo.IsDir() {
+		if dataset.Files, err = searchBinDataFiles(filepath); err != nil {
+			return nil, err
+		}
+	} else if IsBinDataFile(filepath) {
+		dataset.Files = []string{filepath}
+	} else {
+		return nil, errors.New(fmt.Sprintf("%s 不是bin数据文件", filepath))
+	}
+
+	for _, f := range dataset.Files {
+		var lines int
+		if lines, _, err = m.loadFile(f, nil, false); err != nil {
+			return nil, err
+		}
+		dataset.Lines += lines
+	}
+	if fileInfo.IsDir() {
+		var entries []walEntry
+		if _, entries, err = readWriteAheadLog(filepath); err != nil {
+			return nil, err
+		}
+		m.dataDir = filepath
+		m.replayWal(entries)
+		dataset.WalEntries = len(entries)
+	}
+	dataset.Exact = m.dataMap
+	dataset.Approximate = m.approximateMap
+	return dataset, nil
+}
+
+//Lookup 查询确切的bin数据
+func (d *Dataset) Lookup(bin uint32) (mod.BinData, bool) {
+	result, ok := d.Exact[bin]
+	return result, ok
+}
+
+//Bins 所有确切bin, 升序
+func (d *Dataset) Bins() []uint32 {
+	bins := make([]uint32, 0, len(d.Exact))
+	for bin := range d.Exact {
+		bins = append(bins, bin)
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+	return bins
+}
+
+//Records 所有确切bin数据, 按bin升序
+func (d *Dataset) Records() []mod.BinData {
+	bins := d.Bins()
+	result := make([]mod.BinData, 0, len(bins))
+	for _, bin := range bins {
+		result = append(result, d.Exact[bin])
+	}
+	return result
+}
+
+//History bin的所有版本
+func (d *Dataset) History(bin uint32) ([]mod.BinVersion, error) {
+	return d.db.History(bin)
+}
+
+//ReadAt bin在指定时间生效的确切数据
+func (d *Dataset) ReadAt(bin uint32, at time.Time) (mod.BinData, error) {
+	return d.db.ReadAt(bin, at)
+}
@@ -0,0 +1,162 @@
+package bdata
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//FieldDiff 单个字段的差异
+type FieldDiff struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+//BinChange 同一个bin在两个数据集中的差异
+type BinChange struct {
+	Bin    uint32      `json:"bin"`
+	Before mod.BinData `json:"before"`
+	After  mod.BinData `json:"after"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+//DiffSummary 分组统计
+type DiffSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+//DatasetDiff 两个数据集的差异, 只比较确切数据
+type DatasetDiff struct {
+	Added     []mod.BinData           `json:"added"`
+	Removed   []mod.BinData           `json:"removed"`
+	Changed   []BinChange             `json:"changed"`
+	Unchanged int                     `json:"unchanged"`
+	ByCountry map[string]*DiffSummary `json:"by_country"`
+	ByScheme  map[string]*DiffSummary `json:"by_scheme"`
+}
+
+//DiffDatasets 比较两个数据集, 新增及变化按after分组, 删除按before分组
+func DiffDatasets(before, after *Dataset) DatasetDiff {
+	diff := DatasetDiff{
+		Added:     make([]mod.BinData, 0),
+		Removed:   make([]mod.BinData, 0),
+		Changed:   make([]BinChange, 0),
+		ByCountry: make(map[string]*DiffSummary),
+		ByScheme:  make(map[string]*DiffSummary)}
+
+	for _, bin := range before.Bins() {
+		b := before.Exact[bin]
+		a, ok := after.Exact[bin]
+		if !ok {
+			diff.Removed = append(diff.Removed, b)
+			diff.group(b).Removed++
+			diff.groupScheme(b).Removed++
+			continue
+		}
+		fields := DiffFields(b, a)
+		if len(fields) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		diff.Changed = append(diff.Changed, BinChange{Bin: bin, Before: b, After: a, Fields: fields})
+		diff.group(a).Changed++
+		diff.groupScheme(a).Changed++
+	}
+	for _, bin := range after.Bins() {
+		if _, ok := before.Exact[bin]; ok {
+			continue
+		}
+		a := after.Exact[bin]
+		diff.Added = append(diff.Added, a)
+		diff.group(a).Added++
+		diff.groupScheme(a).Added++
+	}
+	return diff
+}
+
+//DiffFields 比较两条bin数据的属性
+func DiffFields(before, after mod.BinData) []FieldDiff {
+	var result []FieldDiff
+	for _, column := range attributeColumns {
+		b, a := getColumn(before, column), getColumn(after, column)
+		if b != a {
+			result = append(result, FieldDiff{Field: column, Before: b, After: a})
+		}
+	}
+	return result
+}
+
+func (d *DatasetDiff) group(bindata mod.BinData) *DiffSummary {
+	return summaryOf(d.ByCountry, bindata.Country)
+}
+
+func (d *DatasetDiff) groupScheme(bindata mod.BinData) *DiffSummary {
+	return summaryOf(d.ByScheme, bindata.Schema)
+}
+
+func summaryOf(group map[string]*DiffSummary, key string) *DiffSummary {
+	if key == "" {
+		key = "(empty)"
+	}
+	if s, ok := group[key]; ok {
+		return s
+	}
+	s := &DiffSummary{}
+	group[key] = s
+	return s
+}
+
+//WriteText 以文本格式输出差异, summaryOnly为true时只输出统计
+func (d DatasetDiff) WriteText(w io.Writer, summaryOnly bool) error {
+	p := &errWriter{w: w}
+	p.printf("added: %d, removed: %d, changed: %d, unchanged: %d\n", len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+	writeSummary(p, "country", d.ByCountry)
+	writeSummary(p, "scheme", d.ByScheme)
+	if summaryOnly {
+		return p.err
+	}
+	p.printf("\n")
+	for _, a := range d.Added {
+		p.printf("+ %d %s %s %s %s\n", a.IinStart, a.Schema, a.CardType, a.Country, a.BankName)
+	}
+	for _, r := range d.Removed {
+		p.printf("- %d %s %s %s %s\n", r.IinStart, r.Schema, r.CardType, r.Country, r.BankName)
+	}
+	for _, c := range d.Changed {
+		for _, f := range c.Fields {
+			p.printf("~ %d %s: %q -> %q\n", c.Bin, f.Field, f.Before, f.After)
+		}
+	}
+	return p.err
+}
+
+func writeSummary(p *errWriter, name string, group map[string]*DiffSummary) {
+	keys := make([]string, 0, len(group))
+	for k := range group {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	p.printf("\n%-10s %8s %8s %8s\n", name, "added", "removed", "changed")
+	for _, k := range keys {
+		s := group[k]
+		p.printf("%-10s %8d %8d %8d\n", k, s.Added, s.Removed, s.Changed)
+	}
+}
+
+//写入出错后忽略后续输出, 最后统一返回错误
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *errWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
@@ -0,0 +1,111 @@
+package bdata
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func testDataset(records ...mod.BinData) *Dataset {
+	dataset := &Dataset{Exact: make(map[uint32]mod.BinData, len(records))}
+	for _, d := range records {
+		dataset.Exact[d.IinStart] = d
+	}
+	return dataset
+}
+
+func TestDiffFields(t *testing.T) {
+	before := testBinData(1, 400000, 400000, "TEST BANK")
+	cases := []struct {
+		name   string
+		update func(d *mod.BinData)
+		fields []string
+	}{
+		{"same", func(d *mod.BinData) {}, nil},
+		{"id only", func(d *mod.BinData) { d.Id = 2 }, nil},
+		{"bank name", func(d *mod.BinData) { d.BankName = "NEW BANK" }, []string{"bank_name"}},
+		{"country and scheme", func(d *mod.BinData) { d.Country = "GB"; d.Schema = "mastercard" }, []string{"scheme", "country"}},
+	}
+	for _, c := range cases {
+		after := before
+		c.update(&after)
+		fields := DiffFields(before, after)
+		if len(fields) != len(c.fields) {
+			t.Errorf("%s: %+v, want %v", c.name, fields, c.fields)
+			continue
+		}
+		for i, f := range fields {
+			if f.Field != c.fields[i] || f.Before != getColumn(before, f.Field) || f.After != getColumn(after, f.Field) {
+				t.Errorf("%s: field %d %+v", c.name, i, f)
+			}
+		}
+	}
+}
+
+func TestDiffDatasets(t *testing.T) {
+	changed := testBinData(2, 400001, 400001, "NEW BANK")
+	changed.Country = "GB"
+	added := testBinData(4, 510000, 510000, "OTHER BANK")
+	added.Schema = "mastercard"
+	added.Country = ""
+	before := testDataset(
+		testBinData(1, 400000, 400000, "TEST BANK"),
+		testBinData(2, 400001, 400001, "TEST BANK"),
+		testBinData(3, 400002, 400002, "TEST BANK"))
+	after := testDataset(
+		testBinData(1, 400000, 400000, "TEST BANK"),
+		changed,
+		added)
+
+	diff := DiffDatasets(before, after)
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Changed) != 1 || diff.Unchanged != 1 {
+		t.Fatalf("diff %+v", diff)
+	}
+	if diff.Added[0].IinStart != 510000 || diff.Removed[0].IinStart != 400002 || diff.Changed[0].Bin != 400001 || len(diff.Changed[0].Fields) != 2 {
+		t.Errorf("diff %+v", diff)
+	}
+	//新增及变化按after分组, 删除按before分组
+	groups := []struct {
+		group map[string]*DiffSummary
+		key   string
+		want  DiffSummary
+	}{
+		{diff.ByCountry, "US", DiffSummary{Removed: 1}},
+		{diff.ByCountry, "GB", DiffSummary{Changed: 1}},
+		{diff.ByCountry, "(empty)", DiffSummary{Added: 1}},
+		{diff.ByScheme, "visa", DiffSummary{Removed: 1, Changed: 1}},
+		{diff.ByScheme, "mastercard", DiffSummary{Added: 1}},
+	}
+	for _, g := range groups {
+		if s, ok := g.group[g.key]; !ok || *s != g.want {
+			t.Errorf("group %s: %+v, want %+v", g.key, s, g.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := diff.WriteText(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	if text := buf.String(); !strings.HasPrefix(text, "added: 1, removed: 1, changed: 1, unchanged: 1\n") || strings.Contains(text, "+ 510000") {
+		t.Errorf("summary %q", text)
+	}
+	buf.Reset()
+	diff.WriteText(&buf, false)
+	for _, line := range []string{"+ 510000 mastercard", "- 400002 visa", "~ 400001 bank_name: \"TEST BANK\" -> \"NEW BANK\""} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("text missing %q", line)
+		}
+	}
+	if err := diff.WriteText(failingWriter{}, false); err == nil {
+		t.Error("write error not returned")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -0,0 +1,132 @@
+package bdata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+const (
+	//与数据文件格式相同, 每个bin一行
+	ExportFormatCSV = "csv"
+	//每行一个json对象
+	ExportFormatJSONLines = "jsonl"
+	//相邻且属性相同的bin合并为区间
+	ExportFormatRanges = "ranges"
+)
+
+//ExportFilter 导出过滤条件, 为空表示不过滤
+type ExportFilter struct {
+	Countries []string
+	Schemes   []string
+}
+
+//ParseExportFilter 解析逗号分隔的国家及卡组织
+func ParseExportFilter(countries, schemes string) ExportFilter {
+	filter := ExportFilter{}
+	for _, c := range strings.Split(countries, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			filter.Countries = append(filter.Countries, c)
+		}
+	}
+	for _, s := range strings.Split(schemes, ",") {
+		if s = NormalizeScheme(s); s != "" {
+			filter.Schemes = append(filter.Schemes, s)
+		}
+	}
+	return filter
+}
+
+func (f ExportFilter) Match(d mod.BinData) bool {
+	if len(f.Countries) > 0 && !contains(f.Countries, d.Country) {
+		return false
+	}
+	if len(f.Schemes) > 0 && !contains(f.Schemes, d.Schema) {
+		return false
+	}
+	return true
+}
+
+//ExportContentType 导出格式对应的content type及文件扩展名
+func ExportContentType(format string) (string, string, error) {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv; charset=utf-8", "csv", nil
+	case ExportFormatJSONLines:
+		return "application/x-ndjson; charset=utf-8", "jsonl", nil
+	case ExportFormatRanges:
+		return "text/csv; charset=utf-8", "csv", nil
+	}
+	return "", "", errors.New(fmt.Sprintf("不支持的导出格式 %s", format))
+}
+
+//Export 导出数据, scan按bin升序遍历数据
+func Export(w io.Writer, format string, filter ExportFilter, scan func(fn func(mod.BinData) bool) error) error {
+	if _, _, err := ExportContentType(format); err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(w)
+	var (
+		ranges   []mod.BinData
+		writeErr error
+	)
+	if format != ExportFormatJSONLines {
+		if _, writeErr = writer.WriteString(binDataHeader + "\n"); writeErr != nil {
+			return writeErr
+		}
+	}
+	encoder := json.NewEncoder(writer)
+	err := scan(func(d mod.BinData) bool {
+		if !filter.Match(d) {
+			return true
+		}
+		switch format {
+		case ExportFormatCSV:
+			_, writeErr = writer.WriteString(format2Line(d))
+		case ExportFormatJSONLines:
+			writeErr = encoder.Encode(d)
+		case ExportFormatRanges:
+			//属性相同的bin需要合并后再写入
+			ranges = append(ranges, d)
+		}
+		return writeErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	for _, d := range CompressRanges(ranges) {
+		if _, err = writer.WriteString(format2Line(d)); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+//ExportCurrent 导出当前数据库中的数据
+func ExportCurrent(w io.Writer, format string, filter ExportFilter) error {
+	return Export(w, format, filter, currentBinDatabase.Scan)
+}
+
+//ScanRecords 按bin升序遍历已排序的数据
+func ScanRecords(records []mod.BinData) func(fn func(mod.BinData) bool) error {
+	return func(fn func(mod.BinData) bool) error {
+		for _, d := range records {
+			if !fn(d) {
+				break
+			}
+		}
+		return nil
+	}
+}
+
+func format2Line(d mod.BinData) string {
+	return format(d.IinStart, d) + "\n"
+}
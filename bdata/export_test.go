@@ -0,0 +1,85 @@
+package bdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestParseExportFilter(t *testing.T) {
+	cases := []struct {
+		countries, schemes string
+		want               ExportFilter
+	}{
+		{"", "", ExportFilter{}},
+		{"us, gb,", "", ExportFilter{Countries: []string{"US", "GB"}}},
+		{"", "VISA,Master Card", ExportFilter{Schemes: []string{"visa", "mastercard"}}},
+	}
+	for _, c := range cases {
+		if got := ParseExportFilter(c.countries, c.schemes); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q %q: %+v, want %+v", c.countries, c.schemes, got, c.want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	gb := testBinData(3, 400002, 400002, "TEST BANK")
+	gb.Country = "GB"
+	mc := testBinData(4, 510000, 510000, "OTHER BANK")
+	mc.Schema = "mastercard"
+	records := []mod.BinData{
+		testBinData(1, 400000, 400000, "TEST BANK"),
+		testBinData(2, 400001, 400001, "TEST BANK"),
+		gb,
+		mc,
+	}
+	cases := []struct {
+		name   string
+		format string
+		filter ExportFilter
+		lines  []string
+	}{
+		{"csv", ExportFormatCSV, ExportFilter{}, []string{binDataHeader,
+			"1,400000,400000,,,visa,,,,US,TEST BANK,,,,",
+			"2,400001,400001,,,visa,,,,US,TEST BANK,,,,",
+			"3,400002,400002,,,visa,,,,GB,TEST BANK,,,,",
+			"4,510000,510000,,,mastercard,,,,US,OTHER BANK,,,,"}},
+		{"ranges", ExportFormatRanges, ExportFilter{}, []string{binDataHeader,
+			"1,400000,400001,,,visa,,,,US,TEST BANK,,,,",
+			"3,400002,400002,,,visa,,,,GB,TEST BANK,,,,",
+			"4,510000,510000,,,mastercard,,,,US,OTHER BANK,,,,"}},
+		{"ranges filtered", ExportFormatRanges, ParseExportFilter("US", "visa"), []string{binDataHeader,
+			"1,400000,400001,,,visa,,,,US,TEST BANK,,,,"}},
+		{"csv filtered", ExportFormatCSV, ParseExportFilter("", "mastercard"), []string{binDataHeader,
+			"4,510000,510000,,,mastercard,,,,US,OTHER BANK,,,,"}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := Export(&buf, c.format, c.filter, ScanRecords(records)); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); !reflect.DeepEqual(got, c.lines) {
+			t.Errorf("%s:\n%s", c.name, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, ExportFormatJSONLines, ParseExportFilter("GB", ""), ScanRecords(records)); err != nil {
+		t.Fatal(err)
+	}
+	var d mod.BinData
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil || d.Id != 3 || d.Country != "GB" {
+		t.Errorf("jsonl %q: %+v %v", buf.String(), d, err)
+	}
+	if err := Export(&buf, "xml", ExportFilter{}, ScanRecords(records)); err == nil {
+		t.Error("exported unknown format")
+	}
+	if _, _, err := ExportContentType("xml"); err == nil {
+		t.Error("content type of unknown format")
+	}
+}
@@ -0,0 +1,213 @@
+package bdata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/file"
+)
+
+const (
+	//数据文件重新加载, key为相对数据目录的文件路径
+	ChangeTypeReload = "reload"
+	//订阅的序号已不在保留范围内, 需要全量同步
+	ChangeTypeReset = "reset"
+)
+
+var (
+	changeFeedFileName = "changes.log"
+	//内存及文件中至少保留的最近事件数, 超过2倍时截断
+	changeFeedCapacity = 10000
+)
+
+//ChangeEvent 数据变化事件
+//bin及映射变化的type与审计日志的action一致, key为bin或映射的key, data为变化后的数据, 替换已有确切数据时type为bin.update
+//数据文件被修改时发出reload事件, key为相对数据目录的文件路径, 没有data
+//订阅的序号已不在保留范围内时只返回一条reset事件, seq为当前最新的序号, 没有key及data
+type ChangeEvent struct {
+	Seq  int64           `json:"seq"`
+	Time time.Time       `json:"time"`
+	Type string          `json:"type"`
+	Key  string          `json:"key"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+//数据变化的事件流, 保留最近changeFeedCapacity条以上, 持久化到数据目录下的changes.log
+type changeFeed struct {
+	mutex    sync.Mutex
+	filepath string
+	file     *os.File
+	dataDir  string
+	seq      int64
+	events   []ChangeEvent
+	//有新事件时关闭并替换, 用于唤醒等待的订阅者
+	changed chan struct{}
+}
+
+var feed = &changeFeed{changed: make(chan struct{})}
+
+//打开数据目录下的事件文件, 超过保留数量时重写文件
+func openChangeFeed(dataDir string) error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	feed.dataDir = dataDir
+	feed.filepath = strings.Join([]string{dataDir, changeFeedFileName}, "/")
+
+	lines, err := feed.read()
+	if err != nil {
+		return err
+	}
+	if len(lines) > changeFeedCapacity {
+		if err = feed.rewrite(); err != nil {
+			return err
+		}
+	} else if feed.file, err = os.OpenFile(feed.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+
+	AddFileListener(func(event file.FileEvent) {
+		if IsBinDataFile(event.Filepath) {
+			key := strings.TrimPrefix(event.Filepath, strings.TrimRight(dataDir, "/")+"/")
+			publishChange(ChangeTypeReload, path.Clean(key), nil)
+		}
+	})
+	return nil
+}
+
+func (f *changeFeed) read() ([]string, error) {
+	file, err := os.Open(f.filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e ChangeEvent
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			logger.Warnf("忽略无法解析的事件, %s: %s", f.filepath, err)
+			continue
+		}
+		f.events = append(f.events, e)
+		f.seq = e.Seq
+		lines = append(lines, scanner.Text())
+	}
+	if len(f.events) > changeFeedCapacity {
+		f.events = f.events[len(f.events)-changeFeedCapacity:]
+	}
+	return lines, scanner.Err()
+}
+
+//按内存中保留的事件重写事件文件, 并重新打开
+func (f *changeFeed) rewrite() error {
+	lines := make([]string, 0, len(f.events))
+	for _, e := range f.events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(line))
+	}
+	tmp := f.filepath + ".tmp"
+	if err := writeLines(tmp, lines); err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	//替换失败时继续追加到原文件
+	renameErr := os.Rename(tmp, f.filepath)
+	var err error
+	if f.file, err = os.OpenFile(f.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+//发布事件, 写入事件文件失败时仍然通知订阅者
+func publishChange(eventType, key string, data interface{}) {
+	e := ChangeEvent{Time: time.Now().UTC(), Type: eventType, Key: key}
+	if data != nil {
+		var err error
+		if e.Data, err = json.Marshal(data); err != nil {
+			logger.Errorf("marshal change event error: %s, type: %s, key: %s", err, eventType, key)
+		}
+	}
+
+	feed.mutex.Lock()
+	feed.seq++
+	e.Seq = feed.seq
+	feed.events = append(feed.events, e)
+	if feed.file != nil {
+		if line, err := json.Marshal(e); err == nil {
+			if _, err = feed.file.Write(append(line, '\n')); err != nil {
+				logger.Errorf("写入事件文件失败: %s", err)
+			}
+		}
+	}
+	//超过2倍时截断, 同时重写事件文件, 避免文件一直增长
+	if len(feed.events) > 2*changeFeedCapacity {
+		feed.events = append([]ChangeEvent(nil), feed.events[len(feed.events)-changeFeedCapacity:]...)
+		if feed.file != nil {
+			if err := feed.rewrite(); err != nil {
+				logger.Errorf("重写事件文件失败: %s", err)
+			}
+		}
+	}
+	close(feed.changed)
+	feed.changed = make(chan struct{})
+	feed.mutex.Unlock()
+}
+
+//ChangesSince 序号大于since的事件, 最多limit条, 同时返回有新事件时会关闭的channel
+//since早于保留的最早事件时返回一条reset事件, 其序号为最新事件的序号
+func ChangesSince(since int64, limit int) ([]ChangeEvent, <-chan struct{}) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if since >= feed.seq {
+		return nil, feed.changed
+	}
+	if len(feed.events) == 0 || since < feed.events[0].Seq-1 {
+		return []ChangeEvent{{Seq: feed.seq, Time: time.Now().UTC(), Type: ChangeTypeReset}}, feed.changed
+	}
+	start := sort.Search(len(feed.events), func(i int) bool { return feed.events[i].Seq > since })
+	end := len(feed.events)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	return append([]ChangeEvent(nil), feed.events[start:end]...), feed.changed
+}
+
+//LatestChangeSeq 最新事件的序号
+func LatestChangeSeq() int64 {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	return feed.seq
+}
+
+func closeChangeFeed() error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if feed.file == nil {
+		return nil
+	}
+	err := feed.file.Close()
+	feed.file = nil
+	if err != nil {
+		return errors.New("关闭事件文件失败: " + err.Error())
+	}
+	return nil
+}
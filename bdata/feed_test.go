@@ -0,0 +1,102 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//使用新的事件流, 保留数量为capacity
+func useTestFeed(t *testing.T, capacity int) string {
+	t.Helper()
+	savedFeed, savedCapacity, savedListeners := feed, changeFeedCapacity, fileEventListenerList
+	t.Cleanup(func() {
+		closeChangeFeed()
+		feed, changeFeedCapacity, fileEventListenerList = savedFeed, savedCapacity, savedListeners
+	})
+	feed = &changeFeed{changed: make(chan struct{})}
+	changeFeedCapacity = capacity
+	dir := t.TempDir()
+	if err := openChangeFeed(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestChangesSince(t *testing.T) {
+	useTestFeed(t, 3)
+	for i := 1; i <= 5; i++ {
+		publishChange(AuditActionBinCreate, strconv.Itoa(400000+i), nil)
+	}
+	//未超过2倍时不截断
+	cases := []struct {
+		since int64
+		limit int
+		seqs  []int64
+		reset bool
+	}{
+		{5, 0, nil, false},
+		{3, 0, []int64{4, 5}, false},
+		{0, 0, []int64{1, 2, 3, 4, 5}, false},
+		{0, 2, []int64{1, 2}, false},
+	}
+	for _, c := range cases {
+		events, _ := ChangesSince(c.since, c.limit)
+		if len(events) != len(c.seqs) {
+			t.Fatalf("since %d: %+v, want %v", c.since, events, c.seqs)
+		}
+		for i, e := range events {
+			if e.Seq != c.seqs[i] || e.Type == ChangeTypeReset {
+				t.Errorf("since %d: event %d %+v", c.since, i, e)
+			}
+		}
+	}
+
+	_, changed := ChangesSince(5, 0)
+	publishChange(AuditActionBinCreate, "400006", nil)
+	publishChange(AuditActionBinCreate, "400007", nil)
+	select {
+	case <-changed:
+	default:
+		t.Error("subscriber not notified")
+	}
+	//截断后早于保留范围的订阅需全量同步
+	events, _ := ChangesSince(3, 0)
+	if len(events) != 1 || events[0].Type != ChangeTypeReset || events[0].Seq != 7 {
+		t.Errorf("since 3 after trim: %+v", events)
+	}
+	if events, _ = ChangesSince(4, 0); len(events) != 3 || events[0].Seq != 5 {
+		t.Errorf("since 4 after trim: %+v", events)
+	}
+}
+
+func TestChangeFeedRewrite(t *testing.T) {
+	dir := useTestFeed(t, 3)
+	for i := 1; i <= 7; i++ {
+		publishChange(AuditActionBinCreate, strconv.Itoa(400000+i), nil)
+	}
+	//截断时重写事件文件
+	content, err := os.ReadFile(filepath.Join(dir, changeFeedFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(content), "\n"); n != 3 {
+		t.Fatalf("%d lines after rewrite, want 3", n)
+	}
+	publishChange(AuditActionBinCreate, "400008", nil)
+
+	//重新打开时恢复序号, 只保留最近的3条
+	closeChangeFeed()
+	feed = &changeFeed{changed: make(chan struct{})}
+	if err = openChangeFeed(dir); err != nil {
+		t.Fatal(err)
+	}
+	if seq := LatestChangeSeq(); seq != 8 {
+		t.Errorf("seq %d after reopen, want 8", seq)
+	}
+	if events, _ := ChangesSince(5, 0); len(events) != 3 || events[0].Seq != 6 || events[2].Key != "400008" {
+		t.Errorf("events after reopen %+v", events)
+	}
+}
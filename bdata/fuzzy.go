@@ -0,0 +1,259 @@
+package bdata
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+var (
+	//公司类型等后缀, 比较时去掉, 多个单词的后缀按去掉空格后的形式, 如S.A.为SA
+	legalSuffixes = toSet("SA SAB SAU SPA SRL SL SAS LTD LIMITED INC INCORPORATED CORP CORPORATION CO COMPANY PLC AG GMBH NV BV AB AS ASA BHD BERHAD PJSC JSC OJSC OAO ZAO PAO TBK NA LLC LLP KG KK OYJ SE CJSC")
+	//名称前的冠词及公司类型
+	legalPrefixes = toSet("THE PT")
+	//模糊匹配的最低相似度
+	minBankNameScore = 0.75
+	bankNames        = &bankNameIndex{stale: true}
+)
+
+//现有银行名称的索引, 数据变化后标记为过期, 下次匹配时重建
+type bankNameIndex struct {
+	mutex sync.Mutex
+	stale bool
+	//fuzzyKey -> 规范名称
+	names map[string]mod.BankNameMatch
+}
+
+func toSet(values string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range strings.Fields(values) {
+		set[v] = true
+	}
+	return set
+}
+
+//数据文件, 映射文件或注册表变化时索引过期
+func bankNamesFileListener(event file.FileEvent) {
+	switch path.Ext(event.Filepath) {
+	case binDataFileExt, binDataApproximateFileExt:
+		invalidateBankNames()
+	default:
+		if _, _, ok := parseMappingFileName(path.Base(event.Filepath)); ok || path.Base(event.Filepath) == issuerRegistryFileName {
+			invalidateBankNames()
+		}
+	}
+}
+
+func invalidateBankNames() {
+	bankNames.mutex.Lock()
+	bankNames.stale = true
+	bankNames.mutex.Unlock()
+}
+
+//写入新数据或映射时只加入该名称, 规范化后已存在的名称不变
+func (idx *bankNameIndex) add(name string) {
+	key := fuzzyKey(name)
+	if key == "" {
+		return
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if idx.stale {
+		//下次匹配时重建
+		return
+	}
+	if _, ok := idx.names[key]; ok {
+		return
+	}
+	//snapshot返回的map可能正在被读取, 复制后再加入
+	names := make(map[string]mod.BankNameMatch, len(idx.names)+1)
+	for k, v := range idx.names {
+		names[k] = v
+	}
+	names[key] = mod.BankNameMatch{Name: name}
+	idx.names = names
+}
+
+//在issuerKey的基础上去掉公司类型等前后缀, 如"Banco Davivienda S.A."为"BANCO DAVIVIENDA"
+func fuzzyKey(name string) string {
+	tokens := strings.Fields(issuerKey(name))
+	for len(tokens) > 1 && legalPrefixes[tokens[0]] {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 1 {
+		stripped := false
+		//S A B, S P A等按字母拆开的后缀
+		for n := 3; n >= 1 && !stripped; n-- {
+			if len(tokens) > n && legalSuffixes[strings.Join(tokens[len(tokens)-n:], "")] {
+				tokens = tokens[:len(tokens)-n]
+				stripped = true
+			}
+		}
+		if !stripped {
+			break
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+//重建索引, 名称来自发卡行注册表, 确切数据及银行名称映射文件
+//规范化后相同的名称, 优先使用注册表中的名称, 其次为数据中出现次数最多的写法
+func (idx *bankNameIndex) rebuild() {
+	counts := make(map[string]int, 4096)
+	if currentBinDatabase != nil {
+		currentBinDatabase.Scan(func(d mod.BinData) bool {
+			if d.BankName != "" {
+				counts[d.BankName]++
+			}
+			return true
+		})
+	}
+	bankNameCnMapping.mutex.RLock()
+	for name := range bankNameCnMapping.dataMap {
+		if _, ok := counts[name]; !ok {
+			counts[name] = 0
+		}
+	}
+	bankNameCnMapping.mutex.RUnlock()
+
+	names := make(map[string]mod.BankNameMatch, len(counts))
+	best := make(map[string]int, len(counts))
+	for name, count := range counts {
+		key := fuzzyKey(name)
+		if key == "" {
+			continue
+		}
+		if c, ok := best[key]; !ok || count > c || (count == c && name < names[key].Name) {
+			names[key] = mod.BankNameMatch{Name: name}
+			best[key] = count
+		}
+	}
+	issuers.mutex.RLock()
+	for _, issuer := range issuers.byId {
+		match := mod.BankNameMatch{Name: issuer.Name, IssuerId: issuer.Id}
+		for _, alias := range append([]string{issuer.Name}, issuer.Aliases...) {
+			if key := fuzzyKey(alias); key != "" {
+				names[key] = match
+			}
+		}
+	}
+	issuers.mutex.RUnlock()
+	idx.names = names
+	idx.stale = false
+}
+
+func (idx *bankNameIndex) snapshot() map[string]mod.BankNameMatch {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if idx.stale {
+		idx.rebuild()
+	}
+	return idx.names
+}
+
+//MatchBankName 匹配现有的银行名称
+//规范化后与现有名称相同时返回该名称, 否则返回相似度不低于minBankNameScore的建议, 按相似度降序
+func MatchBankName(name string, limit int) (string, []mod.BankNameMatch) {
+	key := fuzzyKey(name)
+	if key == "" {
+		return "", nil
+	}
+	names := bankNames.snapshot()
+	if match, ok := names[key]; ok {
+		return match.Name, nil
+	}
+	return "", rankBankNames(names, key, limit, false)
+}
+
+//SearchBankName 容错的银行名称搜索, q可以是名称的一部分
+func SearchBankName(q string, limit int) []mod.BankNameMatch {
+	key := fuzzyKey(q)
+	if key == "" {
+		return nil
+	}
+	return rankBankNames(bankNames.snapshot(), key, limit, true)
+}
+
+func rankBankNames(names map[string]mod.BankNameMatch, key string, limit int, partial bool) []mod.BankNameMatch {
+	//同一个规范名称可能有多个key, 只保留相似度最高的
+	scores := make(map[mod.BankNameMatch]float64)
+	for k, match := range names {
+		score := similarity(key, k)
+		if partial {
+			if s := partialSimilarity(key, k); s > score {
+				score = s
+			}
+		}
+		if score >= minBankNameScore && score > scores[match] {
+			scores[match] = score
+		}
+	}
+	result := make([]mod.BankNameMatch, 0, len(scores))
+	for match, score := range scores {
+		match.Score = float64(int(score*1000)) / 1000
+		result = append(result, match)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Name < result[j].Name
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+//1 - 编辑距离 / 较长字符串的长度
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+//与name中连续的相同单词数的片段比较, 取最高的相似度, 用于只输入部分名称的搜索
+func partialSimilarity(q, name string) float64 {
+	qTokens, tokens := strings.Fields(q), strings.Fields(name)
+	if len(qTokens) >= len(tokens) {
+		return 0
+	}
+	best := 0.0
+	for i := 0; i+len(qTokens) <= len(tokens); i++ {
+		if s := similarity(q, strings.Join(tokens[i:i+len(qTokens)], " ")); s > best {
+			best = s
+		}
+	}
+	//部分匹配略低于整体相同
+	return best * 0.95
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,136 @@
+package bdata
+
+import (
+	"math"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestFuzzyKey(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"Banco Davivienda S.A.", "BANCO DAVIVIENDA"},
+		{"Banco Santander S.p.A.", "BANCO SANTANDER"},
+		{"The Bank of Nova Scotia", "BANK OF NOVA SCOTIA"},
+		{"PT Bank Mandiri (Persero) Tbk", "BANK MANDIRI PERSERO"},
+		{"ABC Co., Ltd.", "ABC"},
+		{"HSBC Bank plc", "HSBC BANK"},
+		{"Ltd", "LTD"},
+		{" - ", ""},
+	}
+	for _, c := range cases {
+		if got := fuzzyKey(c.name); got != c.want {
+			t.Errorf("fuzzyKey(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b    string
+		partial bool
+		want    float64
+	}{
+		{"", "", false, 1},
+		{"ABC", "ABC", false, 1},
+		{"ABC", "ABD", false, 2.0 / 3},
+		{"KITTEN", "SITTING", false, 4.0 / 7},
+		{"ABC", "", false, 0},
+		{"DAVIVIENDA", "BANCO DAVIVIENDA", true, 0.95},
+		{"DAVIVENDA", "BANCO DAVIVIENDA", true, 0.9 * 0.95},
+		{"BANCO DAVIVIENDA", "DAVIVIENDA", true, 0},
+	}
+	for _, c := range cases {
+		var got float64
+		if c.partial {
+			got = partialSimilarity(c.a, c.b)
+		} else {
+			got = similarity(c.a, c.b)
+		}
+		if math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q, partial %v) = %f, want %f", c.a, c.b, c.partial, got, c.want)
+		}
+	}
+}
+
+//使用新的银行名称索引
+func useTestBankNames(t *testing.T) {
+	t.Helper()
+	saved := bankNames
+	t.Cleanup(func() { bankNames = saved })
+	bankNames = &bankNameIndex{stale: true}
+}
+
+func TestMatchBankName(t *testing.T) {
+	m := useTestMemory(t)
+	useTestBankNames(t)
+	for i, name := range []string{"Banco Davivienda S.A.", "Banco Davivienda SA", "Banco Davivienda S.A.", "Bank of Nova Scotia"} {
+		bin := uint32(400000 + i)
+		m.dataMap[bin] = mod.BinData{Id: int64(i + 1), IinStart: bin, IinEnd: bin, BaseBinData: mod.BaseBinData{BankName: name}}
+	}
+
+	cases := []struct {
+		name        string
+		match       string
+		suggestions []string
+	}{
+		//规范化后相同, 返回出现次数最多的写法
+		{"BANCO DAVIVIENDA", "Banco Davivienda S.A.", nil},
+		{"Banco Davivenda", "", []string{"Banco Davivienda S.A."}},
+		{"Bank of Nova Scotia Ltd", "Bank of Nova Scotia", nil},
+		{"Totally Different", "", []string{}},
+		{"", "", nil},
+	}
+	for _, c := range cases {
+		match, suggestions := MatchBankName(c.name, 5)
+		if match != c.match {
+			t.Errorf("%q: match %q, want %q", c.name, match, c.match)
+		}
+		if len(suggestions) != len(c.suggestions) {
+			t.Errorf("%q: suggestions %+v, want %v", c.name, suggestions, c.suggestions)
+			continue
+		}
+		for i, s := range suggestions {
+			if s.Name != c.suggestions[i] || s.Score < minBankNameScore {
+				t.Errorf("%q: suggestion %+v, want %s", c.name, s, c.suggestions[i])
+			}
+		}
+	}
+
+	if result := SearchBankName("scotia", 5); len(result) != 1 || result[0].Name != "Bank of Nova Scotia" {
+		t.Errorf("search scotia: %+v", result)
+	}
+}
+
+func TestBankNameIndexAdd(t *testing.T) {
+	useTestMemory(t)
+	useTestBankNames(t)
+	if match, _ := MatchBankName("New Bank", 5); match != "" {
+		t.Fatalf("unexpected match %q", match)
+	}
+	before := bankNames.snapshot()
+
+	bindata := mod.BinData{Id: 1, IinStart: 400000, IinEnd: 400000, BaseBinData: mod.BaseBinData{BankName: "New Bank Ltd"}}
+	if _, err := saveBinData(mod.Actor{}, 400000, bindata, false); err != nil {
+		t.Fatal(err)
+	}
+	//只加入新的名称, 不重建索引
+	if bankNames.stale {
+		t.Error("index invalidated by feedback")
+	}
+	if match, _ := MatchBankName("New Bank", 5); match != "New Bank Ltd" {
+		t.Errorf("match %q, want New Bank Ltd", match)
+	}
+	if _, ok := before[fuzzyKey("New Bank")]; ok {
+		t.Error("snapshot modified in place")
+	}
+
+	//规范化后已存在的名称不替换
+	bankNames.add("NEW BANK")
+	if match, _ := MatchBankName("new bank", 5); match != "New Bank Ltd" {
+		t.Errorf("match %q after adding variant", match)
+	}
+}
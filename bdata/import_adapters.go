@@ -0,0 +1,225 @@
+package bdata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterImportAdapter("binlist", csvAdapter{defaultMapping: map[string]string{
+		"bin":        "iin_start",
+		"iin":        "iin_start",
+		"iin_start":  "iin_start",
+		"iin_end":    "iin_end",
+		"brand":      "scheme",
+		"scheme":     "scheme",
+		"type":       "type",
+		"category":   "brand",
+		"issuer":     "bank_name",
+		"bank":       "bank_name",
+		"bank_name":  "bank_name",
+		"alpha_2":    "country",
+		"country":    "country",
+		"prepaid":    "prepaid",
+		"bank_url":   "bank_url",
+		"bank_phone": "bank_phone",
+		"bank_city":  "bank_city",
+	}})
+	RegisterImportAdapter("jsonl", jsonLinesAdapter{defaultMapping: map[string]string{
+		"bin":            "iin_start",
+		"iin":            "iin_start",
+		"iin_start":      "iin_start",
+		"iin_end":        "iin_end",
+		"number.length":  "number_length",
+		"number.luhn":    "number_luhn",
+		"number_length":  "number_length",
+		"number_luhn":    "number_luhn",
+		"scheme":         "scheme",
+		"brand":          "brand",
+		"type":           "type",
+		"prepaid":        "prepaid",
+		"country.alpha2": "country",
+		"country":        "country",
+		"bank.name":      "bank_name",
+		"bank.url":       "bank_url",
+		"bank.phone":     "bank_phone",
+		"bank.city":      "bank_city",
+		"bank_name":      "bank_name",
+		"bank_url":       "bank_url",
+		"bank_phone":     "bank_phone",
+		"bank_city":      "bank_city",
+	}})
+	RegisterImportAdapter("fixed", fixedWidthAdapter{})
+}
+
+//合并默认映射与自定义映射, key统一为小写
+func mergeMapping(defaultMapping, mapping map[string]string) map[string]string {
+	result := make(map[string]string, len(defaultMapping)+len(mapping))
+	for k, v := range defaultMapping {
+		result[k] = v
+	}
+	for k, v := range mapping {
+		result[strings.ToLower(k)] = v
+	}
+	return result
+}
+
+//带header的csv, 如binlist-data的ranges.csv
+type csvAdapter struct {
+	defaultMapping map[string]string
+}
+
+func (a csvAdapter) Read(r io.Reader, opts ImportOptions) ([]ImportRecord, error) {
+	mapping := mergeMapping(a.defaultMapping, opts.Mapping)
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var (
+		header []string
+		err    error
+	)
+	if header, err = reader.Read(); err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(header))
+	for i, h := range header {
+		columns[i] = mapping[strings.ToLower(strings.TrimSpace(h))]
+	}
+
+	result := make([]ImportRecord, 0, 4096)
+	for line := 2; ; line++ {
+		var values []string
+		if values, err = reader.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", line, err))
+		}
+		record := ImportRecord{Line: line, Values: make(map[string]string, len(values))}
+		for i, v := range values {
+			//多列映射到同一列时, 使用第一个不为空的值
+			if i < len(columns) && columns[i] != "" && record.Values[columns[i]] == "" {
+				record.Values[columns[i]] = v
+			}
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+//每行一个json对象, 嵌套对象的字段以.连接, 如bank.name
+type jsonLinesAdapter struct {
+	defaultMapping map[string]string
+}
+
+func (a jsonLinesAdapter) Read(r io.Reader, opts ImportOptions) ([]ImportRecord, error) {
+	mapping := mergeMapping(a.defaultMapping, opts.Mapping)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	result := make([]ImportRecord, 0, 4096)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", line, err))
+		}
+		flat := make(map[string]string, len(object))
+		flatten("", object, flat)
+		record := ImportRecord{Line: line, Values: make(map[string]string, len(flat))}
+		for k, v := range flat {
+			if column, ok := mapping[strings.ToLower(k)]; ok {
+				record.Values[column] = v
+			}
+		}
+		result = append(result, record)
+	}
+	return result, scanner.Err()
+}
+
+func flatten(prefix string, object map[string]interface{}, result map[string]string) {
+	for k, v := range object {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flatten(key, value, result)
+		case string:
+			result[key] = value
+		case float64:
+			result[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			result[key] = strconv.FormatBool(value)
+		}
+	}
+}
+
+//FixedColumn 定宽格式的列定义, 从0开始, 不包含End
+type FixedColumn struct {
+	Column string
+	Start  int
+	End    int
+}
+
+//ParseFixedColumns 解析列定义, 如 iin_start:0-10,iin_end:10-20,scheme:20-30
+func ParseFixedColumns(spec string) ([]FixedColumn, error) {
+	var result []FixedColumn
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var column FixedColumn
+		nameAndRange := strings.SplitN(item, ":", 2)
+		if len(nameAndRange) != 2 {
+			return nil, errors.New(fmt.Sprintf("invalid column %s", item))
+		}
+		column.Column = nameAndRange[0]
+		if _, err := fmt.Sscanf(nameAndRange[1], "%d-%d", &column.Start, &column.End); err != nil || column.Start < 0 || column.End <= column.Start {
+			return nil, errors.New(fmt.Sprintf("invalid column %s", item))
+		}
+		result = append(result, column)
+	}
+	return result, nil
+}
+
+//定宽格式, 每行一条区间数据
+type fixedWidthAdapter struct{}
+
+func (a fixedWidthAdapter) Read(r io.Reader, opts ImportOptions) ([]ImportRecord, error) {
+	if len(opts.Columns) == 0 {
+		return nil, errors.New("定宽格式需要指定列定义")
+	}
+	scanner := bufio.NewScanner(r)
+	result := make([]ImportRecord, 0, 4096)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		record := ImportRecord{Line: line, Values: make(map[string]string, len(opts.Columns))}
+		for _, c := range opts.Columns {
+			if c.Start >= len(text) {
+				continue
+			}
+			end := c.End
+			if end > len(text) {
+				end = len(text)
+			}
+			record.Values[c.Column] = strings.TrimSpace(text[c.Start:end])
+		}
+		result = append(result, record)
+	}
+	return result, scanner.Err()
+}
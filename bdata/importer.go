@@ -0,0 +1,365 @@
+package bdata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//ImportRecord 适配器读取的一条供应商数据, Values的key为bin数据文件的列名
+type ImportRecord struct {
+	Line   int
+	Values map[string]string
+}
+
+//ImportAdapter 第三方数据格式适配器
+type ImportAdapter interface {
+	Read(r io.Reader, opts ImportOptions) ([]ImportRecord, error)
+}
+
+//ImportOptions 导入选项
+type ImportOptions struct {
+	//供应商列名 -> bin数据文件列名, 覆盖适配器的默认映射
+	Mapping map[string]string
+	//定宽格式的列定义
+	Columns []FixedColumn
+	//bin超过该长度时截取前缀, 0表示不截取, 截取后的bin需为6位或8位
+	BinLength int
+	//一个区间最多展开的bin数, 0表示使用DefaultImportMaxRange
+	MaxRange int
+}
+
+//ImportRejection 无法导入的数据
+type ImportRejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+//ImportChange 导入数据与现有数据的差异
+type ImportChange struct {
+	Bin    uint32       `json:"bin"`
+	Before *mod.BinData `json:"before,omitempty"`
+	After  mod.BinData  `json:"after"`
+	Fields []string     `json:"fields,omitempty"`
+}
+
+//ImportConflict 导入数据中同一个bin存在属性不同的多条数据, 保留第一条
+type ImportConflict struct {
+	Bin     uint32        `json:"bin"`
+	Records []mod.BinData `json:"records"`
+}
+
+//ImportReport 导入结果, dry-run时同样生成
+type ImportReport struct {
+	Total     int               `json:"total"`
+	Added     []ImportChange    `json:"added"`
+	Changed   []ImportChange    `json:"changed"`
+	Unchanged int               `json:"unchanged"`
+	Conflicts []ImportConflict  `json:"conflicts"`
+	Rejected  []ImportRejection `json:"rejected"`
+}
+
+//DefaultImportMaxRange 默认一个区间最多展开的bin数
+const DefaultImportMaxRange = 100000
+
+var importAdapters = make(map[string]ImportAdapter)
+
+//RegisterImportAdapter 注册数据格式适配器
+func RegisterImportAdapter(name string, adapter ImportAdapter) {
+	importAdapters[name] = adapter
+}
+
+//ImportAdapterNames 已注册的数据格式
+func ImportAdapterNames() []string {
+	names := make([]string, 0, len(importAdapters))
+	for name := range importAdapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//ReadImport 读取供应商数据并转换为bin数据, 区间数据会展开为单个bin
+func ReadImport(format string, r io.Reader, opts ImportOptions) ([]mod.BinData, []ImportRejection, error) {
+	adapter, ok := importAdapters[format]
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprintf("不支持的数据格式 %s, 可选: %s", format, strings.Join(ImportAdapterNames(), ",")))
+	}
+	var (
+		records []ImportRecord
+		err     error
+	)
+	if records, err = adapter.Read(r, opts); err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]mod.BinData, 0, len(records))
+	rejected := make([]ImportRejection, 0)
+	id := time.Now().UnixNano()
+	for _, record := range records {
+		var data []mod.BinData
+		if data, err = toBinData(record, opts); err != nil {
+			rejected = append(rejected, ImportRejection{Line: record.Line, Reason: err.Error()})
+			continue
+		}
+		for _, d := range data {
+			d.Id = id
+			result = append(result, d)
+		}
+		id++
+	}
+	return result, rejected, nil
+}
+
+//PlanImport 对比导入数据与现有数据, existing返回bin当前的确切数据
+//供应商未提供(为空)的字段沿用现有数据
+func PlanImport(records []mod.BinData, rejected []ImportRejection, existing func(bin uint32) (mod.BinData, bool)) ImportReport {
+	report := ImportReport{
+		Total:     len(records),
+		Added:     make([]ImportChange, 0),
+		Changed:   make([]ImportChange, 0),
+		Conflicts: make([]ImportConflict, 0),
+		Rejected:  rejected}
+
+	seen := make(map[uint32]int, len(records))
+	conflicts := make(map[uint32]int)
+	for i, d := range records {
+		bin := d.IinStart
+		if i, ok := seen[bin]; ok {
+			first := records[i]
+			if len(changedFields(first, d)) == 0 {
+				continue
+			}
+			if c, ok := conflicts[bin]; ok {
+				report.Conflicts[c].Records = append(report.Conflicts[c].Records, d)
+			} else {
+				conflicts[bin] = len(report.Conflicts)
+				report.Conflicts = append(report.Conflicts, ImportConflict{Bin: bin, Records: []mod.BinData{first, d}})
+			}
+			continue
+		}
+		seen[bin] = i
+
+		before, ok := existing(bin)
+		if !ok {
+			report.Added = append(report.Added, ImportChange{Bin: bin, After: d})
+			continue
+		}
+		fields := changedFields(before, d)
+		if len(fields) == 0 {
+			report.Unchanged++
+			continue
+		}
+		after := before
+		for _, column := range fields {
+			setColumn(&after, column, getColumn(d, column))
+		}
+		after.Id = d.Id
+		b := before
+		report.Changed = append(report.Changed, ImportChange{Bin: bin, Before: &b, After: after, Fields: fields})
+	}
+	return report
+}
+
+//供应商提供(不为空)且与现有数据不同的字段
+func changedFields(before, imported mod.BinData) []string {
+	var fields []string
+	for _, column := range attributeColumns {
+		value := getColumn(imported, column)
+		if value != "" && value != getColumn(before, column) {
+			fields = append(fields, column)
+		}
+	}
+	return fields
+}
+
+func toBinData(record ImportRecord, opts ImportOptions) ([]mod.BinData, error) {
+	var (
+		start, end uint32
+		err        error
+	)
+	iinStart := normalizeBin(record.Values["iin_start"], opts.BinLength)
+	if iinStart == "" {
+		return nil, errors.New("缺少iin_start")
+	}
+	//bin长度取自iin_start, 只支持6位或8位
+	if len(iinStart) != 6 && len(iinStart) != 8 {
+		return nil, errors.New(fmt.Sprintf("iin_start %s 长度为%d, 应为6位或8位, 可使用bin-length截取", iinStart, len(iinStart)))
+	}
+	if start, err = bin2Uint32(iinStart); err != nil {
+		return nil, err
+	}
+	end = start
+	if iinEnd := normalizeBin(record.Values["iin_end"], opts.BinLength); iinEnd != "" {
+		if len(iinEnd) != len(iinStart) {
+			return nil, errors.New(fmt.Sprintf("iin_end %s 与iin_start %s 长度不同", iinEnd, iinStart))
+		}
+		if end, err = bin2Uint32(iinEnd); err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, errors.New(fmt.Sprintf("iin_start %d 大于 iin_end %d", start, end))
+		}
+	}
+	maxRange := opts.MaxRange
+	if maxRange <= 0 {
+		maxRange = DefaultImportMaxRange
+	}
+	if int64(end)-int64(start)+1 > int64(maxRange) {
+		return nil, errors.New(fmt.Sprintf("区间[%d,%d]超过%d个bin", start, end, maxRange))
+	}
+
+	bindata := mod.BinData{NumberLength: -1}
+	for _, column := range attributeColumns {
+		if err = setColumn(&bindata, column, strings.TrimSpace(record.Values[column])); err != nil {
+			return nil, err
+		}
+	}
+	bindata.Schema = NormalizeScheme(bindata.Schema)
+	bindata.CardType = NormalizeCardType(bindata.CardType)
+	bindata.Prepaid = normalizeFlag(bindata.Prepaid, "")
+	bindata.NumberLuhn = normalizeFlag(bindata.NumberLuhn, "n")
+	if bindata.Country, err = NormalizeCountry(bindata.Country); err != nil {
+		return nil, err
+	}
+
+	result := make([]mod.BinData, 0, end-start+1)
+	for bin := start; ; bin++ {
+		d := bindata
+		d.IinStart = bin
+		d.IinEnd = bin
+		result = append(result, d)
+		if bin == end {
+			break
+		}
+	}
+	return result, nil
+}
+
+//去掉bin中的空格及分隔符, 超过binLength时截取前缀
+func normalizeBin(value string, binLength int) string {
+	bin := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '\t' {
+			return -1
+		}
+		return r
+	}, value)
+	if binLength > 0 && len(bin) > binLength {
+		bin = bin[:binLength]
+	}
+	return bin
+}
+
+var schemeAliases = map[string]string{
+	"mastercard":              "mastercard",
+	"master":                  "mastercard",
+	"mc":                      "mastercard",
+	"americanexpress":         "amex",
+	"amex":                    "amex",
+	"chinaunionpay":           "unionpay",
+	"unionpay":                "unionpay",
+	"cup":                     "unionpay",
+	"dinersclub":              "diners",
+	"dinersclubinternational": "diners",
+	"diners":                  "diners",
+	"discover":                "discover",
+	"visa":                    "visa",
+	"visaelectron":            "visa",
+	"jcb":                     "jcb",
+	"maestro":                 "maestro",
+	"mir":                     "mir",
+	"rupay":                   "rupay",
+	"elo":                     "elo",
+	"hipercard":               "hipercard",
+	"dankort":                 "dankort",
+	"uatp":                    "uatp",
+	"troy":                    "troy",
+}
+
+//NormalizeScheme 统一卡组织名称, 如"MASTER CARD" -> mastercard
+func NormalizeScheme(scheme string) string {
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(scheme))
+	if v, ok := schemeAliases[key]; ok {
+		return v
+	}
+	return strings.ToLower(strings.TrimSpace(scheme))
+}
+
+//NormalizeCardType 统一卡类型, 如"DEBIT" -> debit
+func NormalizeCardType(cardType string) string {
+	switch strings.ToLower(strings.TrimSpace(cardType)) {
+	case "d", "debit", "debit card":
+		return "debit"
+	case "c", "credit", "credit card":
+		return "credit"
+	case "charge", "charge card":
+		return "charge"
+	}
+	return strings.ToLower(strings.TrimSpace(cardType))
+}
+
+//NormalizeCountry 将alpha-2, alpha-3, numeric或英文名称统一为ISO 3166-1 alpha-2, 无法识别时返回error
+func NormalizeCountry(country string) (string, error) {
+	if strings.TrimSpace(country) == "" {
+		return "", nil
+	}
+	if c, ok := LookupCountry(country); ok {
+		return c.Alpha2, nil
+	}
+	return "", errors.New(fmt.Sprintf("无法识别的国家代码 %s", country))
+}
+
+//NormalizeNumberFields 校验number_length在12~19之间, number_luhn统一为y/n, 为空表示未知, 由卡组织规则决定
+func NormalizeNumberFields(bindata *mod.BinData) error {
+	if bindata.NumberLength > 0 && (bindata.NumberLength < 12 || bindata.NumberLength > 19) {
+		return errors.New(fmt.Sprintf("number_length %d 不在12~19之间", bindata.NumberLength))
+	}
+	if bindata.NumberLength <= 0 {
+		bindata.NumberLength = -1
+	}
+	if bindata.NumberLuhn = normalizeFlag(bindata.NumberLuhn, "n"); bindata.NumberLuhn != "" && bindata.NumberLuhn != "y" && bindata.NumberLuhn != "n" {
+		return errors.New(fmt.Sprintf("number_luhn取值未知: %s", bindata.NumberLuhn))
+	}
+	return nil
+}
+
+//true/yes/1 -> y, false/no/0 -> no
+func normalizeFlag(value, no string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "y", "yes", "true", "1":
+		return "y"
+	case "n", "no", "false", "0":
+		return no
+	}
+	return value
+}
+
+//Records 需要写入的数据, 按bin升序
+func (r ImportReport) Records(includeChanges bool) []mod.BinData {
+	result := make([]mod.BinData, 0, len(r.Added)+len(r.Changed))
+	for _, c := range r.Added {
+		result = append(result, c.After)
+	}
+	if includeChanges {
+		for _, c := range r.Changed {
+			result = append(result, c.After)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].IinStart < result[j].IinStart })
+	return result
+}
+
+//ImportFilePath 合并到数据目录时使用的文件, 按日期分区
+func ImportFilePath(dataDir string, now time.Time) string {
+	return strings.Join([]string{dataDir, now.Format(DatePatternCompact), fmt.Sprintf("import_%s%s", now.Format(DateTimePatternCompact), binDataFileExt)}, "/")
+}
@@ -0,0 +1,197 @@
+package bdata
+
+import (
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestReadImport(t *testing.T) {
+	columns, err := ParseFixedColumns("iin_start:0-6,iin_end:6-12,scheme:12-22,country:22-25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		format   string
+		input    string
+		opts     ImportOptions
+		bins     int
+		rejected int
+	}{
+		{"binlist", "binlist",
+			"iin_start,iin_end,brand,type,issuer,alpha_2\n400000,400002,VISA,DEBIT,TEST BANK,US\n5100 00,,Master Card,Credit,OTHER BANK,GB\n",
+			ImportOptions{}, 4, 0},
+		{"binlist mapping", "binlist",
+			"prefix,network,country\n400000,visa,US\n",
+			ImportOptions{Mapping: map[string]string{"Prefix": "iin_start", "network": "scheme"}}, 1, 0},
+		{"binlist rejected", "binlist",
+			"iin_start,iin_end,brand,alpha_2\n400009,400000,visa,US\n,,visa,US\n400000,,visa,XX\n",
+			ImportOptions{}, 0, 3},
+		{"bin length", "binlist",
+			"iin_start,brand\n40000012,visa\n",
+			ImportOptions{BinLength: 6}, 1, 0},
+		{"jsonl", "jsonl",
+			"{\"bin\":\"400000\",\"number\":{\"length\":16,\"luhn\":true},\"scheme\":\"visa\",\"bank\":{\"name\":\"TEST BANK\"}}\n\n{\"bin\":\"510000\",\"scheme\":\"mc\"}\n",
+			ImportOptions{}, 2, 0},
+		{"fixed", "fixed",
+			"400000400001visa      US \n510000      mastercardGB \n",
+			ImportOptions{Columns: columns}, 3, 0},
+		//未截取的卡号, 长度不同的区间
+		{"bin length rejected", "binlist",
+			"iin_start,iin_end,brand\n4000001234567890,,visa\n400000,40000099,visa\n40000,,visa\n",
+			ImportOptions{}, 0, 3},
+		{"max range", "binlist",
+			"iin_start,iin_end,brand\n400000,400009,visa\n400000,400010,visa\n",
+			ImportOptions{MaxRange: 10}, 10, 1},
+	}
+	for _, c := range cases {
+		records, rejected, err := ReadImport(c.format, strings.NewReader(c.input), c.opts)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(records) != c.bins || len(rejected) != c.rejected {
+			t.Errorf("%s: %d bins %d rejected %v, want %d %d", c.name, len(records), len(rejected), rejected, c.bins, c.rejected)
+		}
+	}
+
+	records, _, _ := ReadImport("binlist", strings.NewReader(cases[0].input), ImportOptions{})
+	last := records[3]
+	if last.IinStart != 510000 || last.Schema != "mastercard" || last.CardType != "credit" || last.Country != "GB" || last.BankName != "OTHER BANK" {
+		t.Errorf("normalized record %+v", last)
+	}
+	if records[0].Id != records[2].Id || records[0].Id == last.Id {
+		t.Error("bins expanded from one range should share the id")
+	}
+	records, _, _ = ReadImport("jsonl", strings.NewReader(cases[4].input), ImportOptions{})
+	if records[0].NumberLength != 16 || records[0].NumberLuhn != "y" || records[0].BankName != "TEST BANK" || records[1].Schema != "mastercard" {
+		t.Errorf("jsonl records %+v", records)
+	}
+
+	if _, _, err = ReadImport("xml", strings.NewReader(""), ImportOptions{}); err == nil {
+		t.Error("read unknown format")
+	}
+	if _, _, err = ReadImport("fixed", strings.NewReader("400000"), ImportOptions{}); err == nil {
+		t.Error("read fixed format without columns")
+	}
+	if _, _, err = ReadImport("jsonl", strings.NewReader("{bad"), ImportOptions{}); err == nil {
+		t.Error("read invalid json")
+	}
+}
+
+func TestParseFixedColumns(t *testing.T) {
+	cases := []struct {
+		spec  string
+		count int
+		err   bool
+	}{
+		{"iin_start:0-6", 1, false},
+		{"iin_start:0-6, scheme:6-16,", 2, false},
+		{"", 0, false},
+		{"iin_start", 0, true},
+		{"iin_start:6-6", 0, true},
+		{"iin_start:-1-6", 0, true},
+		{"iin_start:a-b", 0, true},
+	}
+	for _, c := range cases {
+		columns, err := ParseFixedColumns(c.spec)
+		if (err != nil) != c.err || len(columns) != c.count {
+			t.Errorf("%q: %v %v", c.spec, columns, err)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	schemes := map[string]string{"MASTER CARD": "mastercard", "MC": "mastercard", "American Express": "amex", "China UnionPay": "unionpay", "Visa Electron": "visa", " Private ": "private"}
+	for input, want := range schemes {
+		if got := NormalizeScheme(input); got != want {
+			t.Errorf("scheme %q: %q, want %q", input, got, want)
+		}
+	}
+	cardTypes := map[string]string{"DEBIT": "debit", "c": "credit", "Charge Card": "charge", "Prepaid": "prepaid"}
+	for input, want := range cardTypes {
+		if got := NormalizeCardType(input); got != want {
+			t.Errorf("type %q: %q, want %q", input, got, want)
+		}
+	}
+	flags := []struct {
+		value, no, want string
+	}{
+		{"yes", "", "y"}, {"TRUE", "n", "y"}, {"0", "", ""}, {"false", "n", "n"}, {"unknown", "", "unknown"},
+	}
+	for _, c := range flags {
+		if got := normalizeFlag(c.value, c.no); got != c.want {
+			t.Errorf("flag %q: %q, want %q", c.value, got, c.want)
+		}
+	}
+	bins := map[string]string{"4000 00": "400000", "4000-0012": "400000", "\t400000": "400000"}
+	for input, want := range bins {
+		if got := normalizeBin(input, 6); got != want {
+			t.Errorf("bin %q: %q, want %q", input, got, want)
+		}
+	}
+	if country, err := NormalizeCountry("XX"); err == nil {
+		t.Errorf("country XX: %q", country)
+	}
+	if country, err := NormalizeCountry(""); err != nil || country != "" {
+		t.Errorf("empty country: %q %v", country, err)
+	}
+
+	numbers := []struct {
+		length int8
+		luhn   string
+		want   int8
+		err    bool
+	}{
+		{16, "true", 16, false}, {0, "", -1, false}, {11, "y", 0, true}, {20, "y", 0, true}, {16, "maybe", 0, true},
+	}
+	for _, c := range numbers {
+		bindata := mod.BinData{NumberLength: c.length, NumberLuhn: c.luhn}
+		err := NormalizeNumberFields(&bindata)
+		if (err != nil) != c.err || (!c.err && bindata.NumberLength != c.want) {
+			t.Errorf("number %d %q: %+v %v", c.length, c.luhn, bindata, err)
+		}
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	existing := map[uint32]mod.BinData{
+		400000: testBinData(1, 400000, 400000, "TEST BANK"),
+		400001: testBinData(2, 400001, 400001, "TEST BANK"),
+	}
+	imported := []mod.BinData{
+		//与现有数据相同, 为空的字段沿用现有数据
+		{Id: 10, IinStart: 400000, IinEnd: 400000, BaseBinData: mod.BaseBinData{Schema: "visa"}},
+		{Id: 10, IinStart: 400001, IinEnd: 400001, BaseBinData: mod.BaseBinData{Schema: "visa", BankName: "NEW BANK"}},
+		{Id: 11, IinStart: 400002, IinEnd: 400002, BaseBinData: mod.BaseBinData{Schema: "visa"}},
+		//重复的相同数据忽略, 不同数据记为冲突
+		{Id: 12, IinStart: 400002, IinEnd: 400002, BaseBinData: mod.BaseBinData{Schema: "visa"}},
+		{Id: 13, IinStart: 400002, IinEnd: 400002, BaseBinData: mod.BaseBinData{Schema: "mastercard"}},
+		{Id: 14, IinStart: 400002, IinEnd: 400002, BaseBinData: mod.BaseBinData{Schema: "amex"}},
+	}
+	rejected := []ImportRejection{{Line: 9, Reason: "缺少iin_start"}}
+	report := PlanImport(imported, rejected, func(bin uint32) (mod.BinData, bool) {
+		d, ok := existing[bin]
+		return d, ok
+	})
+	if report.Total != 6 || report.Unchanged != 1 || len(report.Added) != 1 || len(report.Changed) != 1 || len(report.Rejected) != 1 {
+		t.Fatalf("report %+v", report)
+	}
+	changed := report.Changed[0]
+	if changed.Bin != 400001 || changed.Before.BankName != "TEST BANK" || changed.After.BankName != "NEW BANK" ||
+		changed.After.Country != "US" || changed.After.Id != 10 || len(changed.Fields) != 1 || changed.Fields[0] != "bank_name" {
+		t.Errorf("changed %+v", changed)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Bin != 400002 || len(report.Conflicts[0].Records) != 3 {
+		t.Errorf("conflicts %+v", report.Conflicts)
+	}
+
+	if records := report.Records(false); len(records) != 1 || records[0].IinStart != 400002 {
+		t.Errorf("records without changes %+v", records)
+	}
+	if records := report.Records(true); len(records) != 2 || records[0].IinStart != 400001 {
+		t.Errorf("records with changes %+v", records)
+	}
+}
@@ -0,0 +1,203 @@
+package bdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//数据目录下的发卡行注册表, 列为id,name,aliases,logo,url,phone,city, 多个别名以|分隔
+var issuerRegistryFileName = "issuers.csv"
+
+//发卡行注册表, 按id索引, 并可按名称及别名查找
+type issuerRegistry struct {
+	mutex sync.RWMutex
+	byId  map[string]mod.Issuer
+	//规范化后的名称 -> id
+	index map[string]string
+}
+
+var issuers = &issuerRegistry{byId: make(map[string]mod.Issuer), index: make(map[string]string)}
+
+//读取注册表, 文件不存在时清空
+func loadIssuerRegistry(filepath string) error {
+	var list []mod.Issuer
+	f, err := os.Open(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer f.Close()
+		if list, err = readIssuerRegistry(f); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s", filepath, err))
+		}
+	}
+	byId := make(map[string]mod.Issuer, len(list))
+	index := make(map[string]string, len(list)*2)
+	for _, issuer := range list {
+		if _, ok := byId[issuer.Id]; ok {
+			return errors.New(fmt.Sprintf("%s: 重复的id %s", filepath, issuer.Id))
+		}
+		byId[issuer.Id] = issuer
+		for _, name := range append([]string{issuer.Name}, issuer.Aliases...) {
+			key := issuerKey(name)
+			if id, ok := index[key]; ok && id != issuer.Id {
+				return errors.New(fmt.Sprintf("%s: %s 同时属于 %s 和 %s", filepath, name, id, issuer.Id))
+			}
+			index[key] = issuer.Id
+		}
+	}
+	issuers.mutex.Lock()
+	issuers.byId, issuers.index = byId, index
+	issuers.mutex.Unlock()
+	return nil
+}
+
+func readIssuerRegistry(r io.Reader) ([]mod.Issuer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	if !contains(header, "id") || !contains(header, "name") {
+		return nil, errors.New("缺少id或name列")
+	}
+	var result []mod.Issuer
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range values {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		if row["id"] == "" || row["name"] == "" {
+			return nil, errors.New(fmt.Sprintf("line %d: id和name不能为空", line))
+		}
+		issuer := mod.Issuer{Id: row["id"], Name: row["name"], Logo: row["logo"], Url: row["url"], Phone: row["phone"], City: row["city"]}
+		for _, alias := range strings.Split(row["aliases"], "|") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				issuer.Aliases = append(issuer.Aliases, alias)
+			}
+		}
+		result = append(result, issuer)
+	}
+	return result, nil
+}
+
+//名称比较时忽略大小写, 标点及多余的空白, 如"Banco Davivienda S.A."与"BANCO DAVIVIENDA S A"相同
+func issuerKey(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+//LookupIssuer 按id, 名称或别名查找发卡行
+func LookupIssuer(value string) (mod.Issuer, bool) {
+	issuers.mutex.RLock()
+	defer issuers.mutex.RUnlock()
+	if issuer, ok := issuers.byId[value]; ok {
+		return issuer, true
+	}
+	id, ok := issuers.index[issuerKey(value)]
+	if !ok {
+		return mod.Issuer{}, false
+	}
+	return issuers.byId[id], true
+}
+
+//NormalizeIssuer 将银行名称统一为注册表中的规范名称, 并使用注册表中的logo, url, phone, city
+//返回发卡行id, 不在注册表中时返回空字符串且不做修改
+func NormalizeIssuer(data *mod.BaseBinData) string {
+	if data.BankName == "" {
+		return ""
+	}
+	issuer, ok := LookupIssuer(data.BankName)
+	if !ok {
+		return ""
+	}
+	data.BankName = issuer.Name
+	if issuer.Logo != "" {
+		data.BankLogo = issuer.Logo
+	}
+	if issuer.Url != "" {
+		data.BankUrl = issuer.Url
+	}
+	if issuer.Phone != "" {
+		data.BankPhone = issuer.Phone
+	}
+	if issuer.City != "" {
+		data.BankCity = issuer.City
+	}
+	return issuer.Id
+}
+
+//Issuers 所有发卡行及其拥有的bin区间, 按id排序
+func Issuers() ([]mod.IssuerDetail, error) {
+	issuers.mutex.RLock()
+	details := make(map[string]*mod.IssuerDetail, len(issuers.byId))
+	for id, issuer := range issuers.byId {
+		details[id] = &mod.IssuerDetail{Issuer: issuer, Ranges: []mod.IssuerRange{}}
+	}
+	issuers.mutex.RUnlock()
+	if err := scanIssuerRanges(details); err != nil {
+		return nil, err
+	}
+	result := make([]mod.IssuerDetail, 0, len(details))
+	for _, d := range details {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result, nil
+}
+
+//IssuerDetailOf 发卡行及其拥有的bin区间
+func IssuerDetailOf(id string) (*mod.IssuerDetail, error) {
+	issuer, ok := LookupIssuer(id)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("issuer %s not found", id))
+	}
+	detail := &mod.IssuerDetail{Issuer: issuer, Ranges: []mod.IssuerRange{}}
+	if err := scanIssuerRanges(map[string]*mod.IssuerDetail{issuer.Id: detail}); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+//遍历确切数据, 将属于details中发卡行的连续bin合并为区间
+func scanIssuerRanges(details map[string]*mod.IssuerDetail) error {
+	return currentBinDatabase.Scan(func(d mod.BinData) bool {
+		base := d.BaseBinData
+		detail, ok := details[NormalizeIssuer(&base)]
+		if !ok {
+			return true
+		}
+		if n := len(detail.Ranges); n > 0 && detail.Ranges[n-1].IinEnd+1 == d.IinStart {
+			detail.Ranges[n-1].IinEnd = d.IinStart
+		} else {
+			detail.Ranges = append(detail.Ranges, mod.IssuerRange{IinStart: d.IinStart, IinEnd: d.IinStart})
+		}
+		return true
+	})
+}
@@ -0,0 +1,152 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//使用临时目录下的发卡行注册表
+func useTestIssuers(t *testing.T, content string) {
+	t.Helper()
+	issuers.mutex.RLock()
+	savedById, savedIndex := issuers.byId, issuers.index
+	issuers.mutex.RUnlock()
+	t.Cleanup(func() {
+		issuers.mutex.Lock()
+		issuers.byId, issuers.index = savedById, savedIndex
+		issuers.mutex.Unlock()
+	})
+	path := filepath.Join(t.TempDir(), issuerRegistryFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadIssuerRegistry(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testIssuerRegistry = "id,name,aliases,logo,url,phone,city\n" +
+	"davivienda,Banco Davivienda S.A.,DAVIVIENDA|BANCO DAVIVIENDA,,https://davivienda.com,,Bogota\n" +
+	"test,TEST BANK,,logo.png,,,\n"
+
+func TestIssuerKey(t *testing.T) {
+	cases := map[string]string{
+		"Banco Davivienda S.A.":  "BANCO DAVIVIENDA S A",
+		"BANCO  DAVIVIENDA S A ": "BANCO DAVIVIENDA S A",
+		"jp-morgan chase & co.":  "JP MORGAN CHASE CO",
+		"中国银行":                   "中国银行",
+		"":                       "",
+	}
+	for name, want := range cases {
+		if got := issuerKey(name); got != want {
+			t.Errorf("%q: %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReadIssuerRegistry(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		issuers int
+		err     bool
+	}{
+		{"empty", "", 0, false},
+		{"registry", testIssuerRegistry, 2, false},
+		{"missing name column", "id,aliases\nx,y\n", 0, true},
+		{"empty id", "id,name\n,TEST BANK\n", 0, true},
+	}
+	for _, c := range cases {
+		list, err := readIssuerRegistry(strings.NewReader(c.input))
+		if (err != nil) != c.err || len(list) != c.issuers {
+			t.Errorf("%s: %+v %v", c.name, list, err)
+		}
+	}
+	list, _ := readIssuerRegistry(strings.NewReader(testIssuerRegistry))
+	if !reflect.DeepEqual(list[0].Aliases, []string{"DAVIVIENDA", "BANCO DAVIVIENDA"}) || list[0].City != "Bogota" {
+		t.Errorf("issuer %+v", list[0])
+	}
+}
+
+func TestLoadIssuerRegistry(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{"duplicate id", "id,name\na,BANK A\na,BANK B\n", true},
+		{"alias of another issuer", "id,name,aliases\na,BANK A,\nb,BANK B,bank a\n", true},
+		{"alias of itself", "id,name,aliases\na,BANK A,Bank A.\n", false},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), issuerRegistryFileName)
+		os.WriteFile(path, []byte(c.content), 0644)
+		if err := loadIssuerRegistry(path); (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.name, err)
+		}
+	}
+}
+
+func TestNormalizeIssuer(t *testing.T) {
+	useTestIssuers(t, testIssuerRegistry)
+	cases := []struct {
+		bankName string
+		id       string
+		want     mod.BaseBinData
+	}{
+		{"banco davivienda s.a", "davivienda", mod.BaseBinData{BankName: "Banco Davivienda S.A.", BankUrl: "https://davivienda.com", BankCity: "Bogota"}},
+		{"DAVIVIENDA", "davivienda", mod.BaseBinData{BankName: "Banco Davivienda S.A.", BankUrl: "https://davivienda.com", BankCity: "Bogota"}},
+		{"test bank", "test", mod.BaseBinData{BankName: "TEST BANK", BankLogo: "logo.png", BankUrl: "http://original"}},
+		{"OTHER BANK", "", mod.BaseBinData{BankName: "OTHER BANK", BankUrl: "http://original"}},
+		{"", "", mod.BaseBinData{BankUrl: "http://original"}},
+	}
+	for _, c := range cases {
+		data := mod.BaseBinData{BankName: c.bankName, BankUrl: "http://original"}
+		id := NormalizeIssuer(&data)
+		if id != c.id || data != c.want {
+			t.Errorf("%q: %s %+v", c.bankName, id, data)
+		}
+	}
+	if issuer, ok := LookupIssuer("davivienda"); !ok || issuer.Name != "Banco Davivienda S.A." {
+		t.Errorf("lookup by id %+v %v", issuer, ok)
+	}
+}
+
+func TestIssuers(t *testing.T) {
+	useTestIssuers(t, testIssuerRegistry)
+	m := useTestMemory(t)
+	for i, row := range []string{
+		"1,400000,400002,,,visa,,credit,,CO,DAVIVIENDA,,,,",
+		"2,400005,,,,visa,,credit,,CO,Banco Davivienda S.A.,,,,",
+		"3,400006,,,,visa,,credit,,US,OTHER BANK,,,,",
+	} {
+		data, err := parse(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.saveParsed("/data/ranges.bd", i+2, data, false)
+	}
+
+	list, err := Issuers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Id != "davivienda" || list[1].Id != "test" || len(list[1].Ranges) != 0 {
+		t.Fatalf("issuers %+v", list)
+	}
+	want := []mod.IssuerRange{{IinStart: 400000, IinEnd: 400002}, {IinStart: 400005, IinEnd: 400005}}
+	if !reflect.DeepEqual(list[0].Ranges, want) {
+		t.Errorf("ranges %+v", list[0].Ranges)
+	}
+	if detail, err := IssuerDetailOf("DAVIVIENDA"); err != nil || !reflect.DeepEqual(detail.Ranges, want) {
+		t.Errorf("detail %+v %v", detail, err)
+	}
+	if _, err = IssuerDetailOf("missing"); err == nil {
+		t.Error("found missing issuer")
+	}
+}
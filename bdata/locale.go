@@ -0,0 +1,193 @@
+package bdata
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+const (
+	mappingKindBankName = "bank_name"
+	mappingKindCountry  = "country"
+	//feedback写入及v1接口bank_name_cn, country_cn使用的语言
+	defaultMappingLocale = "cn"
+)
+
+var (
+	//映射文件变化时通知加载
+	mappingReloading = make(chan file.FileEvent)
+	localeMappings   = &mappingRegistry{files: make(map[string]map[string]*mappingFile)}
+	//历史上中文映射文件使用cn作为后缀
+	localeAliases = map[string]string{"zh": defaultMappingLocale, "zh-cn": defaultMappingLocale, "zh-hans": defaultMappingLocale}
+)
+
+//所有语言的映射文件, 按类型及语言索引, 对应数据目录下的<type>_<locale>.csv
+type mappingRegistry struct {
+	mutex sync.RWMutex
+	files map[string]map[string]*mappingFile
+}
+
+//获取映射文件, 不存在时创建
+func (r *mappingRegistry) get(kind, locale string) *mappingFile {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	locales, ok := r.files[kind]
+	if !ok {
+		locales = make(map[string]*mappingFile)
+		r.files[kind] = locales
+	}
+	mpf, ok := locales[locale]
+	if !ok {
+		mpf = &mappingFile{dataMap: make(map[string]string)}
+		locales[locale] = mpf
+	}
+	return mpf
+}
+
+func (r *mappingRegistry) lookup(kind, locale string) (*mappingFile, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	mpf, ok := r.files[kind][locale]
+	return mpf, ok
+}
+
+//解析映射文件名, 如bank_name_ja.csv返回bank_name, ja
+func parseMappingFileName(filename string) (string, string, bool) {
+	if !strings.HasSuffix(filename, ".csv") {
+		return "", "", false
+	}
+	name := strings.TrimSuffix(filename, ".csv")
+	for _, kind := range []string{mappingKindBankName, mappingKindCountry} {
+		if strings.HasPrefix(name, kind+"_") {
+			locale := normalizeLocale(name[len(kind)+1:])
+			return kind, locale, locale != ""
+		}
+	}
+	return "", "", false
+}
+
+//语言标签统一为小写, 以-分隔, 如zh_CN为zh-cn
+func normalizeLocale(tag string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(tag), "_", "-", -1))
+}
+
+//Locales 已加载映射文件的语言
+func Locales() []string {
+	localeMappings.mutex.RLock()
+	defer localeMappings.mutex.RUnlock()
+	set := make(map[string]bool)
+	for _, locales := range localeMappings.files {
+		for locale, mpf := range locales {
+			mpf.mutex.RLock()
+			if len(mpf.dataMap) > 0 {
+				set[locale] = true
+			}
+			mpf.mutex.RUnlock()
+		}
+	}
+	result := make([]string, 0, len(set))
+	for locale := range set {
+		result = append(result, locale)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//ParseAcceptLanguage 按q值降序返回Accept-Language中的语言, 忽略*及q=0
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, t.tag)
+	}
+	return result
+}
+
+//LocaleChain 查找本地化名称的语言顺序, lang(逗号分隔)优先于Accept-Language
+//每个语言依次回退到更短的标签及别名, 如zh-Hant-TW, zh-hant, zh, cn
+func LocaleChain(lang, acceptLanguage string) []string {
+	var tags []string
+	if lang != "" {
+		tags = strings.Split(lang, ",")
+	} else {
+		tags = ParseAcceptLanguage(acceptLanguage)
+	}
+	var result []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			result = append(result, locale)
+		}
+	}
+	for _, tag := range tags {
+		parts := strings.Split(normalizeLocale(tag), "-")
+		for i := len(parts); i > 0; i-- {
+			locale := strings.Join(parts[:i], "-")
+			add(locale)
+			add(localeAliases[locale])
+		}
+	}
+	return result
+}
+
+//按语言顺序查找本地化名称, 返回名称及所用的语言
+func localizedName(kind, key string, chain []string) (string, string, bool) {
+	for _, locale := range chain {
+		if mpf, ok := localeMappings.lookup(kind, locale); ok {
+			if name, ok := mpf.get(key); ok {
+				return name, locale, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+//Localize 填充本地化名称, 没有对应映射时使用原始的英文名称
+//Locale为第一个有映射的语言
+func Localize(data *mod.SimpleBinData, chain []string) {
+	if len(chain) == 0 {
+		return
+	}
+	data.Localized = make(map[string]string, 2)
+	for _, field := range []struct {
+		kind  string
+		value string
+	}{{mappingKindBankName, data.BankName}, {mappingKindCountry, data.Country}} {
+		name, locale, ok := localizedName(field.kind, field.value, chain)
+		if !ok {
+			name = field.value
+		} else if data.Locale == "" {
+			data.Locale = locale
+		}
+		data.Localized[field.kind] = name
+	}
+}
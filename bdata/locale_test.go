@@ -0,0 +1,104 @@
+package bdata
+
+import (
+	"reflect"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	cases := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"ja", []string{"ja"}},
+		{"fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", []string{"fr-CH", "fr", "en", "de"}},
+		{"en;q=0.5, ja", []string{"ja", "en"}},
+		//q值相同时保持原顺序
+		{"de;q=0.8, fr;q=0.8", []string{"de", "fr"}},
+		{"ja;q=0, en", []string{"en"}},
+		{"ja;q=abc, , en;q=0.1", []string{"ja", "en"}},
+	}
+	for _, c := range cases {
+		if got := ParseAcceptLanguage(c.header); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: %v, want %v", c.header, got, c.want)
+		}
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	cases := []struct {
+		lang           string
+		acceptLanguage string
+		want           []string
+	}{
+		{"", "", nil},
+		{"ja", "en", []string{"ja"}},
+		{"", "ja, en;q=0.5", []string{"ja", "en"}},
+		{"zh-Hant-TW", "", []string{"zh-hant-tw", "zh-hant", "zh", "cn"}},
+		{"zh_CN", "", []string{"zh-cn", "cn", "zh"}},
+		{"cn,zh", "", []string{"cn", "zh"}},
+		{" pt-BR ,pt", "", []string{"pt-br", "pt"}},
+	}
+	for _, c := range cases {
+		if got := LocaleChain(c.lang, c.acceptLanguage); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q %q: %v, want %v", c.lang, c.acceptLanguage, got, c.want)
+		}
+	}
+}
+
+func TestParseMappingFileName(t *testing.T) {
+	cases := []struct {
+		filename string
+		kind     string
+		locale   string
+		ok       bool
+	}{
+		{"bank_name_ja.csv", mappingKindBankName, "ja", true},
+		{"bank_name_zh_TW.csv", mappingKindBankName, "zh-tw", true},
+		{"country_cn.csv", mappingKindCountry, "cn", true},
+		{"country_.csv", "", "", false},
+		{"bank_name_ja.txt", "", "", false},
+		{"issuer_ja.csv", "", "", false},
+	}
+	for _, c := range cases {
+		kind, locale, ok := parseMappingFileName(c.filename)
+		if ok != c.ok || (ok && (kind != c.kind || locale != c.locale)) {
+			t.Errorf("%s: %s %s %v", c.filename, kind, locale, ok)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	saved := localeMappings
+	t.Cleanup(func() { localeMappings = saved })
+	localeMappings = &mappingRegistry{files: make(map[string]map[string]*mappingFile)}
+	localeMappings.get(mappingKindBankName, "ja").set("TEST BANK", "テスト銀行", 0)
+	localeMappings.get(mappingKindBankName, "cn").set("TEST BANK", "测试银行", 0)
+	localeMappings.get(mappingKindCountry, "cn").set("US", "美国", 0)
+	//空映射文件不计入已加载的语言
+	localeMappings.get(mappingKindCountry, "fr")
+
+	if locales := Locales(); !reflect.DeepEqual(locales, []string{"cn", "ja"}) {
+		t.Errorf("locales %v", locales)
+	}
+	cases := []struct {
+		chain     []string
+		locale    string
+		localized map[string]string
+	}{
+		{nil, "", nil},
+		{[]string{"ja", "cn"}, "ja", map[string]string{"bank_name": "テスト銀行", "country": "美国"}},
+		{[]string{"zh-cn", "cn"}, "cn", map[string]string{"bank_name": "测试银行", "country": "美国"}},
+		{[]string{"de"}, "", map[string]string{"bank_name": "TEST BANK", "country": "US"}},
+	}
+	for _, c := range cases {
+		data := mod.SimpleBinData{BankName: "TEST BANK", Country: "US"}
+		Localize(&data, c.chain)
+		if data.Locale != c.locale || !reflect.DeepEqual(data.Localized, c.localized) {
+			t.Errorf("%v: locale %q localized %v", c.chain, data.Locale, data.Localized)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package bdata
 
 import (
 	"bytes"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"kidshelloworld.com/bindb/file"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"path"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,80 +29,135 @@ var (
 	binDataApproximateFileName = fmt.Sprintf("approximate%s", binDataApproximateFileExt)
 	binDataFileName            = fmt.Sprintf("bindata%s", binDataFileExt)
 	binDataHeader              = "id,iin_start,iin_end,number_length,number_luhn,scheme,brand,type,prepaid,country,bank_name,bank_logo,bank_url,bank_phone,bank_city"
-	binDataMappingFile         = binDataFileHandler{bytesMap: make(map[string]int64), reloading: make(chan file.FileEvent)}
+	lineBreakReplacer          = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+	binDataMappingFile         = binDataFileHandler{bytesMap: make(map[string]int64), linesMap: make(map[string]int), reloading: make(chan file.FileEvent)}
 )
 
 type binDataFileHandler struct {
 	bytesMap  map[string]int64
+	//已读取的数据行数, 不包含header, 用于增量读取时计算行号
+	linesMap  map[string]int
 	reloading chan file.FileEvent
 }
 
 type memoryDatabase struct {
-	dataMap        map[uint32]mod.BinData
+	mutex   sync.RWMutex
+	dataMap map[uint32]mod.BinData
+	//确切数据的来源信息, 重叠时按策略决定保留哪条
+	metaMap        map[uint32]recordMeta
 	approximateMap map[uint32]map[int64]mod.BinData
-	dataDir        string
+	//有多个版本的bin的所有版本
+	history map[uint32][]mod.BinVersion
+	dataDir string
+	wal     *writeAheadLog
+	//开启校验时加载及重新加载数据文件共用, 可以发现与已加载数据的id重复及区间重叠
+	validator *Validator
 }
 
 func NewMemoryDatabase() BinDatabase {
 	memoryCreateOnce.Do(func() {
-		memory = &memoryDatabase{dataMap: make(map[uint32]mod.BinData), approximateMap: make(map[uint32]map[int64]mod.BinData)}
+		memory = newMemoryDatabase()
 	})
 	return memory
 }
 
+func newMemoryDatabase() *memoryDatabase {
+	return &memoryDatabase{dataMap: make(map[uint32]mod.BinData), metaMap: make(map[uint32]recordMeta), approximateMap: make(map[uint32]map[int64]mod.BinData), history: make(map[uint32][]mod.BinVersion)}
+}
+
 func (m *memoryDatabase) Init(cfg BinDataConfig) error {
+	if err := m.load(cfg); err != nil {
+		return err
+	}
+
+	memory.dataDir = cfg.DataDir
+	if cfg.DataDir != "" {
+		if err := m.openWal(cfg); err != nil {
+			logger.Errorf("open write-ahead log error: %s", err)
+			return errors.New("初始化内存数据库失败")
+		}
+	}
+	go registerBinDataRefresher()
+	AddFileListener(func(event file.FileEvent) {
+		ext := path.Ext(event.Filepath)
+		if binDataFileExt == ext || binDataApproximateFileExt == ext {
+			binDataMappingFile.reloading <- event
+		}
+	})
+	return nil
+}
+
+//加载目录下所有的bin数据文件, 不监听文件变化
+func (m *memoryDatabase) load(cfg BinDataConfig) error {
 	var (
 		filepaths []string
 		err       error
 	)
-	if filepaths, err = file.SearchDir(cfg.DataDir, func(filepath string) bool {
-		ext := path.Ext(filepath)
-		return binDataFileExt == ext || binDataApproximateFileExt == ext
-	}); err != nil {
+	if filepaths, err = searchBinDataFiles(cfg.DataDir); err != nil {
 		logger.Errorf("memory database init failed, error: %s, dataDir: %s", err, cfg.DataDir)
 	}
+	if cfg.Validate || cfg.Strict {
+		m.validator = NewValidator()
+	}
+	validator := m.validator
 
-	var (
-		filedata []string
-		filesize int64
-	)
 	initFailure := errors.New("初始化内存数据库失败")
 	for _, filepath := range filepaths {
-		if filedata, filesize, err = read(filepath, 0); err != nil {
-			logger.Errorf("读取文件失败, error: %s, filepath: %s", err, filepath)
+		var (
+			lines    int
+			filesize int64
+		)
+		if lines, filesize, err = m.loadFile(filepath, validator, cfg.Strict); err != nil {
 			return initFailure
 		}
+		binDataMappingFile.bytesMap[filepath] = filesize
+		binDataMappingFile.linesMap[filepath] = lines
+	}
+	if validator != nil {
+		logDiagnostics(validator.Finish())
+	}
+	return nil
+}
+
+//加载单个bin数据文件, 返回数据行数及文件大小
+//validator不为空时校验每一行数据, strict为true时跳过存在error级别问题的数据行
+func (m *memoryDatabase) loadFile(filepath string, validator *Validator, strict bool) (int, int64, error) {
+	var (
+		filedata []string
+		filesize int64
+		header   string
+		err      error
+	)
+	if filedata, filesize, err = read(filepath, 0); err != nil {
+		logger.Errorf("读取文件失败, error: %s, filepath: %s", err, filepath)
+		return 0, 0, err
+	}
 
-		ext := path.Ext(filepath)
-		approximate := false
-		if ext == binDataApproximateFileExt {
-			approximate = true
+	approximate := IsApproximateFile(filepath)
+	if validator != nil {
+		if header, err = readHeader(filepath); err != nil {
+			return 0, 0, err
 		}
-		for _, value := range filedata {
-			var data []mod.BinData
-			if data, err = parse(value); err != nil {
-				logger.Errorf("parse bin data error: %s, data: %s", err, value)
-			}
-			for _, d := range data {
-				m.save2Memory(d.IinStart, d, approximate)
-			}
+		validator.ValidateHeader(filepath, header)
+	}
+	for i, value := range filedata {
+		//第一行为header
+		if validator != nil && validator.ValidateLine(filepath, i+2, value, approximate) && strict {
+			continue
 		}
-		if size, ok := binDataMappingFile.bytesMap[filepath]; ok {
-			binDataMappingFile.bytesMap[filepath] = size + filesize
-		} else {
-			binDataMappingFile.bytesMap[filepath] = filesize
+		var data []mod.BinData
+		if data, err = parse(value); err != nil {
+			logger.Errorf("parse bin data error: %s, data: %s", err, value)
 		}
+		m.saveParsed(filepath, i+2, data, approximate)
 	}
+	return len(filedata), filesize, nil
+}
 
-	memory.dataDir = cfg.DataDir
-	go registerBinDataRefresher()
-	AddFileListener(func(event file.FileEvent) {
-		ext := path.Ext(event.Filepath)
-		if binDataFileExt == ext || binDataApproximateFileExt == ext {
-			binDataMappingFile.reloading <- event
-		}
+func searchBinDataFiles(dataDir string) ([]string, error) {
+	return file.SearchDir(dataDir, func(filepath string) bool {
+		return IsBinDataFile(filepath)
 	})
-	return nil
 }
 
 func registerBinDataRefresher() {
@@ -121,43 +178,110 @@ func registerBinDataRefresher() {
 }
 
 func (m *memoryDatabase) ReadExact(bin uint32) (mod.BinData, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	if result, ok := m.dataMap[bin]; ok {
 		return result, nil
 	}
-	return NullBinData, errors.New(fmt.Sprintf("%d not found", bin))
+	return NullBinData, notFound(bin)
+}
+
+//bin当前确切数据的来源信息
+func (m *memoryDatabase) exactMeta(bin uint32) (recordMeta, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	meta, ok := m.metaMap[bin]
+	return meta, ok
 }
 
 func (m *memoryDatabase) ReadApproximate(bin uint32) ([]mod.BinData, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	if value, ok := m.approximateMap[bin]; ok {
-		result := make([]mod.BinData, len(value))
-		for _, v := range result {
+		result := make([]mod.BinData, 0, len(value))
+		for _, v := range value {
 			result = append(result, v)
 		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
 		return result, nil
 	}
-	return nil, errors.New(fmt.Sprintf("%d not found", bin))
+	return nil, notFound(bin)
 }
 
+func (m *memoryDatabase) Scan(fn func(bindata mod.BinData) bool) error {
+	//复制后再遍历, 避免fn执行期间持有锁
+	m.mutex.RLock()
+	records := make([]mod.BinData, 0, len(m.dataMap))
+	for _, d := range m.dataMap {
+		records = append(records, d)
+	}
+	m.mutex.RUnlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].IinStart < records[j].IinStart })
+	for _, d := range records {
+		if !fn(d) {
+			break
+		}
+	}
+	return nil
+}
+
+//先写入write-ahead log并fsync, 成功后再更新内存, 由定时压缩写入按日期分区的数据文件
 func (m *memoryDatabase) Save(bin uint32, bindata mod.BinData, approximate bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	if _, ok := m.dataMap[bin]; ok && approximate {
 		return nil
 	}
-	m.save2Memory(bin, bindata, approximate)
 	if m.dataDir == "" {
 		return errors.New("存储地址未配置")
 	}
 
-	date := time.Now().Format(DatePatternCompact)
-	var filepath string
+	now := time.Now()
+	return m.persist(bin, bindata, approximate, newRecordMeta(bindata, m.dataFilePath(now, approximate), 0, bin, bin, now))
+}
+
+//Replace 替换bin已有的确切数据, 保存前按重叠策略判断, 已有数据优先时不写入, 只记录冲突并返回false
+func (m *memoryDatabase) Replace(bin uint32, bindata mod.BinData) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.dataDir == "" {
+		return false, errors.New("存储地址未配置")
+	}
+	now := time.Now()
+	meta := newRecordMeta(bindata, m.dataFilePath(now, false), 0, bin, bin, now)
+	if existing, ok := m.metaMap[bin]; ok && existing.id != meta.id && !preferOverlap(existing, meta) {
+		recordOverlap(bin, existing, meta)
+		return false, nil
+	}
+	return true, m.persist(bin, bindata, false, meta)
+}
+
+//写入预写日志或数据文件后更新内存, 调用方持有锁
+func (m *memoryDatabase) persist(bin uint32, bindata mod.BinData, approximate bool, meta recordMeta) error {
+	if m.wal != nil {
+		if _, err := m.wal.append(walEntry{Time: meta.validFrom, Bin: bin, Approximate: approximate, Data: bindata}); err != nil {
+			logger.Errorf("write-ahead log error: %s", err)
+			return errors.New("保存bindata失败")
+		}
+	} else if err := write2File(bin, meta.source, bindata); err != nil {
+		return err
+	}
+	m.addVersion(bin, bindata, approximate, meta)
+	m.save2Memory(bin, bindata, approximate, meta)
+	return nil
+}
+
+//按日期分区的数据文件
+func (m *memoryDatabase) dataFilePath(t time.Time, approximate bool) string {
+	date := t.Format(DatePatternCompact)
 	if approximate {
-		filepath = strings.Join([]string{m.dataDir, date, binDataApproximateFileName}, "/")
-	} else {
-		filepath = strings.Join([]string{m.dataDir, date, binDataFileName}, "/")
+		return strings.Join([]string{m.dataDir, date, binDataApproximateFileName}, "/")
 	}
-	return write2File(bin, filepath, bindata)
+	return strings.Join([]string{m.dataDir, date, binDataFileName}, "/")
 }
 
-func (m *memoryDatabase) save2Memory(bin uint32, bindata mod.BinData, approximate bool) {
+//确切数据已存在且id不同时, 按重叠策略决定是否替换, 并记录冲突
+func (m *memoryDatabase) save2Memory(bin uint32, bindata mod.BinData, approximate bool, meta recordMeta) {
 	if approximate {
 		var (
 			valueMap map[int64]mod.BinData
@@ -165,24 +289,39 @@ func (m *memoryDatabase) save2Memory(bin uint32, bindata mod.BinData, approximat
 		)
 		if valueMap, ok = m.approximateMap[bin]; !ok {
 			valueMap = make(map[int64]mod.BinData, 10)
-		} else {
-			if _, ok = valueMap[bindata.Id]; !ok {
-				valueMap[bindata.Id] = bindata
-			}
+		}
+		if _, ok = valueMap[bindata.Id]; !ok {
+			bindata.Provenance = meta.provenance()
+			valueMap[bindata.Id] = bindata
 		}
 		m.approximateMap[bin] = valueMap
 	} else {
-		if _, ok := m.dataMap[bin]; !ok {
+		bindata.Provenance = meta.provenance()
+		existing, ok := m.metaMap[bin]
+		if !ok {
 			m.dataMap[bin] = bindata
+			m.metaMap[bin] = meta
+		} else if existing.id != meta.id {
+			if preferOverlap(existing, meta) {
+				m.dataMap[bin] = bindata
+				m.metaMap[bin] = meta
+				recordOverlap(bin, meta, existing)
+			} else {
+				recordOverlap(bin, existing, meta)
+			}
 		}
 	}
 }
 
 func refreshBinData(e file.FileEvent) {
 	filepath := e.Filepath
-	var seekOffset int64 = 0
+	var (
+		seekOffset int64 = 0
+		readLines        = 0
+	)
 	if !e.FileCreated {
 		seekOffset = binDataMappingFile.bytesMap[filepath]
+		readLines = binDataMappingFile.linesMap[filepath]
 	}
 
 	var (
@@ -201,17 +340,46 @@ func refreshBinData(e file.FileEvent) {
 		approximate = true
 	}
 
-	for _, fd := range filedata {
+	validator := memory.validator
+	for i, fd := range filedata {
+		//第一行为header
+		line := readLines + i + 2
+		if validator != nil && validator.ValidateLine(filepath, line, fd, approximate) && Config.Strict {
+			continue
+		}
 		var binDataSet []mod.BinData
 		if binDataSet, err = parse(fd); err != nil {
 			logger.Errorf("parse bin binDataSet error: %s, binDataSet: %s", err, fd)
 			continue
 		}
-		for _, d := range binDataSet {
-			memory.save2Memory(d.IinStart, d, approximate)
+		memory.saveParsed(filepath, line, binDataSet, approximate)
+	}
+	if validator != nil {
+		logDiagnostics(validator.Finish())
+	}
+	//read返回的是整个文件的大小
+	binDataMappingFile.bytesMap[filepath] = filesize
+	binDataMappingFile.linesMap[filepath] = readLines + len(filedata)
+	//数据应用后再清空缓存及银行名称索引, 重新加载期间查询到的旧数据不会留下
+	if cache := currentCache(); cache != nil {
+		cache.Purge()
+	}
+	invalidateBankNames()
+}
+
+func logDiagnostics(diagnostics []Diagnostic) {
+	errorCount := 0
+	for _, d := range diagnostics {
+		if d.Level == DiagnosticLevelError {
+			errorCount++
+			logger.Error(d.String())
+		} else {
+			logger.Warn(d.String())
 		}
 	}
-	binDataMappingFile.bytesMap[filepath] += filesize
+	if len(diagnostics) > 0 {
+		logger.Warnf("数据文件校验发现 %d 个问题, 其中 %d 个error", len(diagnostics), errorCount)
+	}
 }
 
 func write2File(bin uint32, filepath string, bindata mod.BinData) error {
@@ -221,31 +389,7 @@ func write2File(bin uint32, filepath string, bindata mod.BinData) error {
 		data.Write([]byte(fmt.Sprintf("%s\n", binDataHeader)))
 	}
 	//写入数据
-	iinEnd := ""
-	if bindata.IinEnd != 0 {
-		iinEnd = strconv.FormatUint(uint64(bindata.IinEnd), 10)
-	}
-	numLen := ""
-	if bindata.NumberLength == 0 {
-		numLen = strconv.FormatUint(uint64(bindata.NumberLength), 10)
-	}
-
-	data.WriteString(strings.Join([]string{
-		fmt.Sprintf("%d", bindata.Id),
-		strconv.FormatUint(uint64(bin), 10),
-		iinEnd,
-		numLen,
-		bindata.NumberLuhn,
-		bindata.Schema,
-		bindata.Brand,
-		bindata.CardType,
-		bindata.Prepaid,
-		bindata.Country,
-		bindata.BankName,
-		bindata.BankLogo,
-		bindata.BankUrl,
-		bindata.BankPhone,
-		bindata.BankCity}, ","))
+	data.WriteString(format(bin, bindata))
 
 	var (
 		file *os.File
@@ -273,5 +417,51 @@ func write2File(bin uint32, filepath string, bindata mod.BinData) error {
 		logger.Error(err.Error())
 		return errors.New("保存bindata失败")
 	}
+	if err = file.Sync(); err != nil {
+		logger.Error(err.Error())
+		return errors.New("保存bindata失败")
+	}
 	return nil
 }
+
+//将bindata按RFC 4180格式化为一行数据, 不包含换行符
+func format(bin uint32, bindata mod.BinData) string {
+	iinEnd := ""
+	if bindata.IinEnd != 0 {
+		iinEnd = strconv.FormatUint(uint64(bindata.IinEnd), 10)
+	}
+	numLen := ""
+	if bindata.NumberLength > 0 {
+		numLen = strconv.FormatUint(uint64(bindata.NumberLength), 10)
+	}
+
+	return formatRecord([]string{
+		fmt.Sprintf("%d", bindata.Id),
+		strconv.FormatUint(uint64(bin), 10),
+		iinEnd,
+		numLen,
+		bindata.NumberLuhn,
+		bindata.Schema,
+		bindata.Brand,
+		bindata.CardType,
+		bindata.Prepaid,
+		bindata.Country,
+		bindata.BankName,
+		bindata.BankLogo,
+		bindata.BankUrl,
+		bindata.BankPhone,
+		bindata.BankCity})
+}
+
+//按RFC 4180格式化一行数据, 字段中的换行替换为空格, 保证一条数据只占一行
+func formatRecord(values []string) string {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = lineBreakReplacer.Replace(v)
+	}
+	buf := bytes.Buffer{}
+	writer := csv.NewWriter(&buf)
+	writer.Write(record)
+	writer.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,106 @@
+package bdata
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+)
+
+//MigrateResult 数据文件重写结果
+type MigrateResult struct {
+	Lines     int
+	Rewritten int
+	//无法解析, 原样保留的行号
+	Failed []int
+}
+
+//MigrateFile 按RFC 4180重写旧格式的数据文件, 未加引号的逗号会被正确转义
+//dryRun为true时只统计不写入, backup为true时原文件保留为.bak
+func MigrateFile(filepath string, dryRun, backup bool) (MigrateResult, error) {
+	var (
+		result MigrateResult
+		header string
+		lines  []string
+		err    error
+	)
+	if header, err = readHeader(filepath); err != nil {
+		return result, err
+	}
+	if lines, err = ReadBinDataFile(filepath); err != nil {
+		return result, err
+	}
+
+	//第一行为header, 没有header的文件第一行为数据
+	firstLine := 2
+	if header != binDataHeader {
+		result.Rewritten++
+		if isDataRecord(header) {
+			lines = append([]string{header}, lines...)
+			firstLine = 1
+		}
+	}
+	output := make([]string, 0, len(lines)+1)
+	output = append(output, binDataHeader)
+	for i, line := range lines {
+		result.Lines++
+		values, _, err := splitRecord(line)
+		if err != nil || len(values) != binDataColumns {
+			result.Failed = append(result.Failed, i+firstLine)
+			output = append(output, line)
+			continue
+		}
+		formatted := formatRecord(values)
+		if formatted != line {
+			result.Rewritten++
+		}
+		output = append(output, formatted)
+	}
+	if dryRun || result.Rewritten == 0 {
+		return result, nil
+	}
+
+	tmp := filepath + ".tmp"
+	if err = writeLines(tmp, output); err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+	if backup {
+		if err = os.Rename(filepath, filepath+".bak"); err != nil {
+			os.Remove(tmp)
+			return result, err
+		}
+	}
+	return result, os.Rename(tmp, filepath)
+}
+
+//是否为数据行, 数据行的第一列为数字id, header的第一列不是数字
+func isDataRecord(line string) bool {
+	values, _, err := splitRecord(line)
+	if err != nil || len(values) < 2 {
+		return false
+	}
+	_, err = strconv.ParseInt(values[0], 10, 64)
+	return err == nil
+}
+
+func writeLines(filepath string, lines []string) error {
+	var (
+		file *os.File
+		err  error
+	)
+	if file, err = os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		if _, err = writer.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
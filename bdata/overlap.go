@@ -0,0 +1,240 @@
+package bdata
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+const (
+	//范围最小的数据优先
+	OverlapPolicyMostSpecific = "most_specific"
+	//生效时间最新的数据优先
+	OverlapPolicyNewest = "newest"
+	//按来源的优先级
+	OverlapPolicySourcePriority = "source_priority"
+
+	//基础数据文件ranges.bd
+	SourceKindBase = "base"
+	//feedback写入的按日期分区的数据文件
+	SourceKindFeedback = "feedback"
+	//近似的feedback
+	SourceKindApproximate = "approximate"
+	//其他数据文件, 如导入的供应商数据
+	SourceKindImport = "import"
+)
+
+var (
+	baseDataFileName = "ranges.bd"
+	//默认的来源优先级, 靠前的优先
+	DefaultSourcePriority = []string{SourceKindFeedback, SourceKindImport, SourceKindBase}
+	//最多记录的冲突数
+	maxOverlapConflicts = 10000
+	overlaps            = &overlapReport{conflicts: make(map[[2]int64]*mod.OverlapConflict)}
+)
+
+//数据的来源信息, 用于重叠时按策略比较
+type recordMeta struct {
+	id                 int64
+	rangeStart         uint32
+	rangeEnd           uint32
+	validFrom          time.Time
+	source, sourceKind string
+	line               int
+	batch              string
+	submitter          *mod.Actor
+}
+
+//line为数据在文件中的行号, 未知时为0
+func newRecordMeta(bindata mod.BinData, source string, line int, rangeStart, rangeEnd uint32, validFrom time.Time) recordMeta {
+	meta := recordMeta{id: bindata.Id, rangeStart: rangeStart, rangeEnd: rangeEnd, validFrom: validFrom,
+		source: source, sourceKind: sourceKindOf(source), line: line, batch: importBatchOf(source)}
+	if bindata.Provenance != nil {
+		meta.submitter = bindata.Provenance.Submitter
+	}
+	return meta
+}
+
+func (r recordMeta) record() mod.OverlapRecord {
+	return mod.OverlapRecord{Id: r.id, IinStart: r.rangeStart, IinEnd: r.rangeEnd, Source: r.source, Line: r.line, SourceKind: r.sourceKind, Batch: r.batch, ValidFrom: r.validFrom}
+}
+
+func (r recordMeta) provenance() *mod.Provenance {
+	return &mod.Provenance{Source: r.source, Line: r.line, SourceKind: r.sourceKind, Batch: r.batch, Submitter: r.submitter,
+		IinStart: r.rangeStart, IinEnd: r.rangeEnd, ValidFrom: r.validFrom, Priority: sourceRank(r)}
+}
+
+//按文件名判断来源类型
+func sourceKindOf(filepath string) string {
+	name := path.Base(filepath)
+	if name == baseDataFileName {
+		return SourceKindBase
+	}
+	if name == binDataFileName || name == binDataApproximateFileName {
+		if _, err := time.Parse(DatePatternCompact, path.Base(path.Dir(filepath))); err == nil {
+			if name == binDataApproximateFileName {
+				return SourceKindApproximate
+			}
+			return SourceKindFeedback
+		}
+	}
+	return SourceKindImport
+}
+
+//import命令合并的文件名即导入批次, 如import_20190601120000.bd
+func importBatchOf(filepath string) string {
+	name := path.Base(filepath)
+	if strings.HasPrefix(name, "import_") {
+		return strings.TrimSuffix(name, path.Ext(name))
+	}
+	return ""
+}
+
+//IsOverlapPolicy 是否为支持的重叠策略
+func IsOverlapPolicy(policy string) bool {
+	switch policy {
+	case OverlapPolicyMostSpecific, OverlapPolicyNewest, OverlapPolicySourcePriority:
+		return true
+	}
+	return false
+}
+
+func overlapPolicy() string {
+	if IsOverlapPolicy(Config.OverlapPolicy) {
+		return Config.OverlapPolicy
+	}
+	return OverlapPolicyMostSpecific
+}
+
+func sourcePriority() []string {
+	if len(Config.SourcePriority) > 0 {
+		return Config.SourcePriority
+	}
+	return DefaultSourcePriority
+}
+
+//来源的优先级, 越小越优先, 未配置的来源排在最后
+//优先级可以按导入批次, 文件名或来源类型配置, 如import_20190601120000,vendor_a.bd,feedback,import,base
+func sourceRank(r recordMeta) int {
+	priority := sourcePriority()
+	for i, k := range priority {
+		if k == r.sourceKind || (r.batch != "" && k == r.batch) || k == path.Base(r.source) {
+			return i
+		}
+	}
+	return len(priority)
+}
+
+//candidate是否替换existing, 策略相同时依次比较范围, 生效时间, id, 结果与加载顺序无关
+func preferOverlap(existing, candidate recordMeta) bool {
+	var order []func(a, b recordMeta) int
+	switch overlapPolicy() {
+	case OverlapPolicyNewest:
+		order = []func(a, b recordMeta) int{compareNewest, compareSpecific}
+	case OverlapPolicySourcePriority:
+		order = []func(a, b recordMeta) int{compareSource, compareSpecific, compareNewest}
+	default:
+		order = []func(a, b recordMeta) int{compareSpecific, compareNewest}
+	}
+	for _, compare := range order {
+		if c := compare(candidate, existing); c != 0 {
+			return c > 0
+		}
+	}
+	return candidate.id > existing.id
+}
+
+//a优先时返回1, b优先时返回-1
+func compareSpecific(a, b recordMeta) int {
+	wa, wb := a.rangeEnd-a.rangeStart, b.rangeEnd-b.rangeStart
+	if wa < wb {
+		return 1
+	} else if wa > wb {
+		return -1
+	}
+	return 0
+}
+
+func compareNewest(a, b recordMeta) int {
+	if a.validFrom.After(b.validFrom) {
+		return 1
+	} else if a.validFrom.Before(b.validFrom) {
+		return -1
+	}
+	return 0
+}
+
+func compareSource(a, b recordMeta) int {
+	ra, rb := sourceRank(a), sourceRank(b)
+	if ra < rb {
+		return 1
+	} else if ra > rb {
+		return -1
+	}
+	return 0
+}
+
+//feedback的bin已有确切数据时不保存, 记录已有数据与feedback的冲突, 替换已有数据需通过ReplaceBinData
+func detectOverlap(bin uint32, existing, bindata mod.BinData) {
+	winner := recordMeta{id: existing.Id, rangeStart: existing.IinStart, rangeEnd: existing.IinEnd, validFrom: versionTime("", existing.Id)}
+	if m, ok := unwrapBinDatabase().(*memoryDatabase); ok {
+		if meta, ok := m.exactMeta(bin); ok && meta.id == existing.Id {
+			winner = meta
+		}
+	}
+	loser := newRecordMeta(bindata, "", 0, bin, bin, versionTime("", bindata.Id))
+	loser.sourceKind = SourceKindFeedback
+	recordOverlap(bin, winner, loser)
+}
+
+//重叠的冲突, 同一对数据只记录一条, 并累计重叠的bin
+type overlapReport struct {
+	mutex     sync.Mutex
+	conflicts map[[2]int64]*mod.OverlapConflict
+	dropped   int
+}
+
+//记录bin上winner与loser的冲突
+func recordOverlap(bin uint32, winner, loser recordMeta) {
+	overlaps.mutex.Lock()
+	defer overlaps.mutex.Unlock()
+	key := [2]int64{winner.id, loser.id}
+	if c, ok := overlaps.conflicts[key]; ok {
+		if bin < c.BinStart {
+			c.BinStart = bin
+		}
+		if bin > c.BinEnd {
+			c.BinEnd = bin
+		}
+		c.Bins++
+		return
+	}
+	if len(overlaps.conflicts) >= maxOverlapConflicts {
+		overlaps.dropped++
+		return
+	}
+	overlaps.conflicts[key] = &mod.OverlapConflict{Winner: winner.record(), Loser: loser.record(), Policy: overlapPolicy(),
+		BinStart: bin, BinEnd: bin, Bins: 1, DetectedAt: time.Now()}
+}
+
+//Overlaps 加载及写入时发现的重叠, 按最早的重叠bin排序
+func Overlaps() mod.OverlapReport {
+	overlaps.mutex.Lock()
+	defer overlaps.mutex.Unlock()
+	report := mod.OverlapReport{Policy: overlapPolicy(), SourcePriority: sourcePriority(), Conflicts: make([]mod.OverlapConflict, 0, len(overlaps.conflicts)), Dropped: overlaps.dropped}
+	for _, c := range overlaps.conflicts {
+		report.Conflicts = append(report.Conflicts, *c)
+	}
+	sort.Slice(report.Conflicts, func(i, j int) bool {
+		a, b := report.Conflicts[i], report.Conflicts[j]
+		if a.BinStart != b.BinStart {
+			return a.BinStart < b.BinStart
+		}
+		return a.Winner.Id < b.Winner.Id
+	})
+	return report
+}
@@ -0,0 +1,133 @@
+package bdata
+
+import (
+	"testing"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//使用指定的重叠策略
+func useOverlapPolicy(t *testing.T, policy string, priority ...string) {
+	t.Helper()
+	savedPolicy, savedPriority := Config.OverlapPolicy, Config.SourcePriority
+	t.Cleanup(func() { Config.OverlapPolicy, Config.SourcePriority = savedPolicy, savedPriority })
+	Config.OverlapPolicy, Config.SourcePriority = policy, priority
+}
+
+func TestSourceKindOf(t *testing.T) {
+	cases := []struct {
+		filepath string
+		kind     string
+		batch    string
+	}{
+		{"/data/ranges.bd", SourceKindBase, ""},
+		{"/data/20190601/bindata.bd", SourceKindFeedback, ""},
+		{"/data/20190601/approximate.bd2", SourceKindApproximate, ""},
+		{"/data/vendor/bindata.bd", SourceKindImport, ""},
+		{"/data/20190601/import_20190601120000.bd", SourceKindImport, "import_20190601120000"},
+		{"/data/vendor_a.bd", SourceKindImport, ""},
+	}
+	for _, c := range cases {
+		if kind := sourceKindOf(c.filepath); kind != c.kind {
+			t.Errorf("%s: kind %s, want %s", c.filepath, kind, c.kind)
+		}
+		if batch := importBatchOf(c.filepath); batch != c.batch {
+			t.Errorf("%s: batch %q, want %q", c.filepath, batch, c.batch)
+		}
+	}
+}
+
+func TestSourceRank(t *testing.T) {
+	cases := []struct {
+		priority []string
+		source   string
+		rank     int
+	}{
+		{nil, "/data/20190601/bindata.bd", 0},
+		{nil, "/data/vendor_a.bd", 1},
+		{nil, "/data/ranges.bd", 2},
+		{nil, "/data/20190601/approximate.bd2", 3},
+		{[]string{"import_20190601120000", "base"}, "/data/20190601/import_20190601120000.bd", 0},
+		{[]string{"import_20190601120000", "base"}, "/data/20190602/import_20190602120000.bd", 2},
+		{[]string{"vendor_a.bd", "import"}, "/data/vendor_a.bd", 0},
+		{[]string{"vendor_a.bd", "import"}, "/data/vendor_b.bd", 1},
+	}
+	for _, c := range cases {
+		useOverlapPolicy(t, OverlapPolicySourcePriority, c.priority...)
+		meta := newRecordMeta(mod.BinData{Id: 1}, c.source, 0, 400000, 400000, time.Time{})
+		if rank := sourceRank(meta); rank != c.rank {
+			t.Errorf("%v %s: rank %d, want %d", c.priority, c.source, rank, c.rank)
+		}
+	}
+}
+
+func TestPreferOverlap(t *testing.T) {
+	old := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(24 * time.Hour)
+	meta := func(id int64, source string, start, end uint32, validFrom time.Time) recordMeta {
+		return newRecordMeta(mod.BinData{Id: id}, source, 0, start, end, validFrom)
+	}
+	wideBase := meta(1, "/data/ranges.bd", 400000, 400099, old)
+	narrowBase := meta(2, "/data/ranges.bd", 400000, 400009, old)
+	wideFeedback := meta(3, "/data/20190602/bindata.bd", 400000, 400099, recent)
+	sameBase := meta(4, "/data/ranges.bd", 400000, 400099, old)
+
+	cases := []struct {
+		name      string
+		policy    string
+		existing  recordMeta
+		candidate recordMeta
+		prefer    bool
+	}{
+		{"specific narrower", OverlapPolicyMostSpecific, wideBase, narrowBase, true},
+		{"specific wider", OverlapPolicyMostSpecific, narrowBase, wideBase, false},
+		{"specific same width newer", OverlapPolicyMostSpecific, wideBase, wideFeedback, true},
+		{"specific unknown policy", "unknown", narrowBase, wideFeedback, false},
+		{"newest newer wider", OverlapPolicyNewest, narrowBase, wideFeedback, true},
+		{"newest older", OverlapPolicyNewest, wideFeedback, narrowBase, false},
+		{"newest same time narrower", OverlapPolicyNewest, wideBase, narrowBase, true},
+		{"source feedback over base", OverlapPolicySourcePriority, narrowBase, wideFeedback, true},
+		{"source base under feedback", OverlapPolicySourcePriority, wideFeedback, narrowBase, false},
+		{"source same kind narrower", OverlapPolicySourcePriority, wideBase, narrowBase, true},
+		//完全相同时id大的优先, 与加载顺序无关
+		{"tie higher id", OverlapPolicyMostSpecific, wideBase, sameBase, true},
+		{"tie lower id", OverlapPolicyMostSpecific, sameBase, wideBase, false},
+	}
+	for _, c := range cases {
+		useOverlapPolicy(t, c.policy)
+		if prefer := preferOverlap(c.existing, c.candidate); prefer != c.prefer {
+			t.Errorf("%s: prefer %v, want %v", c.name, prefer, c.prefer)
+		}
+	}
+}
+
+func TestRecordOverlap(t *testing.T) {
+	saved, savedMax := overlaps, maxOverlapConflicts
+	t.Cleanup(func() { overlaps, maxOverlapConflicts = saved, savedMax })
+	overlaps = &overlapReport{conflicts: make(map[[2]int64]*mod.OverlapConflict)}
+	maxOverlapConflicts = 2
+
+	meta := func(id int64) recordMeta {
+		return newRecordMeta(mod.BinData{Id: id}, "/data/ranges.bd", 0, 400000, 400099, time.Time{})
+	}
+	//同一对数据累计重叠的bin
+	recordOverlap(400005, meta(2), meta(1))
+	recordOverlap(400003, meta(2), meta(1))
+	recordOverlap(400008, meta(2), meta(1))
+	recordOverlap(300000, meta(4), meta(3))
+	//超过最大记录数时只计数
+	recordOverlap(500000, meta(6), meta(5))
+
+	report := Overlaps()
+	if len(report.Conflicts) != 2 || report.Dropped != 1 {
+		t.Fatalf("report %+v", report)
+	}
+	first, second := report.Conflicts[0], report.Conflicts[1]
+	if first.Winner.Id != 4 || first.Loser.Id != 3 || first.Bins != 1 {
+		t.Errorf("first conflict %+v", first)
+	}
+	if second.Winner.Id != 2 || second.BinStart != 400003 || second.BinEnd != 400008 || second.Bins != 3 || second.Winner.SourceKind != SourceKindBase {
+		t.Errorf("second conflict %+v", second)
+	}
+}
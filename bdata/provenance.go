@@ -0,0 +1,77 @@
+package bdata
+
+import (
+	"encoding/json"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//ProvenancedBinData 数据及其来源
+type ProvenancedBinData struct {
+	Data       mod.BinData     `json:"data"`
+	Provenance *mod.Provenance `json:"provenance"`
+}
+
+//BinProvenance bin当前的确切数据, 近似数据及其来源, 以及涉及该bin的重叠
+type BinProvenance struct {
+	Bin            uint32                `json:"bin"`
+	Policy         string                `json:"policy"`
+	SourcePriority []string              `json:"source_priority"`
+	Exact          *ProvenancedBinData   `json:"exact"`
+	Approximate    []ProvenancedBinData  `json:"approximate"`
+	Overlaps       []mod.OverlapConflict `json:"overlaps"`
+}
+
+//LookupProvenance 查询bin的数据及来源, 只有内存数据库保存来源, 其他数据库的provenance为空
+func LookupProvenance(bin string) (*BinProvenance, error) {
+	uint32bin, err := bin2Uint32(bin)
+	if err != nil {
+		return nil, err
+	}
+	result := &BinProvenance{Bin: uint32bin, Policy: overlapPolicy(), SourcePriority: sourcePriority(),
+		Approximate: make([]ProvenancedBinData, 0), Overlaps: make([]mod.OverlapConflict, 0)}
+	if d, err := currentBinDatabase.ReadExact(uint32bin); err == nil {
+		result.Exact = &ProvenancedBinData{Data: d, Provenance: withSubmitter(bin, d)}
+	}
+	if list, err := currentBinDatabase.ReadApproximate(uint32bin); err == nil {
+		for _, d := range list {
+			result.Approximate = append(result.Approximate, ProvenancedBinData{Data: d, Provenance: withSubmitter(bin, d)})
+		}
+	}
+	for _, c := range Overlaps().Conflicts {
+		if c.BinStart <= uint32bin && uint32bin <= c.BinEnd {
+			result.Overlaps = append(result.Overlaps, c)
+		}
+	}
+	return result, nil
+}
+
+//重启后feedback的提交方不在内存中, 从审计日志中按id查找
+func withSubmitter(bin string, d mod.BinData) *mod.Provenance {
+	if d.Provenance == nil || d.Provenance.Submitter != nil {
+		return d.Provenance
+	}
+	if d.Provenance.SourceKind != SourceKindFeedback && d.Provenance.SourceKind != SourceKindApproximate {
+		return d.Provenance
+	}
+	entries, err := QueryAudit(AuditQuery{Key: bin, Action: binDataAction(d.Provenance.SourceKind == SourceKindApproximate)})
+	if err != nil {
+		return d.Provenance
+	}
+	for _, e := range entries {
+		var after mod.BinData
+		if json.Unmarshal(e.After, &after) == nil && after.Id == d.Id {
+			p := *d.Provenance
+			actor := e.Actor
+			p.Submitter = &actor
+			return &p
+		}
+	}
+	return d.Provenance
+}
+
+//保存前记录提交方
+func withActor(actor mod.Actor, bindata mod.BinData) mod.BinData {
+	bindata.Provenance = &mod.Provenance{Submitter: &actor}
+	return bindata
+}
@@ -0,0 +1,101 @@
+package bdata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestLookupProvenance(t *testing.T) {
+	saved := overlaps
+	t.Cleanup(func() { overlaps = saved })
+	overlaps = &overlapReport{conflicts: make(map[[2]int64]*mod.OverlapConflict)}
+	useTestAudit(t)
+	m := useTestMemory(t)
+
+	actor := mod.Actor{ClientIp: "10.0.0.1", Endpoint: "/bindb/v1/bin/feedback/:bin"}
+	base := filepath.Join(m.dataDir, baseDataFileName)
+	feedback := filepath.Join(m.dataDir, "20190601", binDataFileName)
+	approximate := filepath.Join(m.dataDir, "20190601", binDataApproximateFileName)
+	rows := []struct {
+		filepath string
+		row      string
+	}{
+		{base, "1,400000,400099,,,visa,,credit,,US,TEST BANK,,,,"},
+		{feedback, "2,400050,,,,visa,,debit,,US,TEST BANK,,,,"},
+		{approximate, "3,500000,,,,visa,,debit,,US,GUESS BANK,,,,"},
+	}
+	for _, r := range rows {
+		data, err := parse(r.row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.saveParsed(r.filepath, 2, data, IsApproximateFile(r.filepath))
+	}
+	//重启后提交方从审计日志中查找
+	exact, _ := m.ReadExact(400050)
+	exact.Provenance = nil
+	if err := writeAudit(actor, AuditActionBinCreate, "400050", nil, exact); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		bin         string
+		id          int64
+		kind        string
+		submitter   bool
+		approximate int
+		overlaps    int
+	}{
+		{"400000", 1, SourceKindBase, false, 0, 0},
+		{"400050", 2, SourceKindFeedback, true, 0, 1},
+		{"500000", 0, "", false, 1, 0},
+	}
+	for _, c := range cases {
+		result, err := LookupProvenance(c.bin)
+		if err != nil {
+			t.Errorf("%s: %v", c.bin, err)
+			continue
+		}
+		if len(result.Approximate) != c.approximate || len(result.Overlaps) != c.overlaps || result.Policy != OverlapPolicyMostSpecific {
+			t.Errorf("%s: %+v", c.bin, result)
+		}
+		if c.id == 0 {
+			if result.Exact != nil {
+				t.Errorf("%s: exact %+v", c.bin, result.Exact)
+			}
+			continue
+		}
+		p := result.Exact.Provenance
+		if result.Exact.Data.Id != c.id || p == nil || p.SourceKind != c.kind || (p.Submitter != nil) != c.submitter {
+			t.Errorf("%s: exact %+v provenance %+v", c.bin, result.Exact.Data, p)
+			continue
+		}
+		if c.submitter && *p.Submitter != actor {
+			t.Errorf("%s: submitter %+v", c.bin, p.Submitter)
+		}
+	}
+	if result, _ := LookupProvenance("500000"); result.Approximate[0].Provenance.SourceKind != SourceKindApproximate {
+		t.Errorf("approximate provenance %+v", result.Approximate[0].Provenance)
+	}
+	if _, err := LookupProvenance("abc"); err == nil {
+		t.Error("looked up invalid bin")
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	actor := mod.Actor{ApiKey: ApiKeyFingerprint("key")}
+	bindata := withActor(actor, testBinData(1, 400000, 400000, "TEST BANK"))
+	if bindata.Provenance == nil || *bindata.Provenance.Submitter != actor {
+		t.Errorf("provenance %+v", bindata.Provenance)
+	}
+	//来源不是feedback时不查找审计日志
+	p := &mod.Provenance{SourceKind: SourceKindBase}
+	if got := withSubmitter("400000", mod.BinData{Id: 1, Provenance: p}); got != p {
+		t.Errorf("provenance %+v", got)
+	}
+	if got := withSubmitter("400000", mod.BinData{Id: 1}); got != nil {
+		t.Errorf("provenance %+v", got)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -26,8 +27,8 @@ var (
 var (
 	Config                 = BinDataConfig{}
 	currentBinDatabase     BinDatabase
-	bankNameCnMapping      = mappingFile{fileSize: 0, reloading: make(chan file.FileEvent), dataMap: make(map[string]string, 3000)}
-	countryCnMapping       = mappingFile{fileSize: 0, reloading: make(chan file.FileEvent), dataMap: make(map[string]string, 300)}
+	bankNameCnMapping      = localeMappings.get(mappingKindBankName, defaultMappingLocale)
+	countryCnMapping       = localeMappings.get(mappingKindCountry, defaultMappingLocale)
 	NullBinData            mod.BinData
 	setBinDatabaseModeOnce sync.Once
 )
@@ -38,12 +39,46 @@ var fileEventListenerList []fileEventListener
 
 type BinDataConfig struct {
 	DataDir string
+	//加载时校验数据文件并输出问题
+	Validate bool
+	//严格模式, 跳过存在error级别问题的数据行
+	Strict bool
+	//write-ahead log压缩到数据文件的间隔
+	CompactInterval time.Duration
+	//bbolt数据库文件, 为空时使用数据目录下的bindata.db
+	BoltPath string
+	//database/sql的驱动名称及dsn
+	SqlDriver string
+	SqlDsn    string
+	//缓存的最大条目数, 为0时不启用缓存
+	CacheSize int
+	//缓存结果的有效期, 未找到的结果使用CacheNegativeTTL
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+	//确切数据区间重叠时的策略, 为空时使用most_specific, 只对memory数据库生效
+	OverlapPolicy string
+	//source_priority策略的来源优先级, 为空时使用DefaultSourcePriority
+	SourcePriority []string
 }
 
 type mappingFile struct {
-	fileSize  int64
-	reloading chan file.FileEvent
-	dataMap   map[string]string
+	mutex    sync.RWMutex
+	fileSize int64
+	dataMap  map[string]string
+}
+
+func (mpf *mappingFile) get(key string) (string, bool) {
+	mpf.mutex.RLock()
+	defer mpf.mutex.RUnlock()
+	name, ok := mpf.dataMap[key]
+	return name, ok
+}
+
+func (mpf *mappingFile) set(key, name string, fileSize int64) {
+	mpf.mutex.Lock()
+	defer mpf.mutex.Unlock()
+	mpf.dataMap[key] = name
+	mpf.fileSize = fileSize
 }
 
 type BinDatabase interface {
@@ -51,6 +86,8 @@ type BinDatabase interface {
 	ReadExact(bin uint32) (mod.BinData, error)
 	ReadApproximate(bin uint32) ([]mod.BinData, error)
 	Save(bin uint32, binData mod.BinData, approximate bool) error
+	//按bin升序遍历所有确切数据, fn返回false时停止
+	Scan(fn func(binData mod.BinData) bool) error
 }
 
 func SetBinDatabaseMode(mode string) {
@@ -59,25 +96,138 @@ func SetBinDatabaseMode(mode string) {
 			currentBinDatabase = NewMemoryDatabase()
 		} else if BinDatabaseModeRedis == mode {
 			//need to be impl
+		} else if BinDatabaseModeBolt == mode {
+			currentBinDatabase = NewBoltDatabase()
+		} else if BinDatabaseModeSql == mode {
+			currentBinDatabase = NewSqlDatabase()
 		} else {
 			currentBinDatabase = NewMemoryDatabase()
 		}
+		if Config.DataDir != "" {
+			//加载数据时需要使用注册表统一银行名称
+			issuerFile := strings.Join([]string{Config.DataDir, issuerRegistryFileName}, "/")
+			if err := loadIssuerRegistry(issuerFile); err != nil {
+				logger.Errorf("load issuer registry error: %s", err)
+			}
+			AddFileListener(func(event file.FileEvent) {
+				if path.Base(event.Filepath) != issuerRegistryFileName {
+					return
+				}
+				if err := loadIssuerRegistry(issuerFile); err != nil {
+					logger.Errorf("load issuer registry error: %s", err)
+					return
+				}
+				if currentCache() != nil {
+					PurgeCache()
+				}
+			})
+		}
+		if Config.CacheSize > 0 {
+			currentBinDatabase = newCachedDatabase(currentBinDatabase, Config.CacheSize, Config.CacheTTL, Config.CacheNegativeTTL)
+		}
 		if err := currentBinDatabase.Init(Config); err != nil {
-			logger.Fatal("refresh bin data error: %s", err)
+			logger.Fatalf("refresh bin data error: %s", err)
+		}
+		AddFileListener(bankNamesFileListener)
+		if Config.DataDir != "" {
+			if err := openAuditLog(Config.DataDir); err != nil {
+				logger.Errorf("open audit log error: %s", err)
+			}
+			if err := openChangeFeed(Config.DataDir); err != nil {
+				logger.Errorf("open change feed error: %s", err)
+			}
+			if err := openWebhooks(Config.DataDir); err != nil {
+				logger.Errorf("open webhooks error: %s", err)
+			}
+			countryOverrideFile := strings.Join([]string{Config.DataDir, countryOverrideFileName}, "/")
+			if err := loadCountryOverrides(countryOverrideFile); err != nil {
+				logger.Errorf("load country overrides error: %s", err)
+			}
+			currencyOverrideFile := strings.Join([]string{Config.DataDir, currencyOverrideFileName}, "/")
+			if err := loadCurrencyOverrides(currencyOverrideFile); err != nil {
+				logger.Errorf("load currency overrides error: %s", err)
+			}
+			schemeRuleFile := strings.Join([]string{Config.DataDir, schemeRuleFileName}, "/")
+			if err := loadSchemeRules(schemeRuleFile); err != nil {
+				logger.Errorf("load scheme rules error: %s", err)
+			}
+			AddFileListener(func(event file.FileEvent) {
+				switch path.Base(event.Filepath) {
+				case countryOverrideFileName:
+					if err := loadCountryOverrides(countryOverrideFile); err != nil {
+						logger.Errorf("load country overrides error: %s", err)
+					}
+				case currencyOverrideFileName:
+					if err := loadCurrencyOverrides(currencyOverrideFile); err != nil {
+						logger.Errorf("load currency overrides error: %s", err)
+					}
+				case schemeRuleFileName:
+					if err := loadSchemeRules(schemeRuleFile); err != nil {
+						logger.Errorf("load scheme rules error: %s", err)
+					}
+				}
+			})
 		}
 	})
 }
 
+//Close 关闭当前数据库, 如压缩write-ahead log
+func Close() error {
+	stopWebhooks()
+	if err := closeChangeFeed(); err != nil {
+		logger.Error(err)
+	}
+	if currentReplicator != nil {
+		if err := currentReplicator.Stop(); err != nil {
+			logger.Errorf("stop replication error: %s", err)
+		}
+	}
+	if closer, ok := currentBinDatabase.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//未找到数据
+type notFoundError struct {
+	bin uint32
+}
+
+func (e notFoundError) Error() string {
+	return fmt.Sprintf("%d not found", e.bin)
+}
+
+func notFound(bin uint32) error {
+	return notFoundError{bin: bin}
+}
+
+//IsNotFound 是否为数据不存在的错误
+func IsNotFound(err error) bool {
+	_, ok := err.(notFoundError)
+	return ok
+}
+
 func AddFileListener(listener fileEventListener) {
 	fileEventListenerList = append(fileEventListenerList, listener)
 }
 
-func CreateBankNameMapping(key, name string) error {
-	if _, ok := bankNameCnMapping.dataMap[key]; ok {
-		return nil
+func CreateBankNameMapping(actor mod.Actor, key, name string) error {
+	created, err := createBankNameMapping(actor, key, name)
+	if err == nil && created {
+		replicate(AuditActionBankNameCreate, key, name, nil)
+	}
+	return err
+}
+
+func createBankNameMapping(actor mod.Actor, key, name string) (bool, error) {
+	if _, ok := bankNameCnMapping.get(key); ok {
+		return false, nil
+	}
+	if err := verifyMapping(key, name); err != nil {
+		return false, err
 	}
 	if Config.DataDir == "" {
-		return errors.New("存储地址未配置")
+		return false, errors.New("存储地址未配置")
 	}
 
 	filepath := fmt.Sprintf("%s/%s", Config.DataDir, bankNameCnFileName)
@@ -87,7 +237,7 @@ func CreateBankNameMapping(key, name string) error {
 	)
 
 	if file, err = os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
-		return err
+		return false, err
 	}
 
 	defer func() {
@@ -95,26 +245,38 @@ func CreateBankNameMapping(key, name string) error {
 	}()
 
 	if _, err = file.WriteString(fmt.Sprintf("%s\n", strings.Join([]string{key, name}, "="))); err != nil {
-		return err
+		return false, err
 	}
 
 	var (
 		fileInfo os.FileInfo
 	)
 	if fileInfo, err = file.Stat(); err != nil {
-		return err
+		return false, err
 	}
-	bankNameCnMapping.fileSize = fileInfo.Size()
-	bankNameCnMapping.dataMap[key] = name
-	return nil
+	bankNameCnMapping.set(key, name, fileInfo.Size())
+	bankNames.add(name)
+	auditMutation(actor, AuditActionBankNameCreate, key, nil, name)
+	return true, nil
 }
 
-func CreateCountryCnNameMapping(key, name string) error {
-	if _, ok := countryCnMapping.dataMap[key]; ok {
-		return nil
+func CreateCountryCnNameMapping(actor mod.Actor, key, name string) error {
+	created, err := createCountryCnNameMapping(actor, key, name)
+	if err == nil && created {
+		replicate(AuditActionCountryNameCreate, key, name, nil)
+	}
+	return err
+}
+
+func createCountryCnNameMapping(actor mod.Actor, key, name string) (bool, error) {
+	if _, ok := countryCnMapping.get(key); ok {
+		return false, nil
+	}
+	if err := verifyMapping(key, name); err != nil {
+		return false, err
 	}
 	if Config.DataDir == "" {
-		return errors.New("存储地址未配置")
+		return false, errors.New("存储地址未配置")
 	}
 
 	filepath := fmt.Sprintf("%s/%s", Config.DataDir, countryCnFileName)
@@ -125,7 +287,7 @@ func CreateCountryCnNameMapping(key, name string) error {
 	)
 
 	if file, err = os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
-		return err
+		return false, err
 	}
 
 	defer func() {
@@ -133,20 +295,31 @@ func CreateCountryCnNameMapping(key, name string) error {
 	}()
 
 	if _, err = file.WriteString(fmt.Sprintf("%s\n", strings.Join([]string{key, name}, "="))); err != nil {
-		return err
+		return false, err
 	}
 	var (
 		fileInfo os.FileInfo
 	)
 	if fileInfo, err = file.Stat(); err != nil {
-		return err
+		return false, err
+	}
+	countryCnMapping.set(key, name, fileInfo.Size())
+	auditMutation(actor, AuditActionCountryNameCreate, key, nil, name)
+	return true, nil
+}
+
+//映射文件每行为key=name, key中不能包含=, 两者都不能包含换行
+func verifyMapping(key, name string) error {
+	if key == "" || name == "" {
+		return errors.New("key和name不能为空")
+	}
+	if strings.ContainsAny(key, "=\r\n") || strings.ContainsAny(name, "\r\n") {
+		return errors.New("key不能包含=或换行, name不能包含换行")
 	}
-	countryCnMapping.fileSize = fileInfo.Size()
-	countryCnMapping.dataMap[key] = name
 	return nil
 }
 
-func CreateBinData(bin string, bindata mod.BinData, approximate bool) error {
+func CreateBinData(actor mod.Actor, bin string, bindata mod.BinData, approximate bool) error {
 	var (
 		uint32bin uint32
 		err       error
@@ -154,17 +327,109 @@ func CreateBinData(bin string, bindata mod.BinData, approximate bool) error {
 	if uint32bin, err = bin2Uint32(bin); err != nil {
 		return err
 	}
-	if _, err = currentBinDatabase.ReadExact(uint32bin); err == nil {
-		return nil
+
+	//feedback只针对单个bin
+	bindata.Id = time.Now().UnixNano()
+	bindata.IinStart = uint32bin
+	bindata.IinEnd = uint32bin
+	var saved bool
+	if saved, err = saveBinData(actor, uint32bin, bindata, approximate); err != nil || !saved {
+		return err
+	}
+	replicate(binDataAction(approximate), bin, "", &bindata)
+	return nil
+}
+
+//保存并记录审计日志, 相同id的数据已存在, 或已有确切数据时跳过
+//已有其他确切数据时不替换, 只记录冲突, 替换需通过ReplaceBinData
+func saveBinData(actor mod.Actor, bin uint32, bindata mod.BinData, approximate bool) (bool, error) {
+	if existing, err := currentBinDatabase.ReadExact(bin); err == nil {
+		if !approximate && existing.Id != bindata.Id {
+			detectOverlap(bin, existing, bindata)
+		}
+		return false, nil
+	}
+	if approximate {
+		if list, err := currentBinDatabase.ReadApproximate(bin); err == nil {
+			for _, d := range list {
+				if d.Id == bindata.Id {
+					return false, nil
+				}
+			}
+		}
+	}
+	if err := currentBinDatabase.Save(bin, withActor(actor, bindata), approximate); err != nil {
+		return false, err
+	}
+	if bindata.BankName != "" {
+		bankNames.add(bindata.BankName)
+	}
+	auditMutation(actor, binDataAction(approximate), strconv.FormatUint(uint64(bin), 10), nil, bindata)
+	return true, nil
+}
+
+//ReplaceBinData 管理接口替换bin已有的确切数据, 仅内存数据库支持
+//写入前按重叠策略判断, 已有数据优先时不写入, 记录冲突并返回错误
+func ReplaceBinData(actor mod.Actor, bin string, bindata mod.BinData) error {
+	var (
+		uint32bin uint32
+		err       error
+	)
+	if uint32bin, err = bin2Uint32(bin); err != nil {
+		return err
 	}
 
 	bindata.Id = time.Now().UnixNano()
-	if err = currentBinDatabase.Save(uint32bin, bindata, approximate); err != nil {
+	bindata.IinStart = uint32bin
+	bindata.IinEnd = uint32bin
+	var saved bool
+	if saved, err = replaceBinData(actor, uint32bin, bindata); err != nil {
 		return err
 	}
+	if !saved {
+		return errors.New(fmt.Sprintf("按重叠策略%s已有数据优先, 未替换", overlapPolicy()))
+	}
+	replicate(AuditActionBinUpdate, bin, "", &bindata)
 	return nil
 }
 
+//替换确切数据并记录审计日志, 相同id的数据已存在或已有数据优先时返回false
+func replaceBinData(actor mod.Actor, bin uint32, bindata mod.BinData) (bool, error) {
+	m, ok := unwrapBinDatabase().(*memoryDatabase)
+	if !ok {
+		return false, errors.New("当前数据库不支持替换已有数据")
+	}
+	existing, readErr := m.ReadExact(bin)
+	if readErr == nil && existing.Id == bindata.Id {
+		return false, nil
+	}
+	saved, err := m.Replace(bin, withActor(actor, bindata))
+	if cache := currentCache(); cache != nil {
+		cache.Invalidate(bin)
+	}
+	if err != nil || !saved {
+		return false, err
+	}
+	var before interface{}
+	action := AuditActionBinCreate
+	if readErr == nil {
+		before = existing
+		action = AuditActionBinUpdate
+	}
+	if bindata.BankName != "" {
+		bankNames.add(bindata.BankName)
+	}
+	auditMutation(actor, action, strconv.FormatUint(uint64(bin), 10), before, bindata)
+	return true, nil
+}
+
+func binDataAction(approximate bool) string {
+	if approximate {
+		return AuditActionBinCreateApproximate
+	}
+	return AuditActionBinCreate
+}
+
 func Query(bin string) (*mod.SimpleBinData, error) {
 	var (
 		uint32bin uint32
@@ -177,48 +442,67 @@ func Query(bin string) (*mod.SimpleBinData, error) {
 	var (
 		result      mod.BinData
 		approximate bool
-		ok          bool
 	)
 	if result, err = currentBinDatabase.ReadExact(uint32bin); err != nil || approximate {
-		return nil, errors.New(fmt.Sprintf("bin %s not found", bin))
+		//未找到时按卡组织规则推断, 其他错误(如数据库不可用)直接返回
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		if inferred, ok := inferBinData(bin); ok {
+			return inferred, nil
+		}
+		return nil, notFound(uint32bin)
 	}
 
-	var bankNameCn, countryCn string
-	if bankNameCn, ok = bankNameCnMapping.dataMap[result.BankName]; !ok {
+	return toSimpleBinData(result), nil
+}
+
+func toSimpleBinData(result mod.BinData) *mod.SimpleBinData {
+	var (
+		bankNameCn, countryCn string
+		ok                    bool
+	)
+	//注册表可能在数据加载后修改
+	issuerId := NormalizeIssuer(&result.BaseBinData)
+	if bankNameCn, ok = bankNameCnMapping.get(result.BankName); !ok {
 		bankNameCn = result.BankName
 	}
-	if countryCn, ok = countryCnMapping.dataMap[result.Country]; !ok {
+	if countryCn, ok = countryCnMapping.get(result.Country); !ok {
 		countryCn = result.Country
 	}
-	return &mod.SimpleBinData{
+	data := &mod.SimpleBinData{
 		BaseBinData: mod.BaseBinData{
 			Schema:   result.Schema,
 			Brand:    result.Brand,
 			CardType: result.CardType,
 			Country:  result.Country,
 			BankName: result.BankName},
+		IssuerId:   issuerId,
 		BankNameCn: bankNameCn,
-		CountryCn:  countryCn}, nil
+		CountryCn:  countryCn}
+	if country, ok := LookupCountry(result.Country); ok && result.Country != "" {
+		data.CountryInfo = &country
+	}
+	if currency, ok := BinCurrency(result.IinStart, result.Country); ok {
+		data.Currency = &currency
+	}
+	setNumberFields(data, result)
+	return data
 }
 
 func readFromFile(event file.FileEvent) {
 	filepath := event.Filepath
-	filename := path.Base(filepath)
-	if filename == bankNameCnFileName {
-		bankNameCnMapping.reloading <- event
-	} else if filename == countryCnFileName {
-		countryCnMapping.reloading <- event
+	if _, _, ok := parseMappingFileName(path.Base(filepath)); ok {
+		mappingReloading <- event
 	} else {
 		logger.Infof("忽略文件: %s", filepath)
 	}
 }
 
-func refreshBankName(event file.FileEvent) {
-	readMappingFile(&bankNameCnMapping, event)
-}
-
-func refreshCountry(event file.FileEvent) {
-	readMappingFile(&countryCnMapping, event)
+//按文件名加载对应语言的映射文件
+func refreshMapping(event file.FileEvent) {
+	kind, locale, _ := parseMappingFileName(path.Base(event.Filepath))
+	readMappingFile(localeMappings.get(kind, locale), event)
 }
 
 func readMappingFile(mpf *mappingFile, e file.FileEvent) {
@@ -232,18 +516,21 @@ func readMappingFile(mpf *mappingFile, e file.FileEvent) {
 		logger.Errorf("read file error: %s", err)
 		return
 	}
+	defer f.Close()
 	if fileInfo, err = f.Stat(); err != nil {
 		logger.Error(err)
 		return
 	}
 
+	mpf.mutex.Lock()
+	defer mpf.mutex.Unlock()
 	if fileInfo.Size() < mpf.fileSize {
 		//文件有删除, 全部重新加载
 		mpf.dataMap = make(map[string]string, len(mpf.dataMap))
 		mpf.fileSize = 0
 	} else if !e.FileCreated {
 		if _, err := f.Seek(mpf.fileSize, io.SeekStart); err != nil {
-			logger.Errorf("seek file %s error: %s", err)
+			logger.Errorf("seek file %s error: %s", filepath, err)
 			return
 		}
 	}
@@ -253,13 +540,17 @@ func readMappingFile(mpf *mappingFile, e file.FileEvent) {
 		if err == io.EOF {
 			break
 		}
-		kv := strings.Split(string(data), "=")
+		kv := strings.SplitN(string(data), "=", 2)
+		if len(kv) != 2 {
+			logger.Warnf("忽略不合法的数据: %s, file: %s", string(data), filepath)
+			continue
+		}
 		if _, ok := mpf.dataMap[kv[0]]; ok {
 			continue
 		}
 		mpf.dataMap[kv[0]] = kv[1]
 	}
-	mpf.fileSize += fileInfo.Size()
+	mpf.fileSize = fileInfo.Size()
 }
 
 func WatchBinDataDir(dir string) {
@@ -286,12 +577,8 @@ func registerFileHander() {
 		}
 	}()
 	for {
-		select {
-		case event := <-bankNameCnMapping.reloading:
-			refreshBankName(event)
-		case event := <-countryCnMapping.reloading:
-			refreshCountry(event)
-		}
+		event := <-mappingReloading
+		refreshMapping(event)
 	}
 }
 
@@ -301,8 +588,8 @@ func prepare(dir string) {
 		err       error
 	)
 	if filepaths, err = file.SearchDir(dir, func(filepath string) bool {
-		filename := path.Base(filepath)
-		return bankNameCnFileName == filename || countryCnFileName == filename
+		_, _, ok := parseMappingFileName(path.Base(filepath))
+		return ok
 	}); err != nil {
 		logger.Errorf("prepare data failed, error: %s", err)
 	}
@@ -312,13 +599,130 @@ func prepare(dir string) {
 	}
 }
 
-var watcher *fsnotify.Watcher
+var (
+	watcher *fsnotify.Watcher
+	//已监听的目录
+	watchedDirs  = make(map[string]bool)
+	watchedMutex sync.Mutex
+)
 
+//监听目录及其所有子目录, 已监听的目录及隐藏目录(如.git)跳过
 func addWatchDir(dir string) error {
-	if err := watcher.Add(dir); err != nil {
-		return err
+	if watcher == nil {
+		//未开启目录监听, 如离线命令行工具
+		return nil
+	}
+	dir = filepath.Clean(dir)
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			//遍历期间被删除的目录
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if p != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		watchedMutex.Lock()
+		defer watchedMutex.Unlock()
+		if watchedDirs[p] {
+			return nil
+		}
+		if err := watcher.Add(p); err != nil {
+			return err
+		}
+		watchedDirs[p] = true
+		logger.Infof("watching %s", p)
+		return nil
+	})
+}
+
+//目录被删除或移走时移除其及子目录的监听
+func removeWatchDir(dir string) {
+	dir = filepath.Clean(dir)
+	watchedMutex.Lock()
+	defer watchedMutex.Unlock()
+	for p := range watchedDirs {
+		if p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			//inotify在目录删除时已自动移除, 忽略错误
+			watcher.Remove(p)
+			delete(watchedDirs, p)
+			logger.Infof("unwatching %s", p)
+		}
+	}
+}
+
+func isWatchedDir(dir string) bool {
+	watchedMutex.Lock()
+	defer watchedMutex.Unlock()
+	return watchedDirs[filepath.Clean(dir)]
+}
+
+var (
+	//已分发事件的文件及分发时的修改时间
+	dispatchedFiles = make(map[string]time.Time)
+	dispatchedMutex sync.Mutex
+)
+
+//新目录中的文件可能同时被目录扫描和监听事件发现, 修改时间未变的文件不重复按新建处理
+func dispatchFileEvent(e file.FileEvent) {
+	if info, err := os.Stat(e.Filepath); err == nil && !markDispatched(e, info.ModTime()) {
+		logger.Infof("忽略已加载的文件: %s", e.Filepath)
+		return
+	}
+	readFromFile(e)
+	for _, l := range fileEventListenerList {
+		l(e)
+	}
+}
+
+//记录文件的修改时间, 新建事件的文件已按相同的修改时间分发过时返回false
+func markDispatched(e file.FileEvent, modTime time.Time) bool {
+	p := filepath.Clean(e.Filepath)
+	dispatchedMutex.Lock()
+	defer dispatchedMutex.Unlock()
+	if last, ok := dispatchedFiles[p]; ok && e.FileCreated && last.Equal(modTime) {
+		return false
+	}
+	dispatchedFiles[p] = modTime
+	return true
+}
+
+//文件或目录被删除或移走后, 同名文件再次创建时重新加载
+func forgetDispatched(name string) {
+	name = filepath.Clean(name)
+	dispatchedMutex.Lock()
+	defer dispatchedMutex.Unlock()
+	for p := range dispatchedFiles {
+		if p == name || strings.HasPrefix(p, name+string(filepath.Separator)) {
+			delete(dispatchedFiles, p)
+		}
+	}
+}
+
+//新目录可能在添加监听前已写入文件(如rsync), 按新建文件处理已存在的文件
+//write2File创建的目录在写入前已监听, 其中的文件会产生各自的事件, 不再重复处理
+func watchNewDir(dir string) {
+	if isWatchedDir(dir) || strings.HasPrefix(filepath.Base(dir), ".") {
+		return
+	}
+	if err := addWatchDir(dir); err != nil {
+		logger.Errorf("watch %s error: %s", dir, err)
+		return
+	}
+	filepaths, err := file.SearchDir(dir, func(string) bool { return true })
+	if err != nil {
+		logger.Errorf("search %s error: %s", dir, err)
+		return
+	}
+	for _, p := range filepaths {
+		logger.Infof("file found: %s", p)
+		dispatchFileEvent(file.FileEvent{Filepath: p, FileCreated: true})
 	}
-	return nil
 }
 
 func beginWatching(dir string) {
@@ -343,28 +747,32 @@ func beginWatching(dir string) {
 
 				if event.Op&fsnotify.Write == fsnotify.Write {
 					logger.Infof("file modified %s:", event.Name)
-					e := file.FileEvent{Filepath: event.Name, FileCreated: false}
-					readFromFile(e)
-					for _, l := range fileEventListenerList {
-						l(e)
-					}
+					dispatchFileEvent(file.FileEvent{Filepath: event.Name, FileCreated: false})
 				} else if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						logger.Infof("directory created %s:", event.Name)
+						watchNewDir(event.Name)
+						continue
+					}
 					logger.Infof("file created %s:", event.Name)
-					e := file.FileEvent{Filepath: event.Name, FileCreated: true}
-					readFromFile(e)
-					for _, l := range fileEventListenerList {
-						l(e)
+					dispatchFileEvent(file.FileEvent{Filepath: event.Name, FileCreated: true})
+				} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					forgetDispatched(event.Name)
+					if isWatchedDir(event.Name) {
+						logger.Infof("directory removed %s:", event.Name)
+						removeWatchDir(event.Name)
 					}
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
 				}
-				logger.Error("watch %s error:%s", dir, err)
+				logger.Errorf("watch %s error:%s", dir, err)
 			}
 		}
 	}()
 
+	//包括已存在的子目录
 	if err = addWatchDir(dir); err != nil {
 		logger.Error(err)
 	}
@@ -0,0 +1,246 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"kidshelloworld.com/bindb/file"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//使用独立的内存数据库替换当前数据库, 数据写入临时目录
+func useTestMemory(t *testing.T) *memoryDatabase {
+	t.Helper()
+	savedMemory, savedDatabase := memory, currentBinDatabase
+	t.Cleanup(func() { memory, currentBinDatabase = savedMemory, savedDatabase })
+	memory = newMemoryDatabase()
+	memory.dataDir = t.TempDir()
+	currentBinDatabase = memory
+	return memory
+}
+
+//使用独立的重叠冲突记录
+func useTestOverlaps(t *testing.T) {
+	t.Helper()
+	saved := overlaps
+	t.Cleanup(func() { overlaps = saved })
+	overlaps = &overlapReport{conflicts: make(map[[2]int64]*mod.OverlapConflict)}
+}
+
+//加载覆盖400000-400099的基础数据, id为1
+func loadTestBaseRange(t *testing.T, m *memoryDatabase) {
+	t.Helper()
+	data, err := parse("1,400000,400099,,,visa,,credit,,US,BASE BANK,,,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.saveParsed(filepath.Join(m.dataDir, baseDataFileName), 2, data, false)
+}
+
+func TestSaveBinData(t *testing.T) {
+	cases := []struct {
+		name        string
+		bin         uint32
+		id          int64
+		approximate bool
+		saved       bool
+		winner      int64
+		conflict    bool
+	}{
+		{"new bin", 500000, 2, false, true, 2, false},
+		{"exact data exists", 400050, 2, false, false, 1, true},
+		{"same id", 400050, 1, false, false, 1, false},
+		{"approximate", 400050, 2, true, false, 1, false},
+	}
+	for _, c := range cases {
+		useTestOverlaps(t)
+		m := useTestMemory(t)
+		loadTestBaseRange(t, m)
+
+		seq := feed.seq
+		bindata := mod.BinData{Id: c.id, IinStart: c.bin, IinEnd: c.bin, BaseBinData: mod.BaseBinData{BankName: "FEEDBACK BANK"}}
+		saved, err := saveBinData(mod.Actor{ClientIp: "127.0.0.1"}, c.bin, bindata, c.approximate)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if saved != c.saved {
+			t.Errorf("%s: saved %v, want %v", c.name, saved, c.saved)
+		}
+		//未保存时不写入数据文件, 不记录审计日志及事件
+		if entries, _ := os.ReadDir(m.dataDir); (len(entries) > 0) != c.saved {
+			t.Errorf("%s: %d entries in data dir", c.name, len(entries))
+		}
+		if published := feed.seq != seq; published != c.saved {
+			t.Errorf("%s: published %v, want %v", c.name, published, c.saved)
+		} else if published && feed.events[len(feed.events)-1].Type != AuditActionBinCreate {
+			t.Errorf("%s: event %s", c.name, feed.events[len(feed.events)-1].Type)
+		}
+		if d, err := m.ReadExact(c.bin); err != nil || d.Id != c.winner {
+			t.Errorf("%s: winner %d, %v, want %d", c.name, d.Id, err, c.winner)
+		}
+		if conflict := len(overlaps.conflicts) > 0; conflict != c.conflict {
+			t.Errorf("%s: conflict %v, want %v", c.name, conflict, c.conflict)
+		}
+	}
+}
+
+func TestReplaceBinData(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   string
+		priority []string
+		bin      uint32
+		id       int64
+		saved    bool
+		winner   int64
+		conflict bool
+		event    string
+	}{
+		{"new bin", OverlapPolicyMostSpecific, nil, 500000, 2, true, 2, false, AuditActionBinCreate},
+		{"more specific", OverlapPolicyMostSpecific, nil, 400050, 2, true, 2, true, AuditActionBinUpdate},
+		{"kept by source priority", OverlapPolicySourcePriority, []string{SourceKindBase}, 400050, 2, false, 1, true, ""},
+		{"same id", OverlapPolicyMostSpecific, nil, 400050, 1, false, 1, false, ""},
+	}
+	for _, c := range cases {
+		useOverlapPolicy(t, c.policy, c.priority...)
+		useTestOverlaps(t)
+		m := useTestMemory(t)
+		loadTestBaseRange(t, m)
+
+		seq := feed.seq
+		bindata := mod.BinData{Id: c.id, IinStart: c.bin, IinEnd: c.bin, BaseBinData: mod.BaseBinData{BankName: "FEEDBACK BANK"}}
+		saved, err := replaceBinData(mod.Actor{ClientIp: "127.0.0.1"}, c.bin, bindata)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if saved != c.saved {
+			t.Errorf("%s: saved %v, want %v", c.name, saved, c.saved)
+		}
+		//已有数据优先时在写入前判断, 数据文件中没有落选的数据
+		if entries, _ := os.ReadDir(m.dataDir); (len(entries) > 0) != c.saved {
+			t.Errorf("%s: %d entries in data dir", c.name, len(entries))
+		}
+		if published := feed.seq != seq; published != c.saved {
+			t.Errorf("%s: published %v, want %v", c.name, published, c.saved)
+		} else if published && feed.events[len(feed.events)-1].Type != c.event {
+			t.Errorf("%s: event %s, want %s", c.name, feed.events[len(feed.events)-1].Type, c.event)
+		}
+		if d, err := m.ReadExact(c.bin); err != nil || d.Id != c.winner {
+			t.Errorf("%s: winner %d, %v, want %d", c.name, d.Id, err, c.winner)
+		}
+		if conflict := len(overlaps.conflicts) > 0; conflict != c.conflict {
+			t.Errorf("%s: conflict %v, want %v", c.name, conflict, c.conflict)
+		}
+	}
+}
+
+func TestReplaceBinDataUnsupported(t *testing.T) {
+	saved := currentBinDatabase
+	t.Cleanup(func() { currentBinDatabase = saved })
+	currentBinDatabase = &sqlDatabase{}
+	if _, err := replaceBinData(mod.Actor{}, 400000, mod.BinData{Id: 1}); err == nil {
+		t.Error("replace on sql database should fail")
+	}
+}
+
+//使用新的目录监听, 并记录分发的文件事件
+func useTestWatcher(t *testing.T) *[]file.FileEvent {
+	t.Helper()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedListeners, savedDispatched := fileEventListenerList, dispatchedFiles
+	t.Cleanup(func() {
+		w.Close()
+		watcher, watchedDirs, fileEventListenerList, dispatchedFiles = nil, make(map[string]bool), savedListeners, savedDispatched
+	})
+	watcher, watchedDirs, dispatchedFiles = w, make(map[string]bool), make(map[string]time.Time)
+	events := &[]file.FileEvent{}
+	fileEventListenerList = []fileEventListener{func(e file.FileEvent) { *events = append(*events, e) }}
+	return events
+}
+
+func TestWatchDirs(t *testing.T) {
+	events := useTestWatcher(t)
+	dir := t.TempDir()
+	for _, sub := range []string{"20190601", "vendor/a", ".git/objects"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addWatchDir(dir + "/"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		dir     string
+		watched bool
+	}{
+		{dir, true},
+		{dir + "/./20190601/", true},
+		{filepath.Join(dir, "vendor", "a"), true},
+		{filepath.Join(dir, ".git"), false},
+		{filepath.Join(dir, ".git", "objects"), false},
+	}
+	for _, c := range cases {
+		if got := isWatchedDir(c.dir); got != c.watched {
+			t.Errorf("%s: watched %v, want %v", c.dir, got, c.watched)
+		}
+	}
+
+	removeWatchDir(dir + "/vendor/")
+	if isWatchedDir(filepath.Join(dir, "vendor")) || isWatchedDir(filepath.Join(dir, "vendor", "a")) {
+		t.Error("vendor still watched after remove")
+	}
+	if !isWatchedDir(dir) {
+		t.Error("parent unwatched by removing child")
+	}
+
+	//write2File创建的目录已监听, 不重复分发其中的文件
+	writeDataFile(t, filepath.Join(dir, "20190601", "bindata.bd"), "1,400000,,,,visa,,credit,,US,TEST BANK,,,,")
+	watchNewDir(filepath.Join(dir, "20190601"))
+	if len(*events) != 0 {
+		t.Errorf("dispatched %+v for watched dir", *events)
+	}
+	//移入的新目录按新建文件处理已存在的文件
+	writeDataFile(t, filepath.Join(dir, "20190602", "bindata.bd"), "2,400001,,,,visa,,credit,,US,TEST BANK,,,,")
+	watchNewDir(filepath.Join(dir, "20190602"))
+	if len(*events) != 1 || !(*events)[0].FileCreated || (*events)[0].Filepath != filepath.Join(dir, "20190602", "bindata.bd") {
+		t.Errorf("events %+v", *events)
+	}
+}
+
+func TestDispatchFileEventOnce(t *testing.T) {
+	events := useTestWatcher(t)
+	dir := filepath.Join(t.TempDir(), "20190603")
+	p := filepath.Join(dir, "bindata.bd")
+	writeDataFile(t, p, "3,400002,,,,visa,,credit,,US,TEST BANK,,,,")
+	//目录扫描已分发, 之后到达的新建事件不再重复加载
+	watchNewDir(dir)
+	dispatchFileEvent(file.FileEvent{Filepath: p, FileCreated: true})
+	if len(*events) != 1 {
+		t.Fatalf("events %+v", *events)
+	}
+	//修改事件按加载的偏移量继续读取, 始终分发
+	dispatchFileEvent(file.FileEvent{Filepath: p, FileCreated: false})
+	if len(*events) != 2 {
+		t.Fatalf("events %+v", *events)
+	}
+	//删除后同名文件再次创建
+	forgetDispatched(dir)
+	dispatchFileEvent(file.FileEvent{Filepath: p, FileCreated: true})
+	if len(*events) != 3 {
+		t.Fatalf("events %+v", *events)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	dispatchFileEvent(file.FileEvent{Filepath: p, FileCreated: true})
+	if len(*events) != 4 {
+		t.Errorf("events %+v", *events)
+	}
+}
@@ -0,0 +1,582 @@
+package bdata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/mod"
+)
+
+var (
+	replicationLogFileName        = "replication.log"
+	replicationStateFileName      = "replication.state"
+	replicationCheckpointFileName = "replication.checkpoint"
+	//节点接收复制记录的接口
+	ReplicationApplyPath = "/bindb/admin/replication/apply"
+	//默认的同步间隔, 同步失败时按指数退避, 最长为maxReplicationBackoff
+	DefaultReplicationInterval = 5 * time.Second
+	maxReplicationBackoff      = 5 * time.Minute
+	replicationBatchSize       = 500
+	//所有节点都已应用的记录超过该数量时压缩复制日志
+	replicationCompactSize = 1000
+)
+
+//ReplicationEntry 本节点产生的一次写入, Seq在节点内递增
+type ReplicationEntry struct {
+	Seq    int64     `json:"seq"`
+	Origin string    `json:"origin"`
+	Time   time.Time `json:"time"`
+	//与审计日志的action一致
+	Action string `json:"action"`
+	//bin或映射的key
+	Key  string       `json:"key"`
+	Name string       `json:"name,omitempty"`
+	Data *mod.BinData `json:"data,omitempty"`
+}
+
+//ReplicationBatch 推送给其他节点的一批记录, Entries为空时只查询对方的进度
+type ReplicationBatch struct {
+	Origin  string             `json:"origin"`
+	Entries []ReplicationEntry `json:"entries"`
+}
+
+//ReplicationAck 接收方已应用的该来源的最大序号
+type ReplicationAck struct {
+	Origin  string `json:"origin"`
+	Applied int64  `json:"applied"`
+}
+
+//ReplicationPeerStatus 推送到某个节点的进度
+type ReplicationPeerStatus struct {
+	Peer      string    `json:"peer"`
+	Acked     int64     `json:"acked"`
+	LastSync  time.Time `json:"last_sync"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+//ReplicationStatus 本节点的复制状态
+type ReplicationStatus struct {
+	NodeId string `json:"node_id"`
+	Seq    int64  `json:"seq"`
+	//已从复制日志中删除的最大序号
+	Compacted int64                   `json:"compacted"`
+	Applied   map[string]int64        `json:"applied"`
+	Peers     []ReplicationPeerStatus `json:"peers"`
+}
+
+//ReplicationConfig 复制配置, 节点之间需要全连接, 从其他节点收到的记录不会再转发
+type ReplicationConfig struct {
+	//节点标识, 重启后需保持不变
+	NodeId string
+	//其他节点的地址, 如http://10.0.0.2:8080
+	Peers []string
+	//复制日志及进度所在的目录
+	Dir string
+	//同步间隔, 写入时会立即推送
+	Interval time.Duration
+}
+
+//ReplicationTransport 将记录推送到节点, 返回对方的进度
+type ReplicationTransport interface {
+	Push(peer string, batch ReplicationBatch) (ReplicationAck, error)
+}
+
+//ReplicationApplier 应用其他节点的记录, 需要是幂等的
+type ReplicationApplier func(entry ReplicationEntry) error
+
+type replicationPeer struct {
+	url    string
+	notify chan struct{}
+	//对方已应用的序号, 为-1时表示未知, 需先查询
+	acked     int64
+	lastSync  time.Time
+	lastError string
+}
+
+//Replicator 节点之间的feedback复制
+//本节点的写入记录在复制日志中, 按序号推送给各节点, 对方返回已应用的序号, 重连后从该序号继续推送
+//所有节点都已应用的记录会从复制日志中删除, checkpoint文件记录删除的最大序号
+type Replicator struct {
+	mutex          sync.Mutex
+	applyMutex     sync.Mutex
+	nodeId         string
+	interval       time.Duration
+	transport      ReplicationTransport
+	applier        ReplicationApplier
+	logPath        string
+	statePath      string
+	checkpointPath string
+	logFile        *os.File
+	entries        []ReplicationEntry
+	seq            int64
+	compacted      int64
+	applied        map[string]int64
+	peers          []*replicationPeer
+	stop           chan struct{}
+	wg             sync.WaitGroup
+}
+
+//NewReplicator 创建复制器, 读取已有的复制日志及进度
+func NewReplicator(cfg ReplicationConfig, transport ReplicationTransport, applier ReplicationApplier) (*Replicator, error) {
+	if cfg.NodeId == "" {
+		return nil, errors.New("节点标识未配置")
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("存储地址未配置")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultReplicationInterval
+	}
+	r := &Replicator{
+		nodeId:         cfg.NodeId,
+		interval:       cfg.Interval,
+		transport:      transport,
+		applier:        applier,
+		logPath:        strings.Join([]string{cfg.Dir, replicationLogFileName}, "/"),
+		statePath:      strings.Join([]string{cfg.Dir, replicationStateFileName}, "/"),
+		checkpointPath: strings.Join([]string{cfg.Dir, replicationCheckpointFileName}, "/"),
+		applied:        make(map[string]int64),
+		stop:           make(chan struct{})}
+	for _, peer := range cfg.Peers {
+		if peer = strings.TrimRight(strings.TrimSpace(peer), "/"); peer != "" {
+			r.peers = append(r.peers, &replicationPeer{url: peer, notify: make(chan struct{}, 1), acked: -1})
+		}
+	}
+
+	var err error
+	if err = r.readLog(); err != nil {
+		return nil, err
+	}
+	if err = r.readState(); err != nil {
+		return nil, err
+	}
+	if r.logFile, err = os.OpenFile(r.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Replicator) readLog() error {
+	var err error
+	if r.compacted, err = readCheckpoint(r.checkpointPath); err != nil {
+		return err
+	}
+	r.seq = r.compacted
+	file, err := os.Open(r.logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e ReplicationEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			//写入时崩溃导致的不完整行
+			logger.Warnf("忽略无法解析的复制记录, %s: %s", r.logPath, err)
+			continue
+		}
+		//压缩时写入checkpoint后, 重写日志前崩溃
+		if e.Seq <= r.compacted {
+			continue
+		}
+		r.entries = append(r.entries, e)
+		if e.Seq > r.seq {
+			r.seq = e.Seq
+		}
+	}
+	return scanner.Err()
+}
+
+func (r *Replicator) readState() error {
+	data, err := ioutil.ReadFile(r.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &r.applied)
+}
+
+func (r *Replicator) writeState() error {
+	data, err := json.Marshal(r.applied)
+	if err != nil {
+		return err
+	}
+	tmp := r.statePath + ".tmp"
+	if err = writeLines(tmp, []string{string(data)}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.statePath)
+}
+
+//Start 为每个节点启动推送
+func (r *Replicator) Start() {
+	for _, p := range r.peers {
+		r.wg.Add(1)
+		go r.run(p)
+	}
+}
+
+//Stop 停止推送并关闭复制日志
+func (r *Replicator) Stop() error {
+	close(r.stop)
+	r.wg.Wait()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.logFile.Close()
+}
+
+//Record 记录本节点的一次写入并通知推送
+func (r *Replicator) Record(action, key, name string, data *mod.BinData) error {
+	r.mutex.Lock()
+	entry := ReplicationEntry{Seq: r.seq + 1, Origin: r.nodeId, Time: time.Now().UTC(), Action: action, Key: key, Name: name, Data: data}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		if _, err = r.logFile.Write(append(line, '\n')); err == nil {
+			err = r.logFile.Sync()
+		}
+	}
+	if err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	r.seq = entry.Seq
+	r.entries = append(r.entries, entry)
+	r.compactLog()
+	r.mutex.Unlock()
+
+	for _, p := range r.peers {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+//Apply 按序号应用其他节点推送的记录, 已应用的序号会跳过, 应用失败时返回已应用的进度
+func (r *Replicator) Apply(batch ReplicationBatch) (ReplicationAck, error) {
+	r.applyMutex.Lock()
+	defer r.applyMutex.Unlock()
+	if batch.Origin == "" || batch.Origin == r.nodeId {
+		return ReplicationAck{}, errors.New(fmt.Sprintf("非法的来源节点 %s", batch.Origin))
+	}
+
+	r.mutex.Lock()
+	applied := r.applied[batch.Origin]
+	r.mutex.Unlock()
+	ack := ReplicationAck{Origin: batch.Origin, Applied: applied}
+
+	var err error
+	for _, e := range batch.Entries {
+		if e.Seq <= ack.Applied {
+			continue
+		}
+		if err = r.applier(e); err != nil {
+			err = errors.New(fmt.Sprintf("apply %s #%d: %s", e.Origin, e.Seq, err))
+			break
+		}
+		ack.Applied = e.Seq
+	}
+	if ack.Applied != applied {
+		r.mutex.Lock()
+		r.applied[batch.Origin] = ack.Applied
+		stateErr := r.writeState()
+		r.mutex.Unlock()
+		if stateErr != nil {
+			logger.Errorf("写入复制进度失败: %s", stateErr)
+		}
+	}
+	return ack, err
+}
+
+//Status 本节点的复制状态
+func (r *Replicator) Status() ReplicationStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	status := ReplicationStatus{NodeId: r.nodeId, Seq: r.seq, Compacted: r.compacted, Applied: make(map[string]int64, len(r.applied))}
+	for origin, seq := range r.applied {
+		status.Applied[origin] = seq
+	}
+	for _, p := range r.peers {
+		status.Peers = append(status.Peers, ReplicationPeerStatus{Peer: p.url, Acked: p.acked, LastSync: p.lastSync, LastError: p.lastError})
+	}
+	return status
+}
+
+//推送循环, 写入时立即推送, 否则按间隔同步, 失败时指数退避
+func (r *Replicator) run(p *replicationPeer) {
+	defer r.wg.Done()
+	var (
+		wait    time.Duration
+		backoff = r.interval
+	)
+	for {
+		//失败期间不响应写入通知, 避免频繁请求不可用的节点
+		notify := p.notify
+		if backoff > r.interval {
+			notify = nil
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-notify:
+		case <-time.After(wait):
+		}
+		if err := r.sync(p); err != nil {
+			logger.Warnf("replicate to %s error: %s", p.url, err)
+			if backoff *= 2; backoff > maxReplicationBackoff {
+				backoff = maxReplicationBackoff
+			}
+			wait = backoff
+			continue
+		}
+		backoff = r.interval
+		wait = r.interval
+	}
+}
+
+//推送对方未应用的记录, 直到追上本节点的进度
+func (r *Replicator) sync(p *replicationPeer) error {
+	for {
+		r.mutex.Lock()
+		acked := p.acked
+		//对方的复制进度丢失时, 需要推送的记录可能已从复制日志中删除
+		if acked >= 0 && acked < r.compacted {
+			err := errors.New(fmt.Sprintf("节点进度 %d 早于复制日志中已删除的序号 %d, 需要全量同步", acked, r.compacted))
+			p.lastError = err.Error()
+			r.mutex.Unlock()
+			return err
+		}
+		var batch []ReplicationEntry
+		if acked >= 0 {
+			batch = r.entriesAfter(acked)
+		}
+		r.mutex.Unlock()
+		if acked >= 0 && len(batch) == 0 {
+			return nil
+		}
+
+		ack, err := r.transport.Push(p.url, ReplicationBatch{Origin: r.nodeId, Entries: batch})
+		r.mutex.Lock()
+		if ack.Origin == r.nodeId {
+			p.acked = ack.Applied
+			//复制日志丢失时, 对方的进度可能大于本节点的序号, 之后的记录从对方的进度开始编号
+			if ack.Applied > r.seq {
+				logger.Warnf("节点 %s 已应用序号 %d, 大于本节点的序号 %d", p.url, ack.Applied, r.seq)
+				r.seq = ack.Applied
+			}
+			r.compactLog()
+		}
+		if err != nil {
+			p.lastError = err.Error()
+		} else {
+			p.lastSync = time.Now()
+			p.lastError = ""
+		}
+		r.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		if len(batch) > 0 && ack.Applied < batch[0].Seq {
+			return errors.New(fmt.Sprintf("节点未应用记录, 进度 %d", ack.Applied))
+		}
+	}
+}
+
+//删除所有节点都已应用的记录, 需持有mutex
+//有节点的进度未知(重启后尚未查询)时不压缩, 可删除的记录少于replicationCompactSize时不压缩
+func (r *Replicator) compactLog() {
+	upTo := r.seq
+	for _, p := range r.peers {
+		if p.acked < 0 {
+			return
+		}
+		if p.acked < upTo {
+			upTo = p.acked
+		}
+	}
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].Seq > upTo })
+	if i == 0 || i < replicationCompactSize {
+		return
+	}
+	if err := r.rewriteLog(upTo, r.entries[i:]); err != nil {
+		logger.Errorf("压缩复制日志失败: %s", err)
+		return
+	}
+	r.entries = append([]ReplicationEntry(nil), r.entries[i:]...)
+	r.compacted = upTo
+}
+
+//先写checkpoint再重写复制日志, 替换失败时继续追加到原文件
+func (r *Replicator) rewriteLog(checkpoint int64, entries []ReplicationEntry) error {
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(line))
+	}
+	if err := writeCheckpoint(r.checkpointPath, checkpoint); err != nil {
+		return err
+	}
+	tmp := r.logPath + ".tmp"
+	if err := writeLines(tmp, lines); err != nil {
+		return err
+	}
+	r.logFile.Close()
+	renameErr := os.Rename(tmp, r.logPath)
+	var err error
+	if r.logFile, err = os.OpenFile(r.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+//序号大于seq的记录, 最多replicationBatchSize条
+func (r *Replicator) entriesAfter(seq int64) []ReplicationEntry {
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].Seq > seq })
+	end := i + replicationBatchSize
+	if end > len(r.entries) {
+		end = len(r.entries)
+	}
+	return append([]ReplicationEntry(nil), r.entries[i:end]...)
+}
+
+//通过http推送, 使用管理接口的key鉴权
+type httpReplicationTransport struct {
+	client   *http.Client
+	adminKey string
+}
+
+//NewHttpReplicationTransport 推送到其他节点的ReplicationApplyPath
+func NewHttpReplicationTransport(client *http.Client, adminKey string) ReplicationTransport {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &httpReplicationTransport{client: client, adminKey: adminKey}
+}
+
+func (t *httpReplicationTransport) Push(peer string, batch ReplicationBatch) (ReplicationAck, error) {
+	var ack ReplicationAck
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return ack, err
+	}
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPost, peer+ReplicationApplyPath, bytes.NewReader(body)); err != nil {
+		return ack, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.adminKey != "" {
+		req.Header.Set("X-Admin-Key", t.adminKey)
+	}
+	var resp *http.Response
+	if resp, err = t.client.Do(req); err != nil {
+		return ack, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ack, errors.New(fmt.Sprintf("http status %d", resp.StatusCode))
+	}
+	result := mod.ResponseData{Data: &ack}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ack, err
+	}
+	if result.Code != mod.ResponseCodeSuccess {
+		return ack, errors.New(result.Msg)
+	}
+	return ack, nil
+}
+
+//应用到当前数据库
+func applyReplicationEntry(e ReplicationEntry) error {
+	actor := mod.Actor{Endpoint: "replication:" + e.Origin}
+	switch e.Action {
+	case AuditActionBinCreate, AuditActionBinCreateApproximate:
+		if e.Data == nil {
+			return errors.New("缺少bin数据")
+		}
+		bin, err := bin2Uint32(e.Key)
+		if err != nil {
+			return err
+		}
+		_, err = saveBinData(actor, bin, *e.Data, e.Action == AuditActionBinCreateApproximate)
+		return err
+	case AuditActionBinUpdate:
+		if e.Data == nil {
+			return errors.New("缺少bin数据")
+		}
+		bin, err := bin2Uint32(e.Key)
+		if err != nil {
+			return err
+		}
+		//本地重叠策略下已有数据优先时不替换
+		_, err = replaceBinData(actor, bin, *e.Data)
+		return err
+	case AuditActionBankNameCreate:
+		_, err := createBankNameMapping(actor, e.Key, e.Name)
+		return err
+	case AuditActionCountryNameCreate:
+		_, err := createCountryCnNameMapping(actor, e.Key, e.Name)
+		return err
+	}
+	return errors.New(fmt.Sprintf("unknown action %s", e.Action))
+}
+
+var currentReplicator *Replicator
+
+//StartReplication 启动当前数据库的复制, 需在SetBinDatabaseMode之后调用
+func StartReplication(cfg ReplicationConfig, adminKey string) error {
+	r, err := NewReplicator(cfg, NewHttpReplicationTransport(nil, adminKey), applyReplicationEntry)
+	if err != nil {
+		return err
+	}
+	currentReplicator = r
+	r.Start()
+	logger.Infof("复制已启动, node: %s, peers: %v", cfg.NodeId, cfg.Peers)
+	return nil
+}
+
+//本节点的写入加入复制日志
+func replicate(action, key, name string, data *mod.BinData) {
+	if currentReplicator == nil {
+		return
+	}
+	if err := currentReplicator.Record(action, key, name, data); err != nil {
+		logger.Errorf("写入复制日志失败, error: %s, action: %s, key: %s", err, action, key)
+	}
+}
+
+//ApplyReplication 应用其他节点推送的记录
+func ApplyReplication(batch ReplicationBatch) (ReplicationAck, error) {
+	if currentReplicator == nil {
+		return ReplicationAck{}, errors.New("复制未启用")
+	}
+	return currentReplicator.Apply(batch)
+}
+
+//CurrentReplicationStatus 本节点的复制状态
+func CurrentReplicationStatus() (ReplicationStatus, error) {
+	if currentReplicator == nil {
+		return ReplicationStatus{}, errors.New("复制未启用")
+	}
+	return currentReplicator.Status(), nil
+}
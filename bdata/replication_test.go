@@ -0,0 +1,336 @@
+package bdata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//内存中的推送, 直接调用对方节点的Apply
+type memReplicationTransport struct {
+	mutex   sync.Mutex
+	nodes   map[string]*Replicator
+	offline map[string]bool
+}
+
+func (t *memReplicationTransport) Push(peer string, batch ReplicationBatch) (ReplicationAck, error) {
+	t.mutex.Lock()
+	node, offline := t.nodes[peer], t.offline[peer]
+	t.mutex.Unlock()
+	if node == nil || offline {
+		return ReplicationAck{}, errors.New("connection refused")
+	}
+	return node.Apply(batch)
+}
+
+func (t *memReplicationTransport) setOffline(peer string, offline bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.offline[peer] = offline
+}
+
+//记录各节点应用的记录
+type memApplier struct {
+	mutex   sync.Mutex
+	entries []ReplicationEntry
+}
+
+func (a *memApplier) apply(e ReplicationEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.entries = append(a.entries, e)
+	return nil
+}
+
+func (a *memApplier) count() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.entries)
+}
+
+type replicationCluster struct {
+	transport *memReplicationTransport
+	nodes     map[string]*Replicator
+	appliers  map[string]*memApplier
+	dirs      map[string]string
+}
+
+func newReplicationCluster(t *testing.T, ids ...string) *replicationCluster {
+	t.Helper()
+	c := &replicationCluster{
+		transport: &memReplicationTransport{nodes: make(map[string]*Replicator), offline: make(map[string]bool)},
+		nodes:     make(map[string]*Replicator),
+		appliers:  make(map[string]*memApplier),
+		dirs:      make(map[string]string)}
+	for _, id := range ids {
+		var peers []string
+		for _, other := range ids {
+			if other != id {
+				peers = append(peers, other)
+			}
+		}
+		c.dirs[id] = t.TempDir()
+		c.appliers[id] = &memApplier{}
+		r, err := NewReplicator(ReplicationConfig{NodeId: id, Peers: peers, Dir: c.dirs[id], Interval: 10 * time.Millisecond},
+			c.transport, c.appliers[id].apply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.nodes[id] = r
+		c.transport.nodes[id] = r
+	}
+	return c
+}
+
+func (c *replicationCluster) start() {
+	for _, r := range c.nodes {
+		r.Start()
+	}
+}
+
+func (c *replicationCluster) stop(t *testing.T) {
+	for id, r := range c.nodes {
+		if err := r.Stop(); err != nil {
+			t.Errorf("stop %s: %s", id, err)
+		}
+	}
+}
+
+func TestReplicationCatchUp(t *testing.T) {
+	c := newReplicationCluster(t, "a", "b", "c")
+	c.transport.setOffline("c", true)
+	c.start()
+	defer c.stop(t)
+
+	for _, key := range []string{"400000", "400001", "400002"} {
+		if err := c.nodes["a"].Record(AuditActionBinCreate, key, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "b to apply", func() bool { return c.appliers["b"].count() == 3 })
+	if n := c.appliers["c"].count(); n != 0 {
+		t.Fatalf("offline node applied %d entries", n)
+	}
+
+	//节点恢复后从已应用的进度继续推送
+	c.transport.setOffline("c", false)
+	waitFor(t, "c to catch up", func() bool { return c.appliers["c"].count() == 3 })
+	for i, e := range c.appliers["c"].entries {
+		if e.Origin != "a" || e.Seq != int64(i+1) {
+			t.Errorf("entry %d: %s #%d", i, e.Origin, e.Seq)
+		}
+	}
+	waitFor(t, "acks", func() bool {
+		for _, p := range c.nodes["a"].Status().Peers {
+			if p.Acked != 3 || p.LastError != "" {
+				return false
+			}
+		}
+		return true
+	})
+	if applied := c.nodes["c"].Status().Applied["a"]; applied != 3 {
+		t.Errorf("c applied %d, want 3", applied)
+	}
+}
+
+func TestReplicationApplyIgnoresDelivered(t *testing.T) {
+	c := newReplicationCluster(t, "a", "b")
+	defer c.stop(t)
+	b := c.nodes["b"]
+	entries := []ReplicationEntry{{Seq: 1, Origin: "a"}, {Seq: 2, Origin: "a"}, {Seq: 3, Origin: "a"}}
+
+	cases := []struct {
+		name    string
+		entries []ReplicationEntry
+		applied int64
+		count   int
+	}{
+		{"first delivery", entries[:2], 2, 2},
+		{"redelivery", entries[:2], 2, 2},
+		{"overlapping", entries, 3, 3},
+		{"progress query", nil, 3, 3},
+	}
+	for _, tc := range cases {
+		ack, err := b.Apply(ReplicationBatch{Origin: "a", Entries: tc.entries})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if ack.Origin != "a" || ack.Applied != tc.applied {
+			t.Errorf("%s: ack %+v, want applied %d", tc.name, ack, tc.applied)
+		}
+		if n := c.appliers["b"].count(); n != tc.count {
+			t.Errorf("%s: applied %d entries, want %d", tc.name, n, tc.count)
+		}
+	}
+
+	if _, err := b.Apply(ReplicationBatch{Origin: "b", Entries: entries}); err == nil {
+		t.Error("batch from self accepted")
+	}
+
+	//进度持久化, 重启后不重复应用
+	if err := b.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	applier := &memApplier{}
+	reopened, err := NewReplicator(ReplicationConfig{NodeId: "b", Peers: []string{"a"}, Dir: c.dirs["b"]}, c.transport, applier.apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.nodes["b"] = reopened
+	if ack, _ := reopened.Apply(ReplicationBatch{Origin: "a", Entries: entries}); ack.Applied != 3 || applier.count() != 0 {
+		t.Errorf("after restart ack %d, applied %d entries", ack.Applied, applier.count())
+	}
+}
+
+func TestReplicationPeerAheadOfLog(t *testing.T) {
+	c := newReplicationCluster(t, "a", "b")
+	defer c.stop(t)
+	//a的复制日志丢失, b已应用到7
+	var lost []ReplicationEntry
+	for seq := int64(1); seq <= 7; seq++ {
+		lost = append(lost, ReplicationEntry{Seq: seq, Origin: "a"})
+	}
+	if _, err := c.nodes["b"].Apply(ReplicationBatch{Origin: "a", Entries: lost}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := c.nodes["a"]
+	if err := a.sync(a.peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status(); status.Seq != 7 || status.Peers[0].Acked != 7 {
+		t.Fatalf("status %+v, want seq and acked 7", status)
+	}
+	if err := a.Record(AuditActionBinCreate, "400000", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.sync(a.peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	applier := c.appliers["b"]
+	if n := applier.count(); n != 8 || applier.entries[7].Seq != 8 {
+		t.Fatalf("b applied %d entries, last %+v", n, applier.entries[n-1])
+	}
+}
+
+func TestReplicationStop(t *testing.T) {
+	c := newReplicationCluster(t, "a", "b")
+	c.transport.setOffline("b", true)
+	a := c.nodes["a"]
+	a.Start()
+	if err := a.Record(AuditActionBinCreate, "400000", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	//等待进入退避
+	waitFor(t, "push failure", func() bool { return a.Status().Peers[0].LastError != "" })
+
+	done := make(chan error, 1)
+	go func() { done <- a.Stop() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop blocked")
+	}
+	if err := a.Record(AuditActionBinCreate, "400001", "", nil); err == nil {
+		t.Error("record after stop succeeded")
+	}
+	if err := c.nodes["b"].Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重启后从复制日志恢复序号
+	reopened, err := NewReplicator(ReplicationConfig{NodeId: "a", Dir: c.dirs["a"]}, c.transport, c.appliers["a"].apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Stop()
+	if seq := reopened.Status().Seq; seq != 1 {
+		t.Errorf("seq after restart %d, want 1", seq)
+	}
+}
+
+func TestReplicationCompactLog(t *testing.T) {
+	saved := replicationCompactSize
+	t.Cleanup(func() { replicationCompactSize = saved })
+	replicationCompactSize = 2
+
+	c := newReplicationCluster(t, "a", "b")
+	a := c.nodes["a"]
+	for _, key := range []string{"400000", "400001", "400002"} {
+		if err := a.Record(AuditActionBinCreate, key, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//节点进度未知时不压缩
+	if compacted := a.Status().Compacted; compacted != 0 {
+		t.Fatalf("compacted %d before sync", compacted)
+	}
+	if err := a.sync(a.peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status(); status.Compacted != 3 || len(a.entries) != 0 {
+		t.Errorf("compacted %d, %d entries", status.Compacted, len(a.entries))
+	}
+	if content, _ := os.ReadFile(filepath.Join(c.dirs["a"], replicationLogFileName)); len(content) != 0 {
+		t.Errorf("log after compaction %q", content)
+	}
+	//可删除的记录少于replicationCompactSize时保留
+	if err := a.Record(AuditActionBinCreate, "400003", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.sync(a.peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	c.stop(t)
+
+	//重启后序号从checkpoint继续
+	reopened, err := NewReplicator(ReplicationConfig{NodeId: "a", Peers: []string{"b"}, Dir: c.dirs["a"]}, c.transport, c.appliers["a"].apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Stop()
+	if status := reopened.Status(); status.Seq != 4 || status.Compacted != 3 || len(reopened.entries) != 1 {
+		t.Errorf("after restart seq %d, compacted %d, %d entries", status.Seq, status.Compacted, len(reopened.entries))
+	}
+
+	//对方的复制进度丢失时, 已删除的记录无法再推送
+	lost, err := NewReplicator(ReplicationConfig{NodeId: "b", Peers: []string{"a"}, Dir: t.TempDir()}, c.transport, c.appliers["b"].apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lost.Stop()
+	c.transport.nodes["b"] = lost
+	if err = reopened.sync(reopened.peers[0]); err == nil || !strings.Contains(err.Error(), "全量同步") {
+		t.Errorf("sync to node with lost state: %v", err)
+	}
+	if n := c.appliers["b"].count(); n != 4 {
+		t.Errorf("b applied %d entries, want 4", n)
+	}
+}
+
+func TestReplicationCompactWithoutPeers(t *testing.T) {
+	saved := replicationCompactSize
+	t.Cleanup(func() { replicationCompactSize = saved })
+	replicationCompactSize = 2
+
+	r, err := NewReplicator(ReplicationConfig{NodeId: "a", Dir: t.TempDir()}, &memReplicationTransport{}, (&memApplier{}).apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, key := range []string{"400000", "400001"} {
+		if err = r.Record(AuditActionBinCreate, key, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status := r.Status(); status.Seq != 2 || status.Compacted != 2 || len(r.entries) != 0 {
+		t.Errorf("seq %d, compacted %d, %d entries", status.Seq, status.Compacted, len(r.entries))
+	}
+}
@@ -0,0 +1,268 @@
+package bdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kidshelloworld.com/bindb/mod"
+	"kidshelloworld.com/bindb/pan"
+)
+
+//数据目录下的卡组织规则文件, 存在时替换内置的规则, 列为scheme,prefix_start,prefix_end,lengths,luhn
+//lengths以|分隔, 可以是区间, 如13|16-19
+var schemeRuleFileName = "scheme_rules.csv"
+
+//内置的卡组织规则, 前缀重叠时取位数最多的规则
+const defaultSchemeRules = `scheme,prefix_start,prefix_end,lengths,luhn
+visa,4,4,13|16|19,y
+mastercard,51,55,16,y
+mastercard,2221,2720,16,y
+amex,34,34,15,y
+amex,37,37,15,y
+unionpay,62,62,16-19,n
+unionpay,81,81,16-19,n
+jcb,3528,3589,16-19,y
+diners,300,305,14-19,y
+diners,36,36,14-19,y
+diners,38,39,16-19,y
+discover,6011,6011,16-19,y
+discover,644,649,16-19,y
+discover,65,65,16-19,y
+maestro,5018,5018,12-19,y
+maestro,5020,5020,12-19,y
+maestro,5038,5038,12-19,y
+maestro,5893,5893,12-19,y
+maestro,6304,6304,12-19,y
+maestro,6759,6759,12-19,y
+maestro,6761,6763,12-19,y
+mir,2200,2204,16-19,y
+rupay,60,60,16,y
+rupay,6521,6522,16,y
+troy,9792,9792,16,y
+verve,506099,506198,16|18|19,y
+verve,650002,650027,16|18|19,y
+uatp,1,1,15,n`
+
+type schemeRuleTable struct {
+	mutex sync.RWMutex
+	//按前缀位数降序
+	rules []mod.SchemeRule
+}
+
+var schemeRules = &schemeRuleTable{}
+
+func init() {
+	rules, err := readSchemeRules(strings.NewReader(defaultSchemeRules))
+	if err != nil {
+		panic(err)
+	}
+	schemeRules.rules = rules
+}
+
+//读取规则文件, 文件不存在时使用内置的规则
+func loadSchemeRules(filepath string) error {
+	f, err := os.Open(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var r io.Reader = strings.NewReader(defaultSchemeRules)
+	if err == nil {
+		defer f.Close()
+		r = f
+	}
+	rules, err := readSchemeRules(r)
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", filepath, err))
+	}
+	schemeRules.mutex.Lock()
+	schemeRules.rules = rules
+	schemeRules.mutex.Unlock()
+	return nil
+}
+
+func readSchemeRules(r io.Reader) ([]mod.SchemeRule, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 5
+	var rules []mod.SchemeRule
+	for line := 1; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && values[0] == "scheme" {
+			continue
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		rule := mod.SchemeRule{Schema: strings.ToLower(values[0]), PrefixStart: values[1], PrefixEnd: values[2], Luhn: normalizeFlag(values[4], "n") == "y"}
+		if rule.PrefixEnd == "" {
+			rule.PrefixEnd = rule.PrefixStart
+		}
+		if rule.Schema == "" || !isDigits(rule.PrefixStart) || !isDigits(rule.PrefixEnd) || len(rule.PrefixStart) != len(rule.PrefixEnd) || rule.PrefixStart > rule.PrefixEnd {
+			return nil, errors.New(fmt.Sprintf("line %d: 非法的规则 %s", line, strings.Join(values, ",")))
+		}
+		if rule.Lengths, err = parseLengths(values[3]); err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", line, err))
+		}
+		rules = append(rules, rule)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].PrefixStart) > len(rules[j].PrefixStart) })
+	return rules, nil
+}
+
+//解析13|16-19格式的长度列表
+func parseLengths(value string) ([]int, error) {
+	var lengths []int
+	for _, item := range strings.Split(value, "|") {
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		end := start
+		if err == nil && len(bounds) == 2 {
+			end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if err != nil || start <= 0 || end < start || end > 19 {
+			return nil, errors.New(fmt.Sprintf("非法的卡号长度 %s", value))
+		}
+		for l := start; l <= end; l++ {
+			lengths = append(lengths, l)
+		}
+	}
+	return lengths, nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+//MatchSchemeRule 按卡号或bin的前缀匹配规则, 前缀重叠时取位数最多的规则
+func MatchSchemeRule(number string) (mod.SchemeRule, bool) {
+	if !isDigits(number) {
+		return mod.SchemeRule{}, false
+	}
+	schemeRules.mutex.RLock()
+	defer schemeRules.mutex.RUnlock()
+	for _, rule := range schemeRules.rules {
+		if len(number) < len(rule.PrefixStart) {
+			continue
+		}
+		//位数相同时字符串比较与数值比较一致
+		prefix := number[:len(rule.PrefixStart)]
+		if rule.PrefixStart <= prefix && prefix <= rule.PrefixEnd {
+			return rule, true
+		}
+	}
+	return mod.SchemeRule{}, false
+}
+
+//SchemeRules 当前使用的规则
+func SchemeRules() []mod.SchemeRule {
+	schemeRules.mutex.RLock()
+	defer schemeRules.mutex.RUnlock()
+	return append([]mod.SchemeRule(nil), schemeRules.rules...)
+}
+
+//卡号长度及Luhn校验, 数据中未指定时使用匹配的卡组织规则
+func setNumberFields(data *mod.SimpleBinData, result mod.BinData) {
+	rule, ok := MatchSchemeRule(strconv.FormatUint(uint64(result.IinStart), 10))
+	if result.NumberLength > 0 {
+		data.NumberLength = result.NumberLength
+		data.NumberLengths = []int{int(result.NumberLength)}
+	} else if ok {
+		data.NumberLengths = rule.Lengths
+	}
+	if data.NumberLuhn = result.NumberLuhn; data.NumberLuhn == "" && ok {
+		data.NumberLuhn = "n"
+		if rule.Luhn {
+			data.NumberLuhn = "y"
+		}
+	}
+}
+
+//QueryPan 按卡号的前8位或前6位查询, 优先使用8位bin的确切数据, 返回使用的bin
+func QueryPan(number string) (*mod.SimpleBinData, string, error) {
+	var (
+		result *mod.SimpleBinData
+		bin    string
+	)
+	for _, n := range []int{8, 6} {
+		if len(number) < n {
+			continue
+		}
+		data, err := Query(number[:n])
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, "", err
+		}
+		result, bin = data, number[:n]
+		if !data.Inferred {
+			break
+		}
+	}
+	if result == nil {
+		return nil, "", errors.New(fmt.Sprintf("bin %s not found", number[:6]))
+	}
+	return result, bin, nil
+}
+
+//ValidatePan 按bin数据或卡组织规则校验完整卡号的长度及Luhn
+func ValidatePan(number string) (*mod.PanValidation, error) {
+	number, err := pan.Normalize(number)
+	if err != nil {
+		return nil, err
+	}
+	result := &mod.PanValidation{Bin: number[:6], Length: len(number), LuhnValid: pan.Luhn(number)}
+	data, bin, err := QueryPan(number)
+	if err != nil {
+		result.Reason = "无法识别的卡号"
+		return result, nil
+	}
+	result.Bin, result.Schema, result.Inferred = bin, data.Schema, data.Inferred
+	result.LengthValid = len(data.NumberLengths) == 0
+	for _, l := range data.NumberLengths {
+		if l == len(number) {
+			result.LengthValid = true
+		}
+	}
+	result.LuhnRequired = data.NumberLuhn == "y"
+	if !result.LengthValid {
+		result.Reason = fmt.Sprintf("卡号长度应为%v", data.NumberLengths)
+	} else if result.LuhnRequired && !result.LuhnValid {
+		result.Reason = "Luhn校验失败"
+	}
+	result.Valid = result.Reason == ""
+	return result, nil
+}
+
+//按规则推断的结果, 只有卡组织相关的信息
+func inferBinData(bin string) (*mod.SimpleBinData, bool) {
+	rule, ok := MatchSchemeRule(bin)
+	if !ok {
+		return nil, false
+	}
+	data := &mod.SimpleBinData{BaseBinData: mod.BaseBinData{Schema: rule.Schema}, Inferred: true, NumberLengths: rule.Lengths, NumberLuhn: "n"}
+	if rule.Luhn {
+		data.NumberLuhn = "y"
+	}
+	return data, true
+}
@@ -0,0 +1,189 @@
+package bdata
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestParseLengths(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []int
+		err   bool
+	}{
+		{"16", []int{16}, false},
+		{"13|16|19", []int{13, 16, 19}, false},
+		{"16-19", []int{16, 17, 18, 19}, false},
+		{" 12 | 14-15 ", []int{12, 14, 15}, false},
+		{"", nil, true},
+		{"0", nil, true},
+		{"19-16", nil, true},
+		{"16-20", nil, true},
+		{"a", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseLengths(c.value)
+		if (err != nil) != c.err {
+			t.Errorf("parseLengths(%q) error %v, want error %v", c.value, err, c.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseLengths(%q) = %v, want %v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestMatchSchemeRule(t *testing.T) {
+	cases := []struct {
+		number string
+		schema string
+	}{
+		{"411111", "visa"},
+		{"4", "visa"},
+		{"510000", "mastercard"},
+		{"222100", "mastercard"},
+		{"272099", "mastercard"},
+		{"272100", ""},
+		{"340000", "amex"},
+		{"622126", "unionpay"},
+		{"353011", "jcb"},
+		{"601100", "discover"},
+		//前缀重叠时取位数最多的规则
+		{"506100", "verve"},
+		{"501800", "maestro"},
+		{"220000", "mir"},
+		{"100000", "uatp"},
+		{"900000", ""},
+		{"41111a", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		rule, ok := MatchSchemeRule(c.number)
+		if ok != (c.schema != "") || rule.Schema != c.schema {
+			t.Errorf("MatchSchemeRule(%q) = %s, %v, want %q", c.number, rule.Schema, ok, c.schema)
+		}
+	}
+}
+
+func TestReadSchemeRules(t *testing.T) {
+	cases := []struct {
+		content string
+		err     bool
+	}{
+		{"scheme,prefix_start,prefix_end,lengths,luhn\nvisa,4,,16,y", false},
+		{"visa,4,4,16,y", false},
+		{"visa,40,4,16,y", true},
+		{"visa,45,40,16,y", true},
+		{",4,4,16,y", true},
+		{"visa,4x,4x,16,y", true},
+		{"visa,4,4,16-25,y", true},
+		{"visa,4,4,16", true},
+	}
+	for _, c := range cases {
+		rules, err := readSchemeRules(strings.NewReader(c.content))
+		if (err != nil) != c.err {
+			t.Errorf("%q: error %v, want error %v", c.content, err, c.err)
+			continue
+		}
+		if err == nil && (len(rules) != 1 || rules[0].PrefixEnd != "4") {
+			t.Errorf("%q: rules %+v", c.content, rules)
+		}
+	}
+}
+
+//读取确切数据失败的数据库
+type failingDatabase struct {
+	*memoryDatabase
+}
+
+func (f failingDatabase) ReadExact(bin uint32) (mod.BinData, error) {
+	return NullBinData, errors.New("database unavailable")
+}
+
+func TestQueryInfer(t *testing.T) {
+	m := useTestMemory(t)
+	m.dataMap[411111] = mod.BinData{Id: 1, IinStart: 411111, IinEnd: 411111, BaseBinData: mod.BaseBinData{Schema: "visa", BankName: "TEST BANK"}}
+
+	data, err := Query("411111")
+	if err != nil || data.Inferred || data.BankName != "TEST BANK" {
+		t.Fatalf("exact %+v, %v", data, err)
+	}
+	//未找到时按规则推断
+	if data, err = Query("422222"); err != nil || !data.Inferred || data.Schema != "visa" || data.NumberLuhn != "y" {
+		t.Fatalf("inferred %+v, %v", data, err)
+	}
+	if _, err = Query("900000"); !IsNotFound(err) {
+		t.Fatalf("err %v, want not found", err)
+	}
+
+	//其他错误不推断
+	currentBinDatabase = failingDatabase{m}
+	if data, err = Query("422222"); err == nil || IsNotFound(err) {
+		t.Fatalf("failing database: %+v, %v", data, err)
+	}
+	if _, _, err = QueryPan("4222222222222"); err == nil || IsNotFound(err) {
+		t.Fatalf("failing database pan: %v", err)
+	}
+}
+
+func TestSetNumberFields(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    mod.BinData
+		length  int8
+		lengths []int
+		luhn    string
+	}{
+		{"from data", mod.BinData{IinStart: 411111, NumberLength: 16, NumberLuhn: "n"}, 16, []int{16}, "n"},
+		{"from rule", mod.BinData{IinStart: 411111, NumberLength: -1}, 0, []int{13, 16, 19}, "y"},
+		{"luhn from data", mod.BinData{IinStart: 510000, NumberLength: -1, NumberLuhn: "n"}, 0, []int{16}, "n"},
+		{"no rule", mod.BinData{IinStart: 900000, NumberLength: -1}, 0, nil, ""},
+	}
+	for _, c := range cases {
+		data := &mod.SimpleBinData{}
+		setNumberFields(data, c.data)
+		if data.NumberLength != c.length || !reflect.DeepEqual(data.NumberLengths, c.lengths) || data.NumberLuhn != c.luhn {
+			t.Errorf("%s: %d %v %q", c.name, data.NumberLength, data.NumberLengths, data.NumberLuhn)
+		}
+	}
+}
+
+func TestValidatePan(t *testing.T) {
+	m := useTestMemory(t)
+	m.dataMap[411111] = mod.BinData{Id: 1, IinStart: 411111, IinEnd: 411111, NumberLength: 16, NumberLuhn: "y", BaseBinData: mod.BaseBinData{Schema: "visa"}}
+	//8位bin的数据优先
+	m.dataMap[41111122] = mod.BinData{Id: 2, IinStart: 41111122, IinEnd: 41111122, NumberLength: 15, NumberLuhn: "n", BaseBinData: mod.BaseBinData{Schema: "visa"}}
+
+	cases := []struct {
+		number   string
+		bin      string
+		inferred bool
+		valid    bool
+		reason   string
+	}{
+		{"4111 1111 1111 1111", "411111", false, true, ""},
+		{"411111111111111", "411111", false, false, "卡号长度应为[16]"},
+		{"4111111111111112", "411111", false, false, "Luhn校验失败"},
+		{"411111220000001", "41111122", false, true, ""},
+		{"4222222222222220", "422222", true, true, ""},
+		{"4222222222222221", "422222", true, false, "Luhn校验失败"},
+		{"9000000000000000", "900000", false, false, "无法识别的卡号"},
+	}
+	for _, c := range cases {
+		result, err := ValidatePan(c.number)
+		if err != nil {
+			t.Errorf("%s: %v", c.number, err)
+			continue
+		}
+		if result.Bin != c.bin || result.Inferred != c.inferred || result.Valid != c.valid || result.Reason != c.reason {
+			t.Errorf("%s: %+v", c.number, result)
+		}
+	}
+	if _, err := ValidatePan("4111-abc"); err == nil {
+		t.Error("validated invalid number")
+	}
+}
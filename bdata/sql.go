@@ -0,0 +1,398 @@
+package bdata
+
+import (
+	"container/heap"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/mod"
+)
+
+const sqlColumns = "id, iin_start, iin_end, number_length, number_luhn, scheme, brand, card_type, prepaid, country, " +
+	"bank_name, bank_logo, bank_url, bank_phone, bank_city"
+
+//按版本顺序执行的schema变更, 只能追加, 不能修改已发布的语句
+var sqlMigrations = []string{
+	`CREATE TABLE bin_data (
+	id BIGINT NOT NULL,
+	iin_start BIGINT NOT NULL,
+	iin_end BIGINT NOT NULL,
+	number_length INT NOT NULL DEFAULT -1,
+	number_luhn VARCHAR(16) NOT NULL DEFAULT '',
+	scheme VARCHAR(64) NOT NULL DEFAULT '',
+	brand VARCHAR(128) NOT NULL DEFAULT '',
+	card_type VARCHAR(32) NOT NULL DEFAULT '',
+	prepaid VARCHAR(16) NOT NULL DEFAULT '',
+	country VARCHAR(64) NOT NULL DEFAULT '',
+	bank_name VARCHAR(255) NOT NULL DEFAULT '',
+	bank_logo VARCHAR(255) NOT NULL DEFAULT '',
+	bank_url VARCHAR(255) NOT NULL DEFAULT '',
+	bank_phone VARCHAR(64) NOT NULL DEFAULT '',
+	bank_city VARCHAR(128) NOT NULL DEFAULT ''
+)`,
+	`CREATE INDEX idx_bin_data_range ON bin_data (iin_start, iin_end)`,
+	`CREATE TABLE bin_data_approximate (
+	bin BIGINT NOT NULL,
+	id BIGINT NOT NULL,
+	iin_start BIGINT NOT NULL,
+	iin_end BIGINT NOT NULL,
+	number_length INT NOT NULL DEFAULT -1,
+	number_luhn VARCHAR(16) NOT NULL DEFAULT '',
+	scheme VARCHAR(64) NOT NULL DEFAULT '',
+	brand VARCHAR(128) NOT NULL DEFAULT '',
+	card_type VARCHAR(32) NOT NULL DEFAULT '',
+	prepaid VARCHAR(16) NOT NULL DEFAULT '',
+	country VARCHAR(64) NOT NULL DEFAULT '',
+	bank_name VARCHAR(255) NOT NULL DEFAULT '',
+	bank_logo VARCHAR(255) NOT NULL DEFAULT '',
+	bank_url VARCHAR(255) NOT NULL DEFAULT '',
+	bank_phone VARCHAR(64) NOT NULL DEFAULT '',
+	bank_city VARCHAR(128) NOT NULL DEFAULT ''
+)`,
+	`CREATE INDEX idx_bin_data_approximate_bin ON bin_data_approximate (bin)`,
+}
+
+//基于database/sql的数据库, 确切数据按区间存储, 近似数据存放在单独的表中
+//驱动需要在main包中引入, 如github.com/lib/pq, github.com/go-sql-driver/mysql, modernc.org/sqlite
+type sqlDatabase struct {
+	db     *sql.DB
+	driver string
+}
+
+func NewSqlDatabase() BinDatabase {
+	return &sqlDatabase{}
+}
+
+func openSql(driver, dsn string) (*sqlDatabase, error) {
+	if driver == "" || dsn == "" {
+		return nil, errors.New("sql driver或dsn未配置")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &sqlDatabase{db: db, driver: driver}
+	if err = s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqlDatabase) Init(cfg BinDataConfig) error {
+	opened, err := openSql(cfg.SqlDriver, cfg.SqlDsn)
+	if err != nil {
+		logger.Errorf("open sql database error: %s, driver: %s", err, cfg.SqlDriver)
+		return errors.New("初始化sql数据库失败")
+	}
+	*s = *opened
+	return nil
+}
+
+func (s *sqlDatabase) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+//执行未应用的schema变更, 已应用的版本记录在schema_migrations表
+func (s *sqlDatabase) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL PRIMARY KEY, applied_at BIGINT NOT NULL)`); err != nil {
+		return err
+	}
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for i := current; i < len(sqlMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(sqlMigrations[i]); err != nil {
+			tx.Rollback()
+			return errors.New(fmt.Sprintf("migration %d: %s", i+1, err))
+		}
+		if _, err = tx.Exec(s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), i+1, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		logger.Infof("sql migration %d applied", i+1)
+	}
+	return nil
+}
+
+//postgres使用$n占位符, mysql, sqlite等其余驱动使用?
+func (s *sqlDatabase) rebind(query string) string {
+	if s.driver != "postgres" && s.driver != "pgx" {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBinData(row rowScanner) (mod.BinData, error) {
+	var (
+		d            mod.BinData
+		numberLength int
+	)
+	err := row.Scan(&d.Id, &d.IinStart, &d.IinEnd, &numberLength, &d.NumberLuhn, &d.Schema, &d.Brand, &d.CardType,
+		&d.Prepaid, &d.Country, &d.BankName, &d.BankLogo, &d.BankUrl, &d.BankPhone, &d.BankCity)
+	d.NumberLength = int8(numberLength)
+	return d, err
+}
+
+func binDataArgs(d mod.BinData) []interface{} {
+	return []interface{}{d.Id, d.IinStart, d.IinEnd, int(d.NumberLength), d.NumberLuhn, d.Schema, d.Brand, d.CardType,
+		d.Prepaid, d.Country, d.BankName, d.BankLogo, d.BankUrl, d.BankPhone, d.BankCity}
+}
+
+//区间重叠时取最小的区间, 区间相同时取先写入的数据
+func (s *sqlDatabase) ReadExact(bin uint32) (mod.BinData, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT `+sqlColumns+` FROM bin_data WHERE iin_start <= ? AND iin_end >= ? `+
+		`ORDER BY iin_end - iin_start, id LIMIT 1`), bin, bin)
+	result, err := scanBinData(row)
+	if err == sql.ErrNoRows {
+		return NullBinData, notFound(bin)
+	}
+	if err != nil {
+		return NullBinData, err
+	}
+	result.IinStart = bin
+	result.IinEnd = bin
+	return result, nil
+}
+
+func (s *sqlDatabase) ReadApproximate(bin uint32) ([]mod.BinData, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+sqlColumns+` FROM bin_data_approximate WHERE bin = ? ORDER BY id`), bin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []mod.BinData
+	for rows.Next() {
+		var d mod.BinData
+		if d, err = scanBinData(rows); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, notFound(bin)
+	}
+	return result, nil
+}
+
+//区间展开为单个bin, 区间重叠时已遍历过的bin会跳过
+//按bin顺序展开, 重叠部分与ReadExact一致取范围最小的数据
+func (s *sqlDatabase) Scan(fn func(bindata mod.BinData) bool) error {
+	rows, err := s.db.Query(`SELECT ` + sqlColumns + ` FROM bin_data ORDER BY iin_start, iin_end - iin_start, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var (
+		active  sqlRangeHeap
+		pending *mod.BinData
+		bin     uint32
+	)
+	readNext := func() error {
+		pending = nil
+		if !rows.Next() {
+			return rows.Err()
+		}
+		d, err := scanBinData(rows)
+		if err != nil {
+			return err
+		}
+		pending = &d
+		return nil
+	}
+	if err = readNext(); err != nil {
+		return err
+	}
+	for {
+		if active.Len() == 0 {
+			if pending == nil {
+				return nil
+			}
+			bin = pending.IinStart
+		}
+		for pending != nil && pending.IinStart <= bin {
+			heap.Push(&active, *pending)
+			if err = readNext(); err != nil {
+				return err
+			}
+		}
+		for active.Len() > 0 && active[0].IinEnd < bin {
+			heap.Pop(&active)
+		}
+		if active.Len() == 0 {
+			continue
+		}
+		d := active[0]
+		d.IinStart = bin
+		d.IinEnd = bin
+		if !fn(d) {
+			return nil
+		}
+		if bin == ^uint32(0) {
+			return nil
+		}
+		bin++
+	}
+}
+
+//按范围大小, id排序的当前有效范围
+type sqlRangeHeap []mod.BinData
+
+func (h sqlRangeHeap) Len() int { return len(h) }
+func (h sqlRangeHeap) Less(i, j int) bool {
+	wi, wj := h[i].IinEnd-h[i].IinStart, h[j].IinEnd-h[j].IinStart
+	if wi != wj {
+		return wi < wj
+	}
+	return h[i].Id < h[j].Id
+}
+func (h sqlRangeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sqlRangeHeap) Push(x interface{}) { *h = append(*h, x.(mod.BinData)) }
+func (h *sqlRangeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (s *sqlDatabase) Save(bin uint32, bindata mod.BinData, approximate bool) error {
+	//与内存数据库一致, 已存在的确切数据不覆盖
+	if _, err := s.ReadExact(bin); err == nil {
+		return nil
+	}
+	bindata.IinStart = bin
+	bindata.IinEnd = bin
+	if approximate {
+		_, err := s.db.Exec(s.rebind(`INSERT INTO bin_data_approximate (bin, `+sqlColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			append([]interface{}{bin}, binDataArgs(bindata)...)...)
+		return err
+	}
+	_, err := s.db.Exec(s.rebind(`INSERT INTO bin_data (`+sqlColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), binDataArgs(bindata)...)
+	return err
+}
+
+//SqlImport 将数据目录中的数据文件导入sql数据库, 已存在的相同id及区间会跳过, 返回导入的行数
+func SqlImport(driver, dsn, dataDir string) (int, error) {
+	s, err := openSql(driver, dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	var filepaths []string
+	if filepaths, err = searchBinDataFiles(dataDir); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, filepath := range filepaths {
+		var n int
+		if n, err = s.importFile(filepath); err != nil {
+			return total, errors.New(fmt.Sprintf("%s: %s", filepath, err))
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *sqlDatabase) importFile(filepath string) (int, error) {
+	lines, err := ReadBinDataFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	approximate := IsApproximateFile(filepath)
+	table, insert := "bin_data", `INSERT INTO bin_data (`+sqlColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if approximate {
+		table, insert = "bin_data_approximate", `INSERT INTO bin_data_approximate (bin, `+sqlColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	}
+
+	var tx *sql.Tx
+	if tx, err = s.db.Begin(); err != nil {
+		return 0, err
+	}
+	var exists, stmt *sql.Stmt
+	if exists, err = tx.Prepare(s.rebind(`SELECT COUNT(1) FROM ` + table + ` WHERE id = ? AND iin_start = ? AND iin_end = ?`)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer exists.Close()
+	if stmt, err = tx.Prepare(s.rebind(insert)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count := 0
+	for _, line := range lines {
+		var data []mod.BinData
+		if data, err = parse(line); err != nil {
+			logger.Errorf("parse bin data error: %s, data: %s", err, line)
+			continue
+		}
+		//确切数据按区间存储, 近似数据每个bin一行
+		records := data
+		if !approximate {
+			d := data[0]
+			d.IinEnd = data[len(data)-1].IinStart
+			records = []mod.BinData{d}
+		}
+		for _, d := range records {
+			var n int
+			if err = exists.QueryRow(d.Id, d.IinStart, d.IinEnd).Scan(&n); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			if n > 0 {
+				continue
+			}
+			args := binDataArgs(d)
+			if approximate {
+				args = append([]interface{}{d.IinStart}, args...)
+			}
+			if _, err = stmt.Exec(args...); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			count++
+		}
+	}
+	return count, tx.Commit()
+}
@@ -0,0 +1,202 @@
+package bdata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"kidshelloworld.com/bindb/mod"
+	_ "modernc.org/sqlite"
+)
+
+func openTestSql(t *testing.T) (*sqlDatabase, string) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "bindb.db")
+	s, err := openSql("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, dsn
+}
+
+func TestSqlMigrate(t *testing.T) {
+	s, dsn := openTestSql(t)
+	var version int
+	if err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqlMigrations) {
+		t.Fatalf("version %d, want %d", version, len(sqlMigrations))
+	}
+	//再次打开时不重复执行
+	again, err := openSql("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	var count int
+	if err := again.db.QueryRow(`SELECT COUNT(1) FROM schema_migrations`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(sqlMigrations) {
+		t.Fatalf("%d migrations recorded, want %d", count, len(sqlMigrations))
+	}
+}
+
+func TestSqlRebind(t *testing.T) {
+	cases := []struct {
+		driver string
+		want   string
+	}{
+		{"postgres", "a = $1 AND b = $2"},
+		{"pgx", "a = $1 AND b = $2"},
+		{"mysql", "a = ? AND b = ?"},
+		{"sqlite", "a = ? AND b = ?"},
+	}
+	for _, c := range cases {
+		s := &sqlDatabase{driver: c.driver}
+		if got := s.rebind("a = ? AND b = ?"); got != c.want {
+			t.Errorf("%s: rebind = %q, want %q", c.driver, got, c.want)
+		}
+	}
+}
+
+func importTestData(t *testing.T, s *sqlDatabase) {
+	t.Helper()
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "ranges.bd"),
+		"1,400000,400099,,,visa,,credit,,US,WIDE BANK,,,,",
+		"2,400050,400059,,,visa,,debit,,US,NARROW BANK,,,,",
+		"3,400055,400055,16,y,visa,,debit,,US,SINGLE BANK,,,,",
+		"4,510000,,,,mastercard,,credit,,GB,MC BANK,,,,")
+	writeDataFile(t, filepath.Join(dir, "20190601", "approximate.bd2"),
+		"5,520000,,,,mastercard,,debit,,GB,GUESS ONE,,,,",
+		"6,520000,,,,mastercard,,credit,,GB,GUESS TWO,,,,")
+	for _, f := range []string{filepath.Join(dir, "ranges.bd"), filepath.Join(dir, "20190601", "approximate.bd2")} {
+		if _, err := s.importFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//重复导入时跳过已存在的数据
+	for _, f := range []string{filepath.Join(dir, "ranges.bd"), filepath.Join(dir, "20190601", "approximate.bd2")} {
+		if n, err := s.importFile(f); err != nil || n != 0 {
+			t.Fatalf("reimport %s: %d rows, %v", f, n, err)
+		}
+	}
+}
+
+func TestSqlReadExact(t *testing.T) {
+	s, _ := openTestSql(t)
+	importTestData(t, s)
+	cases := []struct {
+		bin  uint32
+		id   int64
+		bank string
+	}{
+		{400000, 1, "WIDE BANK"},
+		{400049, 1, "WIDE BANK"},
+		{400050, 2, "NARROW BANK"},
+		{400055, 3, "SINGLE BANK"},
+		{400059, 2, "NARROW BANK"},
+		{400060, 1, "WIDE BANK"},
+		{400099, 1, "WIDE BANK"},
+		{510000, 4, "MC BANK"},
+	}
+	for _, c := range cases {
+		d, err := s.ReadExact(c.bin)
+		if err != nil {
+			t.Fatalf("%d: %s", c.bin, err)
+		}
+		if d.Id != c.id || d.BankName != c.bank || d.IinStart != c.bin || d.IinEnd != c.bin {
+			t.Errorf("%d: got id %d %s [%d, %d], want id %d %s", c.bin, d.Id, d.BankName, d.IinStart, d.IinEnd, c.id, c.bank)
+		}
+	}
+	if d, _ := s.ReadExact(400055); d.NumberLength != 16 || d.NumberLuhn != "y" {
+		t.Errorf("number fields %d %q", d.NumberLength, d.NumberLuhn)
+	}
+	for _, bin := range []uint32{399999, 400100, 520000} {
+		if _, err := s.ReadExact(bin); !IsNotFound(err) {
+			t.Errorf("%d: err %v, want not found", bin, err)
+		}
+	}
+}
+
+func TestSqlReadApproximate(t *testing.T) {
+	s, _ := openTestSql(t)
+	importTestData(t, s)
+	list, err := s.ReadApproximate(520000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Id != 5 || list[1].Id != 6 {
+		t.Fatalf("approximate %+v", list)
+	}
+	if _, err = s.ReadApproximate(400000); !IsNotFound(err) {
+		t.Errorf("err %v, want not found", err)
+	}
+}
+
+func TestSqlSave(t *testing.T) {
+	s, _ := openTestSql(t)
+	importTestData(t, s)
+	data := mod.BinData{Id: 10, BaseBinData: mod.BaseBinData{Schema: "visa", BankName: "NEW BANK"}}
+	if err := s.Save(600000, data, false); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.ReadExact(600000); err != nil || d.BankName != "NEW BANK" {
+		t.Fatalf("saved %+v, %v", d, err)
+	}
+	//已存在的确切数据不覆盖
+	data.Id, data.BankName = 11, "OTHER BANK"
+	if err := s.Save(400055, data, false); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := s.ReadExact(400055); d.Id != 3 {
+		t.Errorf("existing record replaced by %d", d.Id)
+	}
+	data.Id, data.BankName = 12, "GUESS THREE"
+	if err := s.Save(520000, data, true); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.ReadApproximate(520000); len(list) != 3 || list[2].BankName != "GUESS THREE" {
+		t.Errorf("approximate after save %+v", list)
+	}
+}
+
+func TestSqlScan(t *testing.T) {
+	s, _ := openTestSql(t)
+	importTestData(t, s)
+	var bins []uint32
+	ids := make(map[uint32]int64)
+	if err := s.Scan(func(d mod.BinData) bool {
+		bins = append(bins, d.IinStart)
+		ids[d.IinStart] = d.Id
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	//400000-400099共100个bin, 重叠部分只出现一次并取范围最小的数据, 加上510000
+	if len(bins) != 101 {
+		t.Fatalf("scanned %d bins, want 101", len(bins))
+	}
+	for i := 1; i < len(bins); i++ {
+		if bins[i] <= bins[i-1] {
+			t.Fatalf("bins not ascending at %d: %d, %d", i, bins[i-1], bins[i])
+		}
+	}
+	for bin, id := range map[uint32]int64{400000: 1, 400050: 2, 400055: 3, 400059: 2, 400060: 1, 510000: 4} {
+		if ids[bin] != id {
+			t.Errorf("%d: id %d, want %d", bin, ids[bin], id)
+		}
+	}
+
+	//fn返回false时停止
+	n := 0
+	s.Scan(func(d mod.BinData) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("scan stopped after %d, want 3", n)
+	}
+}
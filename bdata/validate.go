@@ -0,0 +1,266 @@
+package bdata
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kidshelloworld.com/bindb/file"
+)
+
+const (
+	DiagnosticLevelError   = "error"
+	DiagnosticLevelWarning = "warning"
+)
+
+//bin数据文件的列数
+const binDataColumns = 15
+
+var (
+	knownSchemes   = []string{"visa", "mastercard", "amex", "unionpay", "jcb", "diners", "discover", "maestro", "mir", "rupay", "elo", "hipercard", "dankort", "uatp", "troy", "interpayment", "instapayment"}
+	knownCardTypes = []string{"debit", "credit", "charge"}
+	knownPrepaid   = []string{"", "y", "n", "yes", "no", "true", "false"}
+	knownLuhn      = []string{"", "y", "n", "yes", "no", "true", "false"}
+)
+
+//Diagnostic 数据文件校验发现的问题
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, d.Level, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.File, d.Level, d.Message)
+}
+
+type location struct {
+	file string
+	line int
+}
+
+func (l location) String() string {
+	return fmt.Sprintf("%s:%d", l.file, l.line)
+}
+
+type validatedRange struct {
+	start, end uint32
+	location
+	//上次Finish之后加入
+	added bool
+}
+
+//Validator bin数据文件校验器
+//单行的检查在ValidateLine时完成, 跨行的检查(id重复, 区间重叠)在Finish时完成
+//可以多次校验后Finish, 如数据文件增量加载时, 之后的检查包括之前校验过的数据
+type Validator struct {
+	Diagnostics []Diagnostic
+	//是否检查bank_name为空, 基础数据中大量bin没有发卡行信息, 默认不检查
+	BankNameRequired bool
+	ids         map[int64]location
+	ranges      []validatedRange
+	//已由Finish返回的问题数
+	finished int
+}
+
+func NewValidator() *Validator {
+	return &Validator{ids: make(map[int64]location, 4096), ranges: make([]validatedRange, 0, 4096)}
+}
+
+func (v *Validator) report(loc location, level, format string, args ...interface{}) {
+	v.Diagnostics = append(v.Diagnostics, Diagnostic{File: loc.file, Line: loc.line, Level: level, Message: fmt.Sprintf(format, args...)})
+}
+
+//ValidateFile 校验整个数据文件, 包括header
+func (v *Validator) ValidateFile(filepath string) error {
+	var (
+		header string
+		lines  []string
+		err    error
+	)
+	if header, err = readHeader(filepath); err != nil {
+		return err
+	}
+	v.ValidateHeader(filepath, header)
+	if lines, err = ReadBinDataFile(filepath); err != nil {
+		return err
+	}
+	approximate := IsApproximateFile(filepath)
+	for i, line := range lines {
+		//第一行为header
+		v.ValidateLine(filepath, i+2, line, approximate)
+	}
+	return nil
+}
+
+//ValidateHeader 校验文件header
+func (v *Validator) ValidateHeader(filepath, header string) {
+	if header != binDataHeader {
+		v.report(location{filepath, 1}, DiagnosticLevelError, "header不匹配, 应为: %s", binDataHeader)
+	}
+}
+
+//ValidateLine 校验一行数据, 返回该行是否存在error级别的问题, line为0表示行号未知
+func (v *Validator) ValidateLine(filepath string, line int, value string, approximate bool) bool {
+	loc := location{filepath, line}
+	errorCount := 0
+	fail := func(format string, args ...interface{}) {
+		errorCount++
+		v.report(loc, DiagnosticLevelError, format, args...)
+	}
+	warn := func(format string, args ...interface{}) {
+		v.report(loc, DiagnosticLevelWarning, format, args...)
+	}
+
+	values, repaired, err := splitRecord(value)
+	if err != nil {
+		fail("不是合法的csv数据: %s", err)
+		return true
+	}
+	if len(values) != binDataColumns {
+		if len(values) > binDataColumns {
+			fail("列数为%d, 应为%d, 包含逗号的字段需要使用双引号", len(values), binDataColumns)
+		} else {
+			fail("列数为%d, 应为%d", len(values), binDataColumns)
+		}
+		return true
+	}
+	if repaired {
+		warn("bank_name中包含未转义的逗号, 已按旧格式兼容读取, 请使用migrate命令重写文件")
+	}
+
+	//文件重新加载时再次读到的同一行
+	reread := false
+	if id, err := strconv.ParseInt(values[0], 10, 64); err != nil {
+		fail("id不是合法的数字: %q", values[0])
+	} else if first, ok := v.ids[id]; ok && first == loc {
+		reread = true
+	} else if ok {
+		fail("id %d 重复, 首次出现于 %s", id, first)
+	} else {
+		v.ids[id] = loc
+	}
+
+	var start, end uint32
+	validRange := true
+	if start, err = bin2Uint32(values[1]); err != nil {
+		validRange = false
+		fail("iin_start不是合法的bin: %q", values[1])
+	}
+	end = start
+	if values[2] != "" {
+		if end, err = bin2Uint32(values[2]); err != nil {
+			validRange = false
+			fail("iin_end不是合法的bin: %q", values[2])
+		} else if end < start {
+			validRange = false
+			fail("iin_start %d 大于 iin_end %d", start, end)
+		}
+	}
+	if validRange && !approximate && !reread {
+		v.ranges = append(v.ranges, validatedRange{start: start, end: end, location: loc, added: true})
+	}
+
+	if values[3] != "" {
+		if n, err := strconv.ParseInt(values[3], 10, 8); err != nil {
+			fail("number_length不是合法的数字: %q", values[3])
+		} else if n < 12 || n > 19 {
+			warn("number_length %d 不在12~19之间", n)
+		}
+	}
+	if !contains(knownLuhn, strings.ToLower(values[4])) {
+		fail("number_luhn取值未知: %q", values[4])
+	}
+	if values[5] == "" {
+		warn("scheme为空")
+	} else if !contains(knownSchemes, values[5]) {
+		warn("scheme取值未知: %q", values[5])
+	}
+	if values[7] == "" {
+		warn("type为空")
+	} else if !contains(knownCardTypes, values[7]) {
+		warn("type取值未知: %q", values[7])
+	}
+	if !contains(knownPrepaid, strings.ToLower(values[8])) {
+		warn("prepaid取值未知: %q", values[8])
+	}
+	if values[9] == "" {
+		warn("country为空")
+	} else if !IsCountryCode(values[9]) {
+		fail("country不是合法的ISO 3166-1 alpha-2代码: %q", values[9])
+	}
+	if values[10] == "" && v.BankNameRequired {
+		warn("bank_name为空")
+	}
+	return errorCount > 0
+}
+
+//Finish 完成跨行检查, 返回上次Finish之后发现的问题, 区间重叠只检查新加入的区间
+func (v *Validator) Finish() []Diagnostic {
+	sort.SliceStable(v.ranges, func(i, j int) bool { return v.ranges[i].start < v.ranges[j].start })
+	var widest validatedRange
+	for i, current := range v.ranges {
+		//与之前结束位置最大的区间比较
+		if i > 0 && current.start <= widest.end && (current.added || widest.added) {
+			v.report(current.location, DiagnosticLevelWarning, "区间[%d,%d]与%s的区间[%d,%d]重叠", current.start, current.end, widest.location, widest.start, widest.end)
+		}
+		if i == 0 || current.end > widest.end {
+			widest = current
+		}
+	}
+	for i := range v.ranges {
+		v.ranges[i].added = false
+	}
+	diagnostics := v.Diagnostics[v.finished:]
+	v.finished = len(v.Diagnostics)
+	return diagnostics
+}
+
+//HasError 是否存在error级别的问题
+func (v *Validator) HasError() bool {
+	for _, d := range v.Diagnostics {
+		if d.Level == DiagnosticLevelError {
+			return true
+		}
+	}
+	return false
+}
+
+//ValidateDir 校验目录或单个文件中的所有bin数据文件, bankNameRequired为true时检查bank_name为空
+func ValidateDir(dir string, bankNameRequired bool) ([]Diagnostic, error) {
+	var (
+		filepaths []string
+		err       error
+	)
+	if IsBinDataFile(dir) {
+		filepaths = []string{dir}
+	} else if filepaths, err = file.SearchDir(dir, IsBinDataFile); err != nil {
+		return nil, err
+	}
+	if len(filepaths) == 0 {
+		return nil, errors.New(fmt.Sprintf("%s 中没有bin数据文件", dir))
+	}
+	v := NewValidator()
+	v.BankNameRequired = bankNameRequired
+	for _, filepath := range filepaths {
+		if err = v.ValidateFile(filepath); err != nil {
+			return nil, err
+		}
+	}
+	return v.Finish(), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
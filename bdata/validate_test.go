@@ -0,0 +1,131 @@
+package bdata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLine(t *testing.T) {
+	cases := []struct {
+		value       string
+		approximate bool
+		hasError    bool
+		message     string
+	}{
+		{"1,400000,400099,16,y,visa,,credit,,US,TEST BANK,,,,", false, false, ""},
+		{`1,400000,,,,visa,,credit,,US,"BANK, LTD",,,,`, false, false, ""},
+		{"1,400000,,,,visa,,credit,,US,BANK, LTD,,,,", false, false, "未转义的逗号"},
+		{"1,400000,,,,visa,BRAND, X,credit,,US,TEST BANK,,,,", false, true, "需要使用双引号"},
+		{"x,400000,,,,visa,,credit,,US,TEST BANK,,,,", false, true, "id不是合法的数字"},
+		{"1,40000a,,,,visa,,credit,,US,TEST BANK,,,,", false, true, "iin_start不是合法的bin"},
+		{"1,400099,400000,,,visa,,credit,,US,TEST BANK,,,,", false, true, "大于 iin_end"},
+		{"1,400000,,20,,visa,,credit,,US,TEST BANK,,,,", false, false, "不在12~19之间"},
+		{"1,400000,,,x,visa,,credit,,US,TEST BANK,,,,", false, true, "number_luhn取值未知"},
+		{"1,400000,,,,foo,,credit,,US,TEST BANK,,,,", false, false, "scheme取值未知"},
+		{"1,400000,,,,visa,,credit,,XX,TEST BANK,,,,", false, true, "ISO 3166-1"},
+		{"1,400000,,,,visa,,credit,,US", false, true, "列数为10"},
+		{`1,400000,,,,visa,,credit,,US,"TEST",BANK,,,,`, false, true, "需要使用双引号"},
+	}
+	for _, c := range cases {
+		v := NewValidator()
+		if got := v.ValidateLine("ranges.bd", 2, c.value, c.approximate); got != c.hasError {
+			t.Errorf("%s: error %v, want %v, %+v", c.value, got, c.hasError, v.Diagnostics)
+		}
+		found := c.message == ""
+		for _, d := range v.Diagnostics {
+			if c.message != "" && strings.Contains(d.Message, c.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: diagnostics %+v, want %q", c.value, v.Diagnostics, c.message)
+		}
+	}
+}
+
+func TestValidateBankName(t *testing.T) {
+	line := "1,400000,,,,visa,,credit,,US,,,,,"
+	v := NewValidator()
+	if v.ValidateLine("ranges.bd", 2, line, false) || len(v.Diagnostics) != 0 {
+		t.Errorf("default: %+v", v.Diagnostics)
+	}
+	v = NewValidator()
+	v.BankNameRequired = true
+	if v.ValidateLine("ranges.bd", 2, line, false) || len(v.Diagnostics) != 1 || v.Diagnostics[0].Message != "bank_name为空" {
+		t.Errorf("bank name required: %+v", v.Diagnostics)
+	}
+}
+
+//随代码提供的基础数据应通过校验
+func TestValidateBundledData(t *testing.T) {
+	diagnostics, err := ValidateDir(baseDataFileName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+}
+
+func TestValidatorFinish(t *testing.T) {
+	v := NewValidator()
+	lines := []string{
+		"1,400000,400099,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,400050,,,,visa,,credit,,US,TEST BANK,,,,",
+		"2,500000,,,,visa,,credit,,US,TEST BANK,,,,",
+		//近似数据不参与重叠检查
+		"3,400060,,,,visa,,credit,,US,TEST BANK,,,,",
+	}
+	for i, line := range lines {
+		v.ValidateLine("ranges.bd", i+2, line, i == 3)
+	}
+	var messages []string
+	for _, d := range v.Finish() {
+		messages = append(messages, d.Message)
+	}
+	if len(messages) != 2 || !strings.Contains(messages[0], "id 2 重复") || !strings.Contains(messages[1], "重叠") {
+		t.Errorf("diagnostics %q", messages)
+	}
+	if !v.HasError() {
+		t.Error("duplicate id is not an error")
+	}
+}
+
+func TestValidatorIncremental(t *testing.T) {
+	v := NewValidator()
+	v.ValidateLine("ranges.bd", 2, "1,400000,400099,,,visa,,credit,,US,TEST BANK,,,,", false)
+	v.ValidateLine("ranges.bd", 3, "2,500000,500099,,,visa,,credit,,US,TEST BANK,,,,", false)
+	if d := v.Finish(); len(d) != 0 {
+		t.Fatalf("diagnostics %+v", d)
+	}
+
+	cases := []struct {
+		name     string
+		file     string
+		line     int
+		value    string
+		messages []string
+	}{
+		//重新加载时再次读到的同一行
+		{"reread", "ranges.bd", 2, "1,400000,400099,,,visa,,credit,,US,TEST BANK,,,,", nil},
+		{"duplicate id", "20190601/bindata.bd", 2, "1,600000,,,,visa,,credit,,US,TEST BANK,,,,", []string{"id 1 重复"}},
+		{"overlap with loaded", "20190601/bindata.bd", 3, "3,400050,,,,visa,,credit,,US,TEST BANK,,,,", []string{"重叠"}},
+		{"no new problems", "20190601/bindata.bd", 4, "4,700000,,,,visa,,credit,,US,TEST BANK,,,,", nil},
+	}
+	for _, c := range cases {
+		v.ValidateLine(c.file, c.line, c.value, false)
+		diagnostics := v.Finish()
+		if len(diagnostics) != len(c.messages) {
+			t.Errorf("%s: diagnostics %+v, want %v", c.name, diagnostics, c.messages)
+			continue
+		}
+		for i, d := range diagnostics {
+			if !strings.Contains(d.Message, c.messages[i]) {
+				t.Errorf("%s: %s, want %q", c.name, d, c.messages[i])
+			}
+		}
+	}
+	if !v.HasError() {
+		t.Error("HasError false after duplicate id")
+	}
+}
@@ -0,0 +1,185 @@
+package bdata
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"kidshelloworld.com/bindb/mod"
+)
+
+//以UnixNano作为id的数据(feedback, 导入)可以从id得到写入时间, 早于该时间的id视为普通序号
+var nanoIdThreshold = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+
+//VersionedBinDatabase 支持历史版本查询的数据库
+type VersionedBinDatabase interface {
+	//bin的所有版本, 按生效时间升序
+	History(bin uint32) ([]mod.BinVersion, error)
+	//bin在指定时间生效的确切数据
+	ReadAt(bin uint32, at time.Time) (mod.BinData, error)
+}
+
+//保存解析后的一行数据, 同时记录版本
+func (m *memoryDatabase) saveParsed(filepath string, line int, data []mod.BinData, approximate bool) {
+	if len(data) == 0 {
+		return
+	}
+	rangeStart, rangeEnd := data[0].IinStart, data[len(data)-1].IinStart
+	validFrom := versionTime(filepath, data[0].Id)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, d := range data {
+		meta := newRecordMeta(d, filepath, line, rangeStart, rangeEnd, validFrom)
+		m.addVersion(d.IinStart, d, approximate, meta)
+		m.save2Memory(d.IinStart, d, approximate, meta)
+	}
+}
+
+//记录一个版本, 需在save2Memory之前调用, 同一个bin相同id的数据只记录一次(文件重新加载时会再次读到)
+//大部分bin只有一个版本, 不单独记录, 由当前数据得到, 出现第二个版本时才记录该bin的所有版本
+func (m *memoryDatabase) addVersion(bin uint32, bindata mod.BinData, approximate bool, meta recordMeta) {
+	versions := m.history[bin]
+	if len(versions) == 0 {
+		if versions = m.currentVersions(bin); len(versions) == 0 {
+			return
+		}
+	}
+	for _, v := range versions {
+		if v.Data.Id == bindata.Id && v.Approximate == approximate {
+			return
+		}
+	}
+	bindata.Provenance = meta.provenance()
+	m.history[bin] = append(versions, versionOf(bin, int64(len(versions)+1), bindata, approximate))
+}
+
+//由当前的确切及近似数据得到的版本
+func (m *memoryDatabase) currentVersions(bin uint32) []mod.BinVersion {
+	var versions []mod.BinVersion
+	if d, ok := m.dataMap[bin]; ok {
+		versions = append(versions, versionOf(bin, 1, d, false))
+	}
+	ids := make([]int64, 0, len(m.approximateMap[bin]))
+	for id := range m.approximateMap[bin] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		versions = append(versions, versionOf(bin, int64(len(versions)+1), m.approximateMap[bin][id], true))
+	}
+	return versions
+}
+
+//保存到内存的数据都带有来源信息
+func versionOf(bin uint32, seq int64, bindata mod.BinData, approximate bool) mod.BinVersion {
+	v := mod.BinVersion{Bin: bin, Seq: seq, Approximate: approximate, Data: bindata}
+	if p := bindata.Provenance; p != nil {
+		v.ValidFrom, v.Source, v.RangeStart, v.RangeEnd = p.ValidFrom, p.Source, p.IinStart, p.IinEnd
+	}
+	return v
+}
+
+func (m *memoryDatabase) History(bin uint32) ([]mod.BinVersion, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	versions, ok := m.history[bin]
+	if !ok {
+		versions = m.currentVersions(bin)
+	}
+	if len(versions) == 0 {
+		return nil, errors.New(fmt.Sprintf("%d not found", bin))
+	}
+	result := make([]mod.BinVersion, len(versions))
+	copy(result, versions)
+	sort.SliceStable(result, func(i, j int) bool { return result[i].ValidFrom.Before(result[j].ValidFrom) })
+	return result, nil
+}
+
+//与当前数据的规则一致: 在at之前生效的确切版本中, 按重叠策略选择
+func (m *memoryDatabase) ReadAt(bin uint32, at time.Time) (mod.BinData, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	versions, ok := m.history[bin]
+	if !ok {
+		versions = m.currentVersions(bin)
+	}
+	var (
+		found     *mod.BinVersion
+		foundMeta recordMeta
+	)
+	for i, v := range versions {
+		if v.Approximate || v.ValidFrom.After(at) {
+			continue
+		}
+		meta := newRecordMeta(v.Data, v.Source, 0, v.RangeStart, v.RangeEnd, v.ValidFrom)
+		if found == nil || preferOverlap(foundMeta, meta) {
+			found, foundMeta = &versions[i], meta
+		}
+	}
+	if found == nil {
+		return NullBinData, errors.New(fmt.Sprintf("%d not found at %s", bin, at.Format(DateTimePattern)))
+	}
+	return found.Data, nil
+}
+
+//数据的生效时间: id为UnixNano时取id, 否则取所在日期目录(YYYYMMDD)的零点, 都没有时为零值
+func versionTime(filepath string, id int64) time.Time {
+	if id >= nanoIdThreshold {
+		return time.Unix(0, id)
+	}
+	if date, err := time.ParseInLocation(DatePatternCompact, path.Base(path.Dir(filepath)), time.Local); err == nil {
+		return date
+	}
+	return time.Time{}
+}
+
+//History 当前数据库中bin的所有版本
+func History(bin string) ([]mod.BinVersion, error) {
+	var (
+		uint32bin uint32
+		err       error
+	)
+	if uint32bin, err = bin2Uint32(bin); err != nil {
+		return nil, err
+	}
+	versioned, ok := unwrapBinDatabase().(VersionedBinDatabase)
+	if !ok {
+		return nil, errors.New("当前数据库不支持历史版本查询")
+	}
+	return versioned.History(uint32bin)
+}
+
+//QueryAt 查询bin在指定时间生效的数据
+func QueryAt(bin string, at time.Time) (*mod.SimpleBinData, error) {
+	var (
+		uint32bin uint32
+		result    mod.BinData
+		err       error
+	)
+	if uint32bin, err = bin2Uint32(bin); err != nil {
+		return nil, err
+	}
+	versioned, ok := unwrapBinDatabase().(VersionedBinDatabase)
+	if !ok {
+		return nil, errors.New("当前数据库不支持历史版本查询")
+	}
+	if result, err = versioned.ReadAt(uint32bin, at); err != nil {
+		return nil, err
+	}
+	return toSimpleBinData(result), nil
+}
+
+//ParseQueryTime 解析查询时间, 只有日期时取当天结束时的状态
+func ParseQueryTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(DateTimePattern, value, time.Local); err == nil {
+		return t, nil
+	}
+	for _, pattern := range []string{DatePattern, DatePatternCompact} {
+		if t, err := time.ParseInLocation(pattern, value, time.Local); err == nil {
+			return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("invalid date %s", value))
+}
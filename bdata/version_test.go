@@ -0,0 +1,140 @@
+package bdata
+
+import (
+	"testing"
+	"time"
+)
+
+//加载数据行到新的内存数据库, 不读写文件
+func loadTestMemory(t *testing.T, rows map[string]string) *memoryDatabase {
+	t.Helper()
+	m := newMemoryDatabase()
+	for filepath, row := range rows {
+		data, err := parse(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.saveParsed(filepath, 2, data, IsApproximateFile(filepath))
+	}
+	return m
+}
+
+func TestReadAt(t *testing.T) {
+	rows := map[string]string{
+		"/data/ranges.bd":                "1,400000,400099,,,visa,,credit,,US,BASE BANK,,,,",
+		"/data/20190601/bindata.bd":      "2,400050,400069,,,visa,,credit,,US,FEEDBACK BANK,,,,",
+		"/data/vendor.bd":                "3,400045,400054,,,visa,,credit,,US,VENDOR BANK,,,,",
+		"/data/20190701/approximate.bd2": "4,400050,,,,visa,,credit,,US,GUESS BANK,,,,",
+	}
+	before := time.Date(2019, 1, 1, 0, 0, 0, 0, time.Local)
+	after := time.Date(2019, 8, 1, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		policy   string
+		priority []string
+		before   int64
+		after    int64
+	}{
+		{OverlapPolicyMostSpecific, nil, 3, 3},
+		{OverlapPolicyNewest, nil, 3, 2},
+		{OverlapPolicySourcePriority, nil, 3, 2},
+		{OverlapPolicySourcePriority, []string{SourceKindBase}, 1, 1},
+	}
+	for _, c := range cases {
+		useOverlapPolicy(t, c.policy, c.priority...)
+		m := loadTestMemory(t, rows)
+		for at, want := range map[time.Time]int64{before: c.before, after: c.after} {
+			d, err := m.ReadAt(400050, at)
+			if err != nil {
+				t.Fatalf("%s %v: %s", c.policy, c.priority, err)
+			}
+			if d.Id != want {
+				t.Errorf("%s %v at %s: id %d, want %d", c.policy, c.priority, at.Format(DatePattern), d.Id, want)
+			}
+		}
+		//当前时间的结果与当前数据一致
+		current, _ := m.ReadExact(400050)
+		if d, _ := m.ReadAt(400050, time.Now()); d.Id != current.Id {
+			t.Errorf("%s %v: ReadAt now %d, ReadExact %d", c.policy, c.priority, d.Id, current.Id)
+		}
+	}
+
+	m := loadTestMemory(t, rows)
+	if _, err := m.ReadAt(400100, after); err == nil {
+		t.Error("found bin without versions")
+	}
+}
+
+func TestVersionTime(t *testing.T) {
+	nano := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+	cases := []struct {
+		filepath string
+		id       int64
+		want     time.Time
+	}{
+		{"/data/ranges.bd", 1, time.Time{}},
+		{"/data/20190601/bindata.bd", 1, time.Date(2019, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"/data/20190601/bindata.bd", nano, time.Unix(0, nano)},
+		{"/data/import_20190601120000.bd", nano, time.Unix(0, nano)},
+	}
+	for _, c := range cases {
+		if got := versionTime(c.filepath, c.id); !got.Equal(c.want) {
+			t.Errorf("versionTime(%s, %d) = %s, want %s", c.filepath, c.id, got, c.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	rows := [][2]string{
+		{"/data/ranges.bd", "1,400000,400099,,,visa,,credit,,US,BASE BANK,,,,"},
+		{"/data/20190601/bindata.bd", "2,400050,,,,visa,,credit,,US,FEEDBACK BANK,,,,"},
+		{"/data/20190701/approximate.bd2", "3,500000,,,,visa,,credit,,US,GUESS BANK,,,,"},
+	}
+	m := newMemoryDatabase()
+	//文件重新加载时不重复记录
+	for i := 0; i < 2; i++ {
+		for _, row := range rows {
+			data, err := parse(row[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.saveParsed(row[0], 2, data, IsApproximateFile(row[0]))
+		}
+	}
+	//只有一个版本的bin不单独记录
+	if len(m.history) != 1 {
+		t.Fatalf("%d bins in history, want 1", len(m.history))
+	}
+
+	cases := []struct {
+		bin     uint32
+		ids     []int64
+		sources []string
+	}{
+		{400010, []int64{1}, []string{"/data/ranges.bd"}},
+		{400050, []int64{1, 2}, []string{"/data/ranges.bd", "/data/20190601/bindata.bd"}},
+		{500000, []int64{3}, []string{"/data/20190701/approximate.bd2"}},
+	}
+	for _, c := range cases {
+		versions, err := m.History(c.bin)
+		if err != nil {
+			t.Fatalf("%d: %s", c.bin, err)
+		}
+		if len(versions) != len(c.ids) {
+			t.Fatalf("%d: %d versions, want %d", c.bin, len(versions), len(c.ids))
+		}
+		for i, v := range versions {
+			if v.Bin != c.bin || v.Seq != int64(i+1) || v.Data.Id != c.ids[i] || v.Source != c.sources[i] {
+				t.Errorf("%d: version %d %+v", c.bin, i, v)
+			}
+		}
+	}
+	if versions, _ := m.History(400010); versions[0].RangeStart != 400000 || versions[0].RangeEnd != 400099 {
+		t.Errorf("range %d-%d", versions[0].RangeStart, versions[0].RangeEnd)
+	}
+	if _, err := m.History(600000); err == nil {
+		t.Error("found history of unknown bin")
+	}
+	if d, err := m.ReadAt(400010, time.Now()); err != nil || d.Id != 1 {
+		t.Errorf("ReadAt single version %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,296 @@
+package bdata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/mod"
+)
+
+var (
+	walFileName           = "bindata.wal"
+	walCheckpointFileName = "bindata.wal.checkpoint"
+	//默认的压缩间隔
+	DefaultCompactInterval = time.Minute
+)
+
+//write-ahead log中的一次写入
+type walEntry struct {
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+	Bin  uint32    `json:"bin"`
+	//近似数据
+	Approximate bool        `json:"approximate"`
+	Data        mod.BinData `json:"data"`
+}
+
+//feedback写入的write-ahead log, 每次写入都会fsync
+//checkpoint文件记录已压缩到数据文件的最大序号, 启动时重放之后的记录
+type writeAheadLog struct {
+	mutex      sync.Mutex
+	filepath   string
+	checkpoint string
+	file       *os.File
+	seq        int64
+	compacted  int64
+}
+
+//打开write-ahead log, 返回未压缩的记录
+func openWriteAheadLog(dataDir string) (*writeAheadLog, []walEntry, error) {
+	w, entries, err := readWriteAheadLog(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if w.file, err = os.OpenFile(w.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, nil, err
+	}
+	return w, entries, nil
+}
+
+//读取checkpoint及未压缩的记录, 不打开文件写入, 离线加载数据目录时也使用
+func readWriteAheadLog(dataDir string) (*writeAheadLog, []walEntry, error) {
+	w := &writeAheadLog{
+		filepath:   strings.Join([]string{dataDir, walFileName}, "/"),
+		checkpoint: strings.Join([]string{dataDir, walCheckpointFileName}, "/")}
+	var err error
+	if w.compacted, err = readCheckpoint(w.checkpoint); err != nil {
+		return nil, nil, err
+	}
+	w.seq = w.compacted
+
+	var entries []walEntry
+	if entries, err = w.readPending(); err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.Seq > w.seq {
+			w.seq = e.Seq
+		}
+	}
+	return w, entries, nil
+}
+
+//追加一条记录并fsync
+func (w *writeAheadLog) append(entry walEntry) (walEntry, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	entry.Seq = w.seq + 1
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	if _, err = w.file.Write(append(data, '\n')); err != nil {
+		return entry, err
+	}
+	if err = w.file.Sync(); err != nil {
+		return entry, err
+	}
+	w.seq = entry.Seq
+	return entry, nil
+}
+
+//读取序号大于checkpoint的记录, 最后一行不完整(写入时崩溃)时忽略
+func (w *writeAheadLog) readPending() ([]walEntry, error) {
+	file, err := os.Open(w.filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		result  []walEntry
+		broken  int
+		lineNum int
+	)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		var e walEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			broken = lineNum
+			continue
+		}
+		if broken > 0 {
+			return nil, errors.New(fmt.Sprintf("%s:%d: 无法解析", w.filepath, broken))
+		}
+		if e.Seq > w.compacted {
+			result = append(result, e)
+		}
+	}
+	if broken > 0 {
+		logger.Warnf("忽略write-ahead log中不完整的最后一行, %s:%d", w.filepath, broken)
+	}
+	return result, scanner.Err()
+}
+
+//将未压缩的记录写入按日期分区的数据文件, 更新checkpoint后清空write-ahead log
+//path返回记录对应的数据文件, 数据文件中已存在相同id的记录会被跳过, 保证重复压缩是幂等的
+func (w *writeAheadLog) compact(path func(e walEntry) string) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	entries, err := w.readPending()
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+
+	existingIds := make(map[string]map[int64]bool)
+	written := 0
+	for _, e := range entries {
+		filepath := path(e)
+		ids, ok := existingIds[filepath]
+		if !ok {
+			if ids, err = readIds(filepath); err != nil {
+				return written, err
+			}
+			existingIds[filepath] = ids
+		}
+		if ids[e.Data.Id] {
+			continue
+		}
+		if err = write2File(e.Bin, filepath, e.Data); err != nil {
+			return written, err
+		}
+		ids[e.Data.Id] = true
+		written++
+	}
+
+	last := entries[len(entries)-1].Seq
+	if err = writeCheckpoint(w.checkpoint, last); err != nil {
+		return written, err
+	}
+	w.compacted = last
+	//checkpoint之前的记录已全部写入数据文件, 可以清空
+	if err = w.file.Truncate(0); err != nil {
+		return written, err
+	}
+	return written, w.file.Sync()
+}
+
+func (w *writeAheadLog) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.file.Close()
+}
+
+//数据文件中已有的id
+func readIds(filepath string) (map[int64]bool, error) {
+	result := make(map[int64]bool)
+	lines, err := ReadBinDataFile(filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	for _, line := range lines {
+		if values, _, err := splitRecord(line); err == nil {
+			if id, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+				result[id] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+func readCheckpoint(filepath string) (int64, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+//先写临时文件再rename, 避免写入一半时崩溃
+func writeCheckpoint(filepath string, seq int64) error {
+	tmp := filepath + ".tmp"
+	if err := writeLines(tmp, []string{strconv.FormatInt(seq, 10)}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath)
+}
+
+//打开write-ahead log, 重放未压缩的记录并启动定时压缩
+func (m *memoryDatabase) openWal(cfg BinDataConfig) error {
+	var (
+		entries []walEntry
+		err     error
+	)
+	if m.wal, entries, err = openWriteAheadLog(cfg.DataDir); err != nil {
+		return err
+	}
+	m.replayWal(entries)
+	if len(entries) > 0 {
+		logger.Infof("重放write-ahead log %d 条记录", len(entries))
+	}
+
+	m.compact()
+	interval := cfg.CompactInterval
+	if interval <= 0 {
+		interval = DefaultCompactInterval
+	}
+	go func() {
+		for range time.Tick(interval) {
+			m.compact()
+		}
+	}()
+	return nil
+}
+
+//将未压缩的记录写入内存, 来源为压缩后对应的数据文件
+func (m *memoryDatabase) replayWal(entries []walEntry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, e := range entries {
+		source := m.dataFilePath(e.Time, e.Approximate)
+		meta := newRecordMeta(e.Data, source, 0, e.Bin, e.Bin, e.Time)
+		m.addVersion(e.Bin, e.Data, e.Approximate, meta)
+		m.save2Memory(e.Bin, e.Data, e.Approximate, meta)
+	}
+}
+
+//Close 压缩剩余的记录并关闭write-ahead log
+func (m *memoryDatabase) Close() error {
+	if m.wal == nil {
+		return nil
+	}
+	m.compact()
+	return m.wal.close()
+}
+
+func (m *memoryDatabase) compact() {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("compact write-ahead log panic: %v", err)
+		}
+	}()
+	written, err := m.wal.compact(func(e walEntry) string { return m.dataFilePath(e.Time, e.Approximate) })
+	if err != nil {
+		logger.Errorf("compact write-ahead log error: %s", err)
+		return
+	}
+	if written > 0 {
+		logger.Infof("write-ahead log压缩完成, 写入 %d 条记录", written)
+	}
+}
@@ -0,0 +1,173 @@
+package bdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	w, entries, err := openWriteAheadLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 || w.seq != 0 {
+		t.Fatalf("new log: %d entries, seq %d", len(entries), w.seq)
+	}
+	for i, bin := range []uint32{400000, 400001, 400002} {
+		entry, err := w.append(walEntry{Time: time.Now(), Bin: bin, Data: testBinData(int64(i+1), bin, bin, "TEST BANK")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Seq != int64(i+1) {
+			t.Errorf("seq %d, want %d", entry.Seq, i+1)
+		}
+	}
+	w.close()
+
+	//重新打开时返回未压缩的记录, 序号继续递增
+	if w, entries, err = openWriteAheadLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Bin != 400002 || entries[2].Data.Id != 3 || w.seq != 3 {
+		t.Fatalf("replay: %+v, seq %d", entries, w.seq)
+	}
+
+	//数据文件中已存在的id跳过, 重复压缩是幂等的
+	dataFile := filepath.Join(dir, "bindata.bd")
+	writeDataFile(t, dataFile, "2,400001,,,,visa,,,,US,TEST BANK,,,,")
+	path := func(e walEntry) string { return dataFile }
+	written, err := w.compact(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 {
+		t.Errorf("written %d, want 2", written)
+	}
+	if ids, _ := readIds(dataFile); len(ids) != 3 {
+		t.Errorf("ids %v", ids)
+	}
+	if checkpoint, _ := readCheckpoint(filepath.Join(dir, walCheckpointFileName)); checkpoint != 3 {
+		t.Errorf("checkpoint %d, want 3", checkpoint)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, walFileName)); info.Size() != 0 {
+		t.Errorf("log size %d after compaction", info.Size())
+	}
+	if written, _ = w.compact(path); written != 0 {
+		t.Errorf("second compaction wrote %d", written)
+	}
+
+	if _, err = w.append(walEntry{Time: time.Now(), Bin: 400003, Data: testBinData(4, 400003, 400003, "TEST BANK")}); err != nil {
+		t.Fatal(err)
+	}
+	w.close()
+	if w, entries, err = openWriteAheadLog(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	if len(entries) != 1 || entries[0].Seq != 4 || w.seq != 4 {
+		t.Errorf("after compaction: %+v, seq %d", entries, w.seq)
+	}
+}
+
+func TestWriteAheadLogBrokenLine(t *testing.T) {
+	cases := []struct {
+		name       string
+		content    string
+		checkpoint int64
+		entries    int
+		err        bool
+	}{
+		{"torn last line", "{\"seq\":1,\"bin\":400000}\n{\"seq\":2,\"bi", 0, 1, false},
+		{"broken middle line", "{\"seq\":1,\"bin\":400000}\nbroken\n{\"seq\":3,\"bin\":400002}\n", 0, 0, true},
+		{"below checkpoint", "{\"seq\":1,\"bin\":400000}\n{\"seq\":2,\"bin\":400001}\n", 2, 0, false},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if c.checkpoint > 0 {
+			writeCheckpoint(filepath.Join(dir, walCheckpointFileName), c.checkpoint)
+		}
+		w, entries, err := openWriteAheadLog(dir)
+		if (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.name, err)
+			continue
+		}
+		if w != nil {
+			w.close()
+		}
+		if len(entries) != c.entries {
+			t.Errorf("%s: %d entries, want %d", c.name, len(entries), c.entries)
+		}
+	}
+}
+
+func TestOpenWalReplay(t *testing.T) {
+	m := useTestMemory(t)
+	w, _, err := openWriteAheadLog(m.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	w.append(walEntry{Time: now, Bin: 400000, Data: testBinData(1, 400000, 400000, "TEST BANK")})
+	w.append(walEntry{Time: now, Bin: 400000, Data: testBinData(2, 400000, 400000, "NEW BANK")})
+	w.append(walEntry{Time: now, Bin: 500000, Approximate: true, Data: testBinData(3, 500000, 500000, "GUESS BANK")})
+	w.close()
+
+	if err = m.openWal(BinDataConfig{DataDir: m.dataDir, CompactInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := m.ReadExact(400000); err != nil || d.Id != 2 {
+		t.Errorf("exact %+v %v", d, err)
+	}
+	if approximate := m.approximateMap[500000]; len(approximate) != 1 {
+		t.Errorf("approximate %v", approximate)
+	}
+	//重放后立即压缩到数据文件
+	if ids, _ := readIds(m.dataFilePath(now, false)); !ids[1] || !ids[2] {
+		t.Errorf("exact ids %v", ids)
+	}
+	if ids, _ := readIds(m.dataFilePath(now, true)); !ids[3] {
+		t.Errorf("approximate ids %v", ids)
+	}
+	if err = m.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadDatasetWal(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "ranges.bd"), "1,400000,,,,visa,,credit,,US,TEST BANK,,,,")
+	w, _, err := openWriteAheadLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	w.append(walEntry{Time: now, Bin: 500000, Data: testBinData(2, 500000, 500000, "NEW BANK")})
+	w.append(walEntry{Time: now, Bin: 600000, Approximate: true, Data: testBinData(3, 600000, 600000, "GUESS BANK")})
+	w.close()
+	walFile := filepath.Join(dir, walFileName)
+	original, _ := os.ReadFile(walFile)
+
+	dataset, err := LoadDataset(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := dataset.Lookup(500000); !ok || d.Id != 2 || dataset.WalEntries != 2 {
+		t.Errorf("wal record %+v %v, %d entries", d, ok, dataset.WalEntries)
+	}
+	if len(dataset.Approximate[600000]) != 1 {
+		t.Errorf("approximate %v", dataset.Approximate[600000])
+	}
+	//离线加载不压缩write-ahead log
+	if content, _ := os.ReadFile(walFile); string(content) != string(original) {
+		t.Error("write-ahead log changed")
+	}
+	if _, err = os.Stat(filepath.Join(dir, now.Format(DatePatternCompact))); !os.IsNotExist(err) {
+		t.Errorf("data file written: %v", err)
+	}
+}
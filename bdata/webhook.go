@@ -0,0 +1,304 @@
+package bdata
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	webhookFileName = "webhooks.json"
+	//投递失败时的重试间隔, 按指数退避
+	webhookMinBackoff = time.Second
+	webhookMaxBackoff = 5 * time.Minute
+	webhookBatchSize  = 100
+)
+
+//Webhook 注册的webhook, 事件按序号顺序投递, 失败时重试直到成功
+//请求头X-Bindb-Signature为sha256=hex(hmac_sha256(secret, body))
+type Webhook struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	//只投递这些类型的事件, 为空时投递全部, reset事件总会投递
+	Types []string `json:"types,omitempty"`
+	//已投递的最大序号
+	Delivered int64     `json:"delivered"`
+	Created   time.Time `json:"created"`
+}
+
+//WebhookStatus webhook的投递状态, 不包含secret
+type WebhookStatus struct {
+	Id        string    `json:"id"`
+	Url       string    `json:"url"`
+	Types     []string  `json:"types,omitempty"`
+	Delivered int64     `json:"delivered"`
+	Created   time.Time `json:"created"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type webhookWorker struct {
+	mutex     sync.Mutex
+	hook      Webhook
+	failures  int
+	lastError string
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type webhookRegistry struct {
+	mutex    sync.Mutex
+	filepath string
+	workers  []*webhookWorker
+	client   *http.Client
+}
+
+var webhooks = &webhookRegistry{client: &http.Client{Timeout: 10 * time.Second}}
+
+//读取数据目录下已注册的webhook并开始投递
+func openWebhooks(dataDir string) error {
+	webhooks.mutex.Lock()
+	defer webhooks.mutex.Unlock()
+	webhooks.filepath = strings.Join([]string{dataDir, webhookFileName}, "/")
+	data, err := ioutil.ReadFile(webhooks.filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var hooks []Webhook
+	if err = json.Unmarshal(data, &hooks); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		webhooks.start(hook)
+	}
+	return nil
+}
+
+func (r *webhookRegistry) start(hook Webhook) *webhookWorker {
+	w := &webhookWorker{hook: hook, stop: make(chan struct{}), done: make(chan struct{})}
+	r.workers = append(r.workers, w)
+	go w.run()
+	return w
+}
+
+//保存所有webhook及投递进度, 调用方需持有锁
+func (r *webhookRegistry) save() error {
+	if r.filepath == "" {
+		return errors.New("存储地址未配置")
+	}
+	hooks := make([]Webhook, 0, len(r.workers))
+	for _, w := range r.workers {
+		w.mutex.Lock()
+		hooks = append(hooks, w.hook)
+		w.mutex.Unlock()
+	}
+	data, err := json.MarshalIndent(hooks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.filepath + ".tmp"
+	if err = writeLines(tmp, []string{string(data)}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.filepath)
+}
+
+//AddWebhook 注册webhook, 从当前最新的事件之后开始投递, secret为空时自动生成
+func AddWebhook(rawurl, secret string, types []string) (Webhook, error) {
+	if u, err := url.Parse(rawurl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, errors.New(fmt.Sprintf("非法的url %s", rawurl))
+	}
+	if secret == "" {
+		secret = randomHex(32)
+	}
+	hook := Webhook{Id: randomHex(8), Url: rawurl, Secret: secret, Types: types, Delivered: LatestChangeSeq(), Created: time.Now().UTC()}
+
+	webhooks.mutex.Lock()
+	if webhooks.filepath == "" {
+		webhooks.mutex.Unlock()
+		return Webhook{}, errors.New("存储地址未配置")
+	}
+	w := webhooks.start(hook)
+	err := webhooks.save()
+	if err != nil {
+		webhooks.workers = webhooks.workers[:len(webhooks.workers)-1]
+	}
+	webhooks.mutex.Unlock()
+	//worker保存进度时需要获取锁, 需在释放锁之后停止
+	if err != nil {
+		w.close()
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+//RemoveWebhook 删除webhook并停止投递
+func RemoveWebhook(id string) error {
+	webhooks.mutex.Lock()
+	for i, w := range webhooks.workers {
+		if w.hook.Id == id {
+			webhooks.workers = append(webhooks.workers[:i:i], webhooks.workers[i+1:]...)
+			err := webhooks.save()
+			webhooks.mutex.Unlock()
+			w.close()
+			return err
+		}
+	}
+	webhooks.mutex.Unlock()
+	return errors.New(fmt.Sprintf("webhook %s not found", id))
+}
+
+//ListWebhooks 已注册的webhook及投递状态
+func ListWebhooks() []WebhookStatus {
+	webhooks.mutex.Lock()
+	defer webhooks.mutex.Unlock()
+	result := make([]WebhookStatus, 0, len(webhooks.workers))
+	for _, w := range webhooks.workers {
+		w.mutex.Lock()
+		result = append(result, WebhookStatus{Id: w.hook.Id, Url: w.hook.Url, Types: w.hook.Types, Delivered: w.hook.Delivered,
+			Created: w.hook.Created, Failures: w.failures, LastError: w.lastError})
+		w.mutex.Unlock()
+	}
+	return result
+}
+
+func stopWebhooks() {
+	webhooks.mutex.Lock()
+	workers := append([]*webhookWorker(nil), webhooks.workers...)
+	webhooks.mutex.Unlock()
+	for _, w := range workers {
+		w.close()
+	}
+}
+
+func (w *webhookWorker) close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *webhookWorker) run() {
+	defer close(w.done)
+	for {
+		w.mutex.Lock()
+		delivered := w.hook.Delivered
+		w.mutex.Unlock()
+
+		events, changed := ChangesSince(delivered, webhookBatchSize)
+		if len(events) == 0 {
+			select {
+			case <-w.stop:
+				return
+			case <-changed:
+			}
+			continue
+		}
+		for _, e := range events {
+			if w.accept(e.Type) && !w.deliver(e) {
+				return
+			}
+			w.mutex.Lock()
+			w.hook.Delivered = e.Seq
+			w.mutex.Unlock()
+		}
+		webhooks.mutex.Lock()
+		if err := webhooks.save(); err != nil {
+			logger.Errorf("保存webhook进度失败: %s", err)
+		}
+		webhooks.mutex.Unlock()
+	}
+}
+
+func (w *webhookWorker) accept(eventType string) bool {
+	if len(w.hook.Types) == 0 || eventType == ChangeTypeReset {
+		return true
+	}
+	return contains(w.hook.Types, eventType)
+}
+
+//投递一个事件, 失败时退避重试直到成功, 停止时返回false
+func (w *webhookWorker) deliver(e ChangeEvent) bool {
+	body, err := json.Marshal(e)
+	if err != nil {
+		logger.Errorf("marshal change event error: %s", err)
+		return true
+	}
+	backoff := webhookMinBackoff
+	for {
+		if err = w.post(e, body); err == nil {
+			w.mutex.Lock()
+			w.failures = 0
+			w.lastError = ""
+			w.mutex.Unlock()
+			return true
+		}
+		w.mutex.Lock()
+		w.failures++
+		w.lastError = err.Error()
+		w.mutex.Unlock()
+		logger.Warnf("webhook %s deliver #%d error: %s, retry in %s", w.hook.Url, e.Seq, err, backoff)
+
+		select {
+		case <-w.stop:
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+func (w *webhookWorker) post(e ChangeEvent, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bindb-Event", e.Type)
+	req.Header.Set("X-Bindb-Delivery", strconv.FormatInt(e.Seq, 10))
+	req.Header.Set("X-Bindb-Signature", WebhookSignature(w.hook.Secret, body))
+	resp, err := webhooks.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("http status %d", resp.StatusCode))
+	}
+	return nil
+}
+
+//WebhookSignature 请求体的签名, 接收方用相同的secret计算后比较
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
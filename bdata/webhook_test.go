@@ -0,0 +1,170 @@
+package bdata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//使用新的webhook注册表, 重试间隔缩短
+func useTestWebhooks(t *testing.T, dir string) {
+	t.Helper()
+	savedWebhooks, savedBackoff := webhooks, webhookMinBackoff
+	t.Cleanup(func() {
+		stopWebhooks()
+		webhooks, webhookMinBackoff = savedWebhooks, savedBackoff
+	})
+	webhooks = &webhookRegistry{client: &http.Client{Timeout: time.Second}}
+	webhookMinBackoff = 10 * time.Millisecond
+	if err := openWebhooks(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//记录收到的请求, 前failures次返回500
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+}
+
+func (r *webhookReceiver) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.requests)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	cases := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		//RFC 4231 test case 2
+		{"Jefe", "what do ya want for nothing?", "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"", "", "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+	}
+	for _, c := range cases {
+		if got := WebhookSignature(c.secret, []byte(c.body)); got != c.want {
+			t.Errorf("%q %q: %s, want %s", c.secret, c.body, got, c.want)
+		}
+	}
+	if WebhookSignature("a", []byte("body")) == WebhookSignature("b", []byte("body")) {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestAddWebhook(t *testing.T) {
+	cases := []struct {
+		url string
+		err bool
+	}{
+		{"http://example.com/hook", false},
+		{"https://example.com/hook", false},
+		{"ftp://example.com/hook", true},
+		{"http:///hook", true},
+		{"example.com/hook", true},
+	}
+	useTestFeed(t, 100)
+	useTestWebhooks(t, t.TempDir())
+	for _, c := range cases {
+		hook, err := AddWebhook(c.url, "", nil)
+		if (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.url, err)
+			continue
+		}
+		if err == nil && (len(hook.Secret) != 64 || len(hook.Id) != 16) {
+			t.Errorf("%s: generated secret %q id %q", c.url, hook.Secret, hook.Id)
+		}
+	}
+	if hooks := ListWebhooks(); len(hooks) != 2 {
+		t.Errorf("%d webhooks, want 2", len(hooks))
+	}
+	if err := RemoveWebhook("missing"); err == nil {
+		t.Error("removed missing webhook")
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	dir := useTestFeed(t, 100)
+	useTestWebhooks(t, dir)
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	//注册之前的事件不投递
+	publishChange(AuditActionBinCreate, "400000", nil)
+	hook, err := AddWebhook(server.URL, "secret", []string{AuditActionBinCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishChange(AuditActionBinCreate, "400001", nil)
+	publishChange(AuditActionBankNameCreate, "TEST BANK", "测试银行")
+	publishChange(AuditActionBinCreate, "400002", nil)
+
+	//失败后重试, 只投递订阅的类型, 按序号顺序
+	waitFor(t, "delivery", func() bool { return receiver.count() == 2 })
+	for i, seq := range []int64{2, 4} {
+		req, body := receiver.requests[i], receiver.bodies[i]
+		if req.Header.Get("X-Bindb-Delivery") != strconv.FormatInt(seq, 10) || req.Header.Get("X-Bindb-Event") != AuditActionBinCreate {
+			t.Errorf("request %d headers %v", i, req.Header)
+		}
+		if req.Header.Get("X-Bindb-Signature") != WebhookSignature("secret", body) {
+			t.Errorf("request %d signature mismatch", i)
+		}
+	}
+	waitFor(t, "progress", func() bool {
+		hooks := ListWebhooks()
+		return len(hooks) == 1 && hooks[0].Delivered == 4 && hooks[0].Failures == 0
+	})
+
+	//重新打开时从保存的进度继续
+	stopWebhooks()
+	publishChange(AuditActionBinCreate, "400003", nil)
+	webhooks = &webhookRegistry{client: &http.Client{Timeout: time.Second}}
+	if err = openWebhooks(dir); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "resume", func() bool { return receiver.count() == 3 })
+	if seq := receiver.requests[2].Header.Get("X-Bindb-Delivery"); seq != "5" {
+		t.Errorf("resumed at %s, want 5", seq)
+	}
+
+	if err = RemoveWebhook(hook.Id); err != nil {
+		t.Fatal(err)
+	}
+	publishChange(AuditActionBinCreate, "400004", nil)
+	time.Sleep(50 * time.Millisecond)
+	if receiver.count() != 3 {
+		t.Error("delivered after the webhook was removed")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"time"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//追加一条bin数据, 与服务端feedback写入逻辑一致
+func appendBinData(args []string) error {
+	fs := flag.NewFlagSet("append", flag.ExitOnError)
+	filepath := fs.String("f", "", "-f /home/testuser/bindata/20190601/bindata.bd")
+	bin := fs.String("bin", "", "-bin 622848")
+	iinEnd := fs.String("end", "", "-end 622849, 区间结束bin")
+	var bindata mod.BinData
+	fs.StringVar(&bindata.Schema, "scheme", "", "-scheme visa")
+	fs.StringVar(&bindata.Brand, "brand", "", "-brand Classic")
+	fs.StringVar(&bindata.CardType, "type", "", "-type debit")
+	fs.StringVar(&bindata.Prepaid, "prepaid", "", "-prepaid")
+	fs.StringVar(&bindata.Country, "country", "", "-country CN")
+	fs.StringVar(&bindata.BankName, "bank", "", "-bank \"AGRICULTURAL BANK OF CHINA\"")
+	fs.StringVar(&bindata.BankLogo, "logo", "", "-logo")
+	fs.StringVar(&bindata.BankUrl, "url", "", "-url www.abchina.com")
+	fs.StringVar(&bindata.BankPhone, "phone", "", "-phone 95599")
+	fs.StringVar(&bindata.BankCity, "city", "", "-city Beijing")
+	fs.Parse(args)
+
+	if *filepath == "" {
+		return errors.New("缺少目标文件")
+	}
+	if !bdata.IsBinDataFile(*filepath) {
+		return errors.New("目标文件必须为.bd或.bd2文件")
+	}
+	if bindata.BankName == "" || bindata.CardType == "" {
+		return errors.New("bank和type不能为空")
+	}
+
+	var (
+		ibin uint64
+		err  error
+	)
+	if ibin, err = strconv.ParseUint(*bin, 10, 32); err != nil {
+		return errors.New("invalid bin " + *bin)
+	}
+	bindata.IinStart = uint32(ibin)
+	if *iinEnd != "" {
+		if ibin, err = strconv.ParseUint(*iinEnd, 10, 32); err != nil {
+			return errors.New("invalid bin " + *iinEnd)
+		}
+		if uint32(ibin) < bindata.IinStart {
+			return errors.New("区间结束bin不能小于开始bin")
+		}
+		bindata.IinEnd = uint32(ibin)
+	}
+	bindata.Id = time.Now().UnixNano()
+	return bdata.AppendBinData(*filepath, bindata)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//校验数据目录下审计日志的hash链
+func verifyAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	fs.Parse(args)
+
+	filepath := bdata.AuditFilePath(*dataDir)
+	if fs.NArg() > 0 {
+		filepath = fs.Arg(0)
+	}
+	result, err := bdata.VerifyAuditLog(filepath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(result); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errors.New(fmt.Sprintf("%s 校验失败", filepath))
+	}
+	return nil
+}
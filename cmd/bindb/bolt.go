@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//将数据目录中的数据文件批量导入bbolt数据库
+func boltImport(args []string) error {
+	fs := flag.NewFlagSet("bolt", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	dbPath := fs.String("o", "", "-o /home/testuser/bindata.db, 默认为数据目录下的bindata.db")
+	fs.Parse(args)
+
+	if *dbPath == "" {
+		*dbPath = bdata.BoltFilePath(*dataDir)
+	}
+	count, err := bdata.BoltImport(*dbPath, *dataDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d bins into %s\n", count, *dbPath)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//将区间数据展开为单个bin
+func expand(args []string) error {
+	fs := flag.NewFlagSet("expand", flag.ExitOnError)
+	input := fs.String("i", "", "-i ranges.bd")
+	output := fs.String("o", "", "-o singles.bd, 默认输出到stdout")
+	fs.Parse(args)
+	if *input == "" {
+		return errors.New("缺少输入文件")
+	}
+
+	var (
+		lines []string
+		err   error
+	)
+	if lines, err = bdata.ReadBinDataFile(*input); err != nil {
+		return err
+	}
+	return writeBinDataFile(*output, func(w io.Writer) error {
+		for i, line := range lines {
+			var data []mod.BinData
+			if data, err = bdata.ParseBinData(line); err != nil {
+				return errors.New(fmt.Sprintf("%s:%d: %s", *input, i+2, err))
+			}
+			for _, d := range data {
+				if _, err = fmt.Fprintln(w, bdata.FormatBinData(d)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//将相邻且属性相同的单个bin合并为区间, 只支持确切数据, 近似数据同一个bin有多条, 无法合并
+func compress(args []string) error {
+	fs := flag.NewFlagSet("compress", flag.ExitOnError)
+	input := fs.String("i", "", "-i singles.bd")
+	output := fs.String("o", "", "-o ranges.bd, 默认输出到stdout")
+	fs.Parse(args)
+	if *input == "" {
+		return errors.New("缺少输入文件")
+	}
+	if bdata.IsApproximateFile(*input) {
+		return errors.New(fmt.Sprintf("%s 为近似数据文件, 不支持合并区间", *input))
+	}
+
+	var (
+		dataset *bdata.Dataset
+		err     error
+	)
+	if dataset, err = bdata.LoadDataset(*input); err != nil {
+		return err
+	}
+	if len(dataset.Approximate) > 0 {
+		return errors.New(fmt.Sprintf("%s 包含近似数据, 不支持合并区间", *input))
+	}
+	return writeBinDataFile(*output, func(w io.Writer) error {
+		for _, d := range bdata.CompressRanges(dataset.Records()) {
+			if _, err = fmt.Fprintln(w, bdata.FormatBinData(d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//写入完整的bin数据文件(含header), filepath为空时输出到stdout
+func writeBinDataFile(filepath string, fn func(w io.Writer) error) error {
+	out := os.Stdout
+	if filepath != "" {
+		var err error
+		if out, err = os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if _, err := fmt.Fprintln(w, bdata.BinDataHeader()); err != nil {
+		return err
+	}
+	if err := fn(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//比较两个数据目录或数据文件
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "-json, 以json格式输出")
+	summaryOnly := fs.Bool("s", false, "-s, 只输出统计")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("需要指定两个数据目录或数据文件")
+	}
+
+	var (
+		before, after *bdata.Dataset
+		err           error
+	)
+	if before, err = bdata.LoadDataset(fs.Arg(0)); err != nil {
+		return err
+	}
+	if after, err = bdata.LoadDataset(fs.Arg(1)); err != nil {
+		return err
+	}
+	result := bdata.DiffDatasets(before, after)
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return result.WriteText(os.Stdout, *summaryOnly)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//导出数据目录中生效的数据
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	format := fs.String("format", bdata.ExportFormatCSV, "-format [csv|jsonl|ranges]")
+	countries := fs.String("country", "", "-country US,GB")
+	schemes := fs.String("scheme", "", "-scheme visa,mastercard")
+	output := fs.String("o", "", "-o bindb.csv, 默认输出到stdout")
+	fs.Parse(args)
+
+	if _, _, err := bdata.ExportContentType(*format); err != nil {
+		return err
+	}
+	var (
+		dataset *bdata.Dataset
+		err     error
+	)
+	if dataset, err = bdata.LoadDataset(*dataDir); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	filter := bdata.ParseExportFilter(*countries, *schemes)
+	return bdata.Export(out, *format, filter, bdata.ScanRecords(dataset.Records()))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//查询bin的历史版本, 或指定日期生效的数据
+func history(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	date := fs.String("at", "", "-at 2019-06-01, 查询该日期生效的数据")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("缺少bin参数")
+	}
+
+	var (
+		ibin    uint64
+		dataset *bdata.Dataset
+		err     error
+	)
+	if ibin, err = strconv.ParseUint(fs.Arg(0), 10, 32); err != nil {
+		return errors.New(fmt.Sprintf("invalid bin %s", fs.Arg(0)))
+	}
+	if dataset, err = bdata.LoadDataset(*dataDir); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if *date != "" {
+		var (
+			at     time.Time
+			result mod.BinData
+		)
+		if at, err = bdata.ParseQueryTime(*date); err != nil {
+			return err
+		}
+		if result, err = dataset.ReadAt(uint32(ibin), at); err != nil {
+			return err
+		}
+		return encoder.Encode(result)
+	}
+
+	var versions []mod.BinVersion
+	if versions, err = dataset.History(uint32(ibin)); err != nil {
+		return err
+	}
+	return encoder.Encode(versions)
+}
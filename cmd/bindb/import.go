@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//导入第三方格式的bin数据
+func importBinData(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "binlist", fmt.Sprintf("-format [%s]", strings.Join(bdata.ImportAdapterNames(), "|")))
+	input := fs.String("i", "", "-i vendor.csv")
+	dataDir := fs.String("d", "", "-d /home/testuser/bindata, 与现有数据对比")
+	mapping := fs.String("map", "", "-map issuer_name=bank_name,iso=country, 供应商列名=bin数据列名")
+	columns := fs.String("columns", "", "-columns iin_start:0-10,iin_end:10-20,scheme:20-30, 定宽格式的列定义")
+	binLength := fs.Int("bin-length", 0, "-bin-length 8, bin超过该长度时截取前缀")
+	maxRange := fs.Int("max-range", bdata.DefaultImportMaxRange, "-max-range 100000, 一个区间最多展开的bin数")
+	output := fs.String("o", "", "-o vendor.bd, 输出转换后的全部数据")
+	merge := fs.Bool("merge", false, "-merge, 将新增数据写入数据目录")
+	changes := fs.Bool("changes", false, "-changes, 合并时同时写入有变化的数据")
+	dryRun := fs.Bool("n", false, "-n, 只输出报告不写入")
+	jsonOutput := fs.Bool("json", false, "-json, 以json格式输出报告")
+	fs.Parse(args)
+
+	if *input == "" {
+		return errors.New("缺少输入文件")
+	}
+	if *merge && *dataDir == "" {
+		return errors.New("合并时需要指定数据目录")
+	}
+
+	opts := bdata.ImportOptions{Mapping: make(map[string]string), BinLength: *binLength, MaxRange: *maxRange}
+	for _, kv := range strings.Split(*mapping, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return errors.New(fmt.Sprintf("invalid mapping %s", kv))
+		}
+		opts.Mapping[pair[0]] = pair[1]
+	}
+	var err error
+	if *columns != "" {
+		if opts.Columns, err = bdata.ParseFixedColumns(*columns); err != nil {
+			return err
+		}
+	}
+
+	var in *os.File
+	if in, err = os.Open(*input); err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var (
+		records  []mod.BinData
+		rejected []bdata.ImportRejection
+	)
+	if records, rejected, err = bdata.ReadImport(*format, in, opts); err != nil {
+		return err
+	}
+
+	existing := func(bin uint32) (mod.BinData, bool) { return bdata.NullBinData, false }
+	if *dataDir != "" {
+		var dataset *bdata.Dataset
+		if dataset, err = bdata.LoadDataset(*dataDir); err != nil {
+			return err
+		}
+		existing = dataset.Lookup
+	}
+	report := bdata.PlanImport(records, rejected, existing)
+	if err = printImportReport(report, *jsonOutput); err != nil {
+		return err
+	}
+	if *dryRun {
+		return nil
+	}
+
+	if *output != "" {
+		if err = bdata.WriteBinDataFile(*output, records); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "已写入 %s\n", *output)
+	}
+	if *merge {
+		data := report.Records(*changes)
+		if len(data) == 0 {
+			fmt.Fprintln(os.Stderr, "没有需要合并的数据")
+			return nil
+		}
+		filepath := bdata.ImportFilePath(*dataDir, time.Now())
+		if err = bdata.WriteBinDataFile(filepath, data); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "已合并 %d 个bin到 %s\n", len(data), filepath)
+	}
+	return nil
+}
+
+func printImportReport(report bdata.ImportReport, jsonOutput bool) error {
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Printf("total:     %d\n", report.Total)
+	fmt.Printf("added:     %d\n", len(report.Added))
+	fmt.Printf("changed:   %d\n", len(report.Changed))
+	fmt.Printf("unchanged: %d\n", report.Unchanged)
+	fmt.Printf("conflicts: %d\n", len(report.Conflicts))
+	fmt.Printf("rejected:  %d\n", len(report.Rejected))
+	for _, c := range report.Changed {
+		for _, field := range c.Fields {
+			fmt.Printf("~ %d %s: %q -> %q\n", c.Bin, field, bdata.GetColumn(*c.Before, field), bdata.GetColumn(c.After, field))
+		}
+	}
+	for _, c := range report.Conflicts {
+		fmt.Printf("! %d: %d条属性不同的数据\n", c.Bin, len(c.Records))
+	}
+	for _, r := range report.Rejected {
+		fmt.Printf("x line %d: %s\n", r.Line, r.Reason)
+	}
+	return nil
+}
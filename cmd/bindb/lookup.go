@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//在数据目录中查询bin
+func lookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("缺少bin参数")
+	}
+
+	var (
+		dataset *bdata.Dataset
+		err     error
+	)
+	if dataset, err = bdata.LoadDataset(*dataDir); err != nil {
+		return err
+	}
+
+	notFound := 0
+	for _, bin := range fs.Args() {
+		var ibin uint64
+		if ibin, err = strconv.ParseUint(bin, 10, 32); err != nil {
+			return errors.New(fmt.Sprintf("invalid bin %s", bin))
+		}
+		result := struct {
+			Bin         string        `json:"bin"`
+			Exact       *mod.BinData  `json:"exact,omitempty"`
+			Approximate []mod.BinData `json:"approximate,omitempty"`
+		}{Bin: bin}
+		if d, ok := dataset.Lookup(uint32(ibin)); ok {
+			result.Exact = &d
+		}
+		for _, d := range dataset.Approximate[uint32(ibin)] {
+			result.Approximate = append(result.Approximate, d)
+		}
+		if result.Exact == nil && len(result.Approximate) == 0 {
+			notFound++
+		}
+		var data []byte
+		if data, err = json.MarshalIndent(result, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	if notFound > 0 {
+		return errors.New(fmt.Sprintf("%d 个bin不存在", notFound))
+	}
+	return nil
+}
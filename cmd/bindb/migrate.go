@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/file"
+)
+
+//将旧格式的数据文件重写为RFC 4180格式
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	dryRun := fs.Bool("n", false, "-n, 只统计不写入")
+	noBackup := fs.Bool("no-backup", false, "-no-backup, 不保留.bak备份文件")
+	fs.Parse(args)
+
+	filepaths := fs.Args()
+	if len(filepaths) == 0 {
+		var err error
+		if filepaths, err = file.SearchDir(*dataDir, bdata.IsBinDataFile); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, filepath := range filepaths {
+		result, err := bdata.MigrateFile(filepath, *dryRun, !*noBackup)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d lines, %d rewritten\n", filepath, result.Lines, result.Rewritten)
+		for _, line := range result.Failed {
+			fmt.Printf("%s:%d: 无法解析, 已原样保留\n", filepath, line)
+		}
+		failed += len(result.Failed)
+	}
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d 行无法解析", failed))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//统计数据目录中的记录
+func stat(args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	top := fs.Int("n", 10, "-n 10, 每个分组显示的条数")
+	fs.Parse(args)
+
+	var (
+		dataset *bdata.Dataset
+		err     error
+	)
+	if dataset, err = bdata.LoadDataset(*dataDir); err != nil {
+		return err
+	}
+
+	approximate := 0
+	for _, values := range dataset.Approximate {
+		approximate += len(values)
+	}
+	bySchema := make(map[string]int)
+	byCountry := make(map[string]int)
+	byCardType := make(map[string]int)
+	for _, d := range dataset.Exact {
+		bySchema[d.Schema]++
+		byCountry[d.Country]++
+		byCardType[d.CardType]++
+	}
+
+	fmt.Printf("files:       %d\n", len(dataset.Files))
+	fmt.Printf("lines:       %d\n", dataset.Lines)
+	fmt.Printf("wal entries: %d\n", dataset.WalEntries)
+	fmt.Printf("exact:       %d\n", len(dataset.Exact))
+	fmt.Printf("approximate: %d (%d bins)\n", approximate, len(dataset.Approximate))
+	printGroup("scheme", bySchema, *top)
+	printGroup("country", byCountry, *top)
+	printGroup("type", byCardType, *top)
+	return nil
+}
+
+func printGroup(name string, group map[string]int, top int) {
+	keys := make([]string, 0, len(group))
+	for k := range group {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if group[keys[i]] == group[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return group[keys[i]] > group[keys[j]]
+	})
+	fmt.Printf("\n%s:\n", name)
+	for i, k := range keys {
+		if top > 0 && i >= top {
+			fmt.Printf("  ... %d more\n", len(keys)-top)
+			break
+		}
+		if k == "" {
+			fmt.Printf("  %-24s %d\n", "(empty)", group[k])
+		} else {
+			fmt.Printf("  %-24s %d\n", k, group[k])
+		}
+	}
+}
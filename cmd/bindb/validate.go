@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	"kidshelloworld.com/bindb/bdata"
+)
+
+//校验数据文件: header, 列数, 数字字段, 区间, 重叠, id重复, 取值范围及国家代码
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	dataDir := fs.String("d", ".", "-d /home/testuser/bindata")
+	jsonOutput := fs.Bool("json", false, "-json, 以json格式输出")
+	warningAsError := fs.Bool("W", false, "-W, warning也视为校验失败")
+	bankNameRequired := fs.Bool("bank", false, "-bank, 检查bank_name为空")
+	fs.Parse(args)
+
+	targets := fs.Args()
+	if len(targets) == 0 {
+		targets = []string{*dataDir}
+	}
+
+	var diagnostics []bdata.Diagnostic
+	for _, target := range targets {
+		result, err := bdata.ValidateDir(target, *bankNameRequired)
+		if err != nil {
+			return err
+		}
+		diagnostics = append(diagnostics, result...)
+	}
+
+	errorCount := 0
+	for _, d := range diagnostics {
+		if d.Level == bdata.DiagnosticLevelError {
+			errorCount++
+		}
+	}
+	if *jsonOutput {
+		data, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d.String())
+		}
+	}
+
+	if errorCount > 0 || (*warningAsError && len(diagnostics) > 0) {
+		return errors.New(fmt.Sprintf("发现 %d 个问题, 其中 %d 个error", len(diagnostics), errorCount))
+	}
+	return nil
+}
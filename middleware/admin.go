@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//Admin 管理接口鉴权, 配置了adminKey时校验X-Admin-Key, 否则只允许本机访问
+func Admin(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey != "" {
+			if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Key")), []byte(adminKey)) == 1 {
+				c.Next()
+				return
+			}
+		} else if ip := net.ParseIP(RemoteIP(c)); ip != nil && ip.IsLoopback() {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, mod.ResponseValue{Code: mod.ResponseCodeForbidden, Msg: "无权访问"})
+	}
+}
+
+//RemoteIP 连接的对端ip, 不使用X-Forwarded-For, X-Real-Ip等可以伪造的header
+func RemoteIP(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return strings.TrimSpace(c.Request.RemoteAddr)
+	}
+	return host
+}
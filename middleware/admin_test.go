@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAdminRouter(adminKey string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin", Admin(adminKey), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r
+}
+
+func TestAdmin(t *testing.T) {
+	cases := []struct {
+		name       string
+		adminKey   string
+		remoteAddr string
+		headers    map[string]string
+		status     int
+	}{
+		{"loopback without key", "", "127.0.0.1:5000", nil, http.StatusOK},
+		{"ipv6 loopback without key", "", "[::1]:5000", nil, http.StatusOK},
+		{"remote without key", "", "10.0.0.2:5000", nil, http.StatusForbidden},
+		{"forged x-forwarded-for", "", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "127.0.0.1"}, http.StatusForbidden},
+		{"forged x-real-ip", "", "10.0.0.2:5000", map[string]string{"X-Real-Ip": "127.0.0.1"}, http.StatusForbidden},
+		{"valid key", "secret", "10.0.0.2:5000", map[string]string{"X-Admin-Key": "secret"}, http.StatusOK},
+		{"invalid key", "secret", "10.0.0.2:5000", map[string]string{"X-Admin-Key": "wrong"}, http.StatusForbidden},
+		{"loopback with key configured", "secret", "127.0.0.1:5000", nil, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		r := newAdminRouter(c.adminKey)
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.RemoteAddr = c.remoteAddr
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, w.Code, c.status)
+		}
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"127.0.0.1:5000", "127.0.0.1"},
+		{"[::1]:5000", "::1"},
+		{"10.0.0.2", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx.Request.RemoteAddr = c.remoteAddr
+		ctx.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+		if got := RemoteIP(ctx); got != c.want {
+			t.Errorf("RemoteIP(%q) = %q, want %q", c.remoteAddr, got, c.want)
+		}
+	}
+}
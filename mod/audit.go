@@ -0,0 +1,27 @@
+package mod
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//Actor 数据修改的发起方
+type Actor struct {
+	//api key的指纹, 不记录key本身
+	ApiKey   string `json:"api_key,omitempty"`
+	ClientIp string `json:"client_ip"`
+	Endpoint string `json:"endpoint"`
+}
+
+//AuditEntry 一次数据修改的审计记录, Hash = sha256(PrevHash + 去掉Hash后的json)
+type AuditEntry struct {
+	Seq      int64           `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Actor    Actor           `json:"actor"`
+	Action   string          `json:"action"`
+	Key      string          `json:"key"`
+	Before   json.RawMessage `json:"before"`
+	After    json.RawMessage `json:"after"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
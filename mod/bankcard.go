@@ -1,5 +1,7 @@
 package mod
 
+import "time"
+
 type BinData struct {
 	Id           int64     `json:"id"`
 	IinStart     uint32    `json:"iin_start"`
@@ -9,6 +11,27 @@ type BinData struct {
 	Prepaid      string    `json:"prepaid"`
 	Status       BinStatus `json:"status"`
 	BaseBinData
+	//数据来源, 只在内存中保存, 不对外输出
+	Provenance *Provenance `json:"-"`
+}
+
+//Provenance 数据的来源
+type Provenance struct {
+	//来源文件及行号, 行号为0表示尚未写入数据文件(在write-ahead log中)
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	//来源类型: base, import, feedback, approximate
+	SourceKind string `json:"source_kind"`
+	//导入批次, 如import_20190601120000
+	Batch string `json:"batch,omitempty"`
+	//feedback的提交方
+	Submitter *Actor `json:"submitter,omitempty"`
+	//来源数据行的区间
+	IinStart  uint32    `json:"iin_start"`
+	IinEnd    uint32    `json:"iin_end"`
+	ValidFrom time.Time `json:"valid_from"`
+	//在source_priority中的位置, 越小越优先
+	Priority int `json:"priority"`
 }
 
 type BaseBinData struct {
@@ -25,8 +48,24 @@ type BaseBinData struct {
 
 type SimpleBinData struct {
 	BaseBinData
+	//发卡行注册表中的id
+	IssuerId   string `json:"issuer_id,omitempty"`
 	BankNameCn string `json:"bank_name_cn"` //银行, 中文名称
 	CountryCn  string `json:"country_cn"`   //国家, 中文名称
+	//本地化名称所用的语言, 及bank_name, country的本地化名称
+	Locale    string            `json:"locale,omitempty"`
+	Localized map[string]string `json:"localized,omitempty"`
+	//country对应的ISO 3166信息
+	CountryInfo *Country `json:"country_info,omitempty"`
+	//可能的账单货币
+	Currency *Currency `json:"currency,omitempty"`
+	//未找到数据, 按卡组织规则推断的结果
+	Inferred bool `json:"inferred,omitempty"`
+	//卡号长度, 数据中未指定时为0
+	NumberLength int8 `json:"number_length,omitempty"`
+	//合法的卡号长度及是否使用Luhn校验(y/n), 数据中未指定时由卡组织规则决定
+	NumberLengths []int  `json:"number_lengths,omitempty"`
+	NumberLuhn    string `json:"number_luhn,omitempty"`
 }
 
 type BinStatus uint8
@@ -37,3 +76,19 @@ const (
 	//确切
 	BinStatusTruly = 2
 )
+
+//BinVersion bin数据的一个版本
+type BinVersion struct {
+	Bin uint32 `json:"bin"`
+	//该bin的版本按加载顺序的序号, 从1开始
+	Seq int64 `json:"seq"`
+	//生效时间, 零值表示基础数据, 一直有效
+	ValidFrom time.Time `json:"valid_from"`
+	//来源文件
+	Source string `json:"source"`
+	//来源数据行的区间
+	RangeStart  uint32  `json:"range_start"`
+	RangeEnd    uint32  `json:"range_end"`
+	Approximate bool    `json:"approximate"`
+	Data        BinData `json:"data"`
+}
@@ -0,0 +1,9 @@
+package mod
+
+//BankNameMatch 模糊匹配到的银行名称
+type BankNameMatch struct {
+	Name     string `json:"name"`
+	IssuerId string `json:"issuer_id,omitempty"`
+	//相似度, 0到1, 1表示规范化后相同
+	Score float64 `json:"score"`
+}
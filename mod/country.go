@@ -0,0 +1,16 @@
+package mod
+
+//ISO 3166国家信息
+type Country struct {
+	Alpha2  string `json:"alpha2"`
+	Alpha3  string `json:"alpha3"`
+	Numeric string `json:"numeric"`
+	Name    string `json:"name"`
+	Region  string `json:"region"`
+	//欧盟成员国
+	EU bool `json:"eu"`
+	//欧洲经济区成员国
+	EEA bool `json:"eea"`
+	//受制裁的国家
+	Sanctioned bool `json:"sanctioned"`
+}
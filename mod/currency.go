@@ -0,0 +1,10 @@
+package mod
+
+//ISO 4217货币信息
+type Currency struct {
+	Code    string `json:"code"`
+	Numeric string `json:"numeric"`
+	//小数位数
+	MinorUnits int    `json:"minor_units"`
+	Name       string `json:"name"`
+}
@@ -0,0 +1,24 @@
+package mod
+
+//Issuer 发卡行, Name为规范名称, Aliases为数据中出现的其他写法
+type Issuer struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Logo    string   `json:"logo"`
+	Url     string   `json:"url"`
+	Phone   string   `json:"phone"`
+	City    string   `json:"city"`
+}
+
+//IssuerRange 发卡行拥有的连续bin区间
+type IssuerRange struct {
+	IinStart uint32 `json:"iin_start"`
+	IinEnd   uint32 `json:"iin_end"`
+}
+
+//IssuerDetail 发卡行及其拥有的bin区间
+type IssuerDetail struct {
+	Issuer
+	Ranges []IssuerRange `json:"ranges"`
+}
@@ -0,0 +1,37 @@
+package mod
+
+import "time"
+
+//OverlapRecord 发生重叠的一条数据
+type OverlapRecord struct {
+	Id       int64  `json:"id"`
+	IinStart uint32 `json:"iin_start"`
+	IinEnd   uint32 `json:"iin_end"`
+	//来源文件, 行号, 来源类型及导入批次
+	Source     string    `json:"source"`
+	Line       int       `json:"line"`
+	SourceKind string    `json:"source_kind"`
+	Batch      string    `json:"batch,omitempty"`
+	ValidFrom  time.Time `json:"valid_from"`
+}
+
+//OverlapConflict 两条数据的区间重叠, 按策略保留了Winner
+type OverlapConflict struct {
+	Winner OverlapRecord `json:"winner"`
+	Loser  OverlapRecord `json:"loser"`
+	Policy string        `json:"policy"`
+	//重叠的bin的范围及数量
+	BinStart   uint32    `json:"bin_start"`
+	BinEnd     uint32    `json:"bin_end"`
+	Bins       int       `json:"bins"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+//OverlapReport 重叠报告
+type OverlapReport struct {
+	Policy         string            `json:"policy"`
+	SourcePriority []string          `json:"source_priority"`
+	Conflicts      []OverlapConflict `json:"conflicts"`
+	//超过上限未记录的冲突数
+	Dropped int `json:"dropped"`
+}
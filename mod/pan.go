@@ -0,0 +1,42 @@
+package mod
+
+//PanRequest 卡号通过request body传入, 避免出现在访问日志中
+type PanRequest struct {
+	Pan string `json:"pan"`
+}
+
+//PanFormat 卡号的显示格式
+type PanFormat struct {
+	Bin    string `json:"bin"`
+	Schema string `json:"schema"`
+	//卡组织是否由规则推断
+	Inferred bool `json:"inferred,omitempty"`
+	//按卡组织分组的卡号, 如4111 1111 1111 1111
+	Formatted string `json:"formatted"`
+	//保留前6位及后4位, 如411111******1111, 及分组后的形式
+	Masked          string `json:"masked"`
+	MaskedFormatted string `json:"masked_formatted"`
+	Last4           string `json:"last4"`
+	Luhn            bool   `json:"luhn"`
+}
+
+//PanValidation 完整卡号的校验结果
+type PanValidation struct {
+	Bin      string `json:"bin"`
+	Schema   string `json:"schema"`
+	Inferred bool   `json:"inferred,omitempty"`
+	Length   int    `json:"length"`
+	//长度是否为bin数据或卡组织规则允许的长度
+	LengthValid  bool `json:"length_valid"`
+	LuhnRequired bool `json:"luhn_required"`
+	LuhnValid    bool `json:"luhn_valid"`
+	Valid        bool `json:"valid"`
+	//不合法的原因
+	Reason string `json:"reason,omitempty"`
+}
+
+//PanToken 卡号的token
+type PanToken struct {
+	Masked string `json:"masked"`
+	Token  string `json:"token"`
+}
@@ -21,4 +21,6 @@ const (
 	ResponseCodeInvalidParams = 1004
 	//数据不存在
 	ResponseCodeNotFound = 1010
+	//无权访问
+	ResponseCodeForbidden = 1020
 )
@@ -0,0 +1,12 @@
+package mod
+
+//SchemeRule 按卡号前缀推断卡组织的规则, 卡号前len(PrefixStart)位在[PrefixStart, PrefixEnd]之间时匹配
+type SchemeRule struct {
+	Schema      string `json:"schema"`
+	PrefixStart string `json:"prefix_start"`
+	PrefixEnd   string `json:"prefix_end"`
+	//合法的卡号长度
+	Lengths []int `json:"lengths"`
+	//是否使用Luhn校验
+	Luhn bool `json:"luhn"`
+}
@@ -0,0 +1,112 @@
+package pan
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	//卡号最短12位, 最长19位
+	minLength = 12
+	maxLength = 19
+	//按卡组织及卡号长度的显示分组, 未配置的按每4位一组
+	groupings = map[string]map[int][]int{
+		"amex":   {15: {4, 6, 5}},
+		"diners": {14: {4, 6, 4}},
+		"uatp":   {15: {4, 5, 6}},
+	}
+	ErrInvalidPan = errors.New("非法的卡号")
+)
+
+//Normalize 去掉卡号中的空格及-, 校验只包含数字且长度合法
+func Normalize(value string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, value)
+	if len(number) < minLength || len(number) > maxLength {
+		return "", ErrInvalidPan
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidPan
+		}
+	}
+	return number, nil
+}
+
+//Luhn 卡号是否通过Luhn校验
+func Luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return len(number) > 0 && sum%10 == 0
+}
+
+//Grouping 卡号的显示分组, 如visa 16位为4-4-4-4, amex为4-6-5
+func Grouping(schema string, length int) []int {
+	if g, ok := groupings[strings.ToLower(schema)][length]; ok {
+		return g
+	}
+	var g []int
+	for n := length; n > 0; n -= 4 {
+		if n < 4 {
+			g = append(g, n)
+		} else {
+			g = append(g, 4)
+		}
+	}
+	return g
+}
+
+//Format 按卡组织的显示分组以空格分隔, 也可用于Mask后的卡号
+func Format(number, schema string) string {
+	var (
+		b     strings.Builder
+		start int
+	)
+	for _, n := range Grouping(schema, len(number)) {
+		if start > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(number[start : start+n])
+		start += n
+	}
+	return b.String()
+}
+
+//Mask 保留前6位及后4位, 其余替换为*, 15位以下的卡号只保留后4位
+func Mask(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	first := 6
+	if len(number) < 15 {
+		first = 0
+	}
+	return number[:first] + strings.Repeat("*", len(number)-first-4) + number[len(number)-4:]
+}
+
+//Token 卡号的HMAC-SHA256, 相同key及卡号得到相同的token, 可用于日志及关联查询而不保存卡号
+func Token(key []byte, number string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(number))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package pan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{"4111111111111111", "4111111111111111", false},
+		{"4111 1111 1111 1111", "4111111111111111", false},
+		{"4111-1111-1111-1111", "4111111111111111", false},
+		{"411111111111", "411111111111", false},
+		{"41111111111", "", true},
+		{"41111111111111111111", "", true},
+		{"4111a11111111111", "", true},
+		{"", "", true},
+	}
+	for _, c := range cases {
+		got, err := Normalize(c.value)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", c.value, got, err, c.want)
+		}
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	cases := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"79927398713", true},
+		{"79927398710", false},
+		{"0", true},
+		{"", false},
+		{"4a11", false},
+	}
+	for _, c := range cases {
+		if got := Luhn(c.number); got != c.want {
+			t.Errorf("Luhn(%q) = %v, want %v", c.number, got, c.want)
+		}
+	}
+}
+
+func TestGrouping(t *testing.T) {
+	cases := []struct {
+		schema string
+		length int
+		want   []int
+	}{
+		{"visa", 16, []int{4, 4, 4, 4}},
+		{"visa", 13, []int{4, 4, 4, 1}},
+		{"unionpay", 19, []int{4, 4, 4, 4, 3}},
+		{"amex", 15, []int{4, 6, 5}},
+		{"AMEX", 15, []int{4, 6, 5}},
+		{"diners", 14, []int{4, 6, 4}},
+		{"diners", 16, []int{4, 4, 4, 4}},
+		{"uatp", 15, []int{4, 5, 6}},
+		{"", 0, nil},
+	}
+	for _, c := range cases {
+		if got := Grouping(c.schema, c.length); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Grouping(%q, %d) = %v, want %v", c.schema, c.length, got, c.want)
+		}
+	}
+}
+
+func TestFormatMask(t *testing.T) {
+	cases := []struct {
+		number string
+		schema string
+		format string
+		mask   string
+	}{
+		{"4111111111111111", "visa", "4111 1111 1111 1111", "4111 11** **** 1111"},
+		{"378282246310005", "amex", "3782 822463 10005", "3782 82**** *0005"},
+		{"30569309025904", "diners", "3056 930902 5904", "**** ****** 5904"},
+		{"6212345678901234567", "unionpay", "6212 3456 7890 1234 567", "6212 34** **** ***4 567"},
+		{"4111", "visa", "4111", "****"},
+	}
+	for _, c := range cases {
+		if got := Format(c.number, c.schema); got != c.format {
+			t.Errorf("Format(%q, %q) = %q, want %q", c.number, c.schema, got, c.format)
+		}
+		if got := Format(Mask(c.number), c.schema); got != c.mask {
+			t.Errorf("Format(Mask(%q)) = %q, want %q", c.number, got, c.mask)
+		}
+	}
+	//15位以下的卡号只保留后4位
+	if got := Mask("30569309025904"); got != "**********5904" {
+		t.Errorf("Mask 14 digits = %q", got)
+	}
+}
+
+func TestToken(t *testing.T) {
+	//RFC 4231 test case 2
+	if got := Token([]byte("Jefe"), "what do ya want for nothing?"); got != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("Token = %s", got)
+	}
+	a, b := Token([]byte("key"), "4111111111111111"), Token([]byte("other"), "4111111111111111")
+	if a == b || a != Token([]byte("key"), "4111111111111111") {
+		t.Error("token not keyed or not deterministic")
+	}
+}
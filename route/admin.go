@@ -0,0 +1,114 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//查询审计日志, 可按action, key, actor(api key指纹或ip), from, to过滤
+func auditQuery(ctx *gin.Context) {
+	q := bdata.AuditQuery{Action: ctx.Query("action"), Key: ctx.Query("key"), Actor: ctx.Query("actor"), Limit: 100}
+	var err error
+	if limit := ctx.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+			return
+		}
+	}
+	if q.From, err = parseOptionalTime(ctx.Query("from")); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+		return
+	}
+	if q.To, err = parseOptionalTime(ctx.Query("to")); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+		return
+	}
+
+	var entries []mod.AuditEntry
+	if entries, err = bdata.QueryAudit(q); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: entries})
+}
+
+//校验审计日志的hash链
+func auditVerify(ctx *gin.Context) {
+	result, err := bdata.VerifyCurrentAuditLog()
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: result})
+}
+
+//加载及写入时发现的确切数据区间重叠, 及按策略保留的数据
+func overlapReport(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: bdata.Overlaps()})
+}
+
+//bin的数据及来源: 文件, 行号, 导入批次, 提交方, 以及涉及该bin的重叠
+func provenanceQuery(ctx *gin.Context) {
+	result, err := bdata.LookupProvenance(ctx.Param("bin"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: result})
+}
+
+//缓存的命中统计
+func cacheStats(ctx *gin.Context) {
+	stats, err := bdata.CurrentCacheStats()
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: stats})
+}
+
+//清空缓存
+func cachePurge(ctx *gin.Context) {
+	if err := bdata.PurgeCache(); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
+}
+
+//应用其他节点推送的复制记录, 失败时同样返回已应用的进度
+func replicationApply(ctx *gin.Context) {
+	var batch bdata.ReplicationBatch
+	if err := ctx.BindJSON(&batch); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return
+	}
+	ack, err := bdata.ApplyReplication(batch)
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()}, Data: ack})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: ack})
+}
+
+//本节点的复制状态
+func replicationStatus(ctx *gin.Context) {
+	status, err := bdata.CurrentReplicationStatus()
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: status})
+}
+
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return bdata.ParseQueryTime(value)
+}
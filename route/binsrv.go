@@ -4,7 +4,9 @@ import (
 	"kidshelloworld.com/bindb/bdata"
 	"kidshelloworld.com/bindb/mod"
 	"github.com/gin-gonic/gin"
+	logger "github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
 func binQuery(ctx *gin.Context) {
@@ -12,9 +14,76 @@ func binQuery(ctx *gin.Context) {
 		binData *mod.SimpleBinData
 		err     error
 	)
-	if binData, err = bdata.Query(ctx.Param("bin")); err != nil {
+	if date := ctx.Query("date"); date != "" {
+		//查询指定日期生效的数据
+		var at time.Time
+		if at, err = bdata.ParseQueryTime(date); err != nil {
+			ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+			return
+		}
+		binData, err = bdata.QueryAt(ctx.Param("bin"), at)
+	} else {
+		binData, err = bdata.Query(ctx.Param("bin"))
+	}
+	if err != nil {
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeNotFound, Msg: "数据不存在"})
 		return
 	}
+	//lang参数或Accept-Language指定时返回本地化名称
+	bdata.Localize(binData, bdata.LocaleChain(ctx.Query("lang"), ctx.GetHeader("Accept-Language")))
 	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功 "}, Data: binData})
 }
+
+//按alpha-2, alpha-3, numeric或英文名称查询国家信息
+func countryQuery(ctx *gin.Context) {
+	country, ok := bdata.LookupCountry(ctx.Param("code"))
+	if !ok {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeNotFound, Msg: "数据不存在"})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: country})
+}
+
+//已加载映射文件的语言
+func locales(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: bdata.Locales()})
+}
+
+//bin的历史版本
+func binHistory(ctx *gin.Context) {
+	var (
+		versions []mod.BinVersion
+		err      error
+	)
+	if versions, err = bdata.History(ctx.Param("bin")); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeNotFound, Msg: "数据不存在"})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: versions})
+}
+
+//发卡行注册表及各发卡行拥有的bin区间
+func issuerList(ctx *gin.Context) {
+	list, err := bdata.Issuers()
+	if err != nil {
+		logger.Error(err)
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: list})
+}
+
+//按id, 名称或别名查询发卡行
+func issuerQuery(ctx *gin.Context) {
+	detail, err := bdata.IssuerDetailOf(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeNotFound, Msg: "数据不存在"})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: detail})
+}
+
+//当前使用的卡组织规则
+func schemeRuleList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: bdata.SchemeRules()})
+}
@@ -0,0 +1,30 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/sirupsen/logrus"
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//导出当前生效的数据, format: csv, jsonl, ranges, 可按country, scheme过滤(逗号分隔)
+func export(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", bdata.ExportFormatCSV)
+	contentType, ext, err := bdata.ExportContentType(format)
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
+		return
+	}
+	filter := bdata.ParseExportFilter(ctx.Query("country"), ctx.Query("scheme"))
+
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=bindb_%s_%s.%s", format, time.Now().Format(bdata.DatePatternCompact), ext))
+	ctx.Status(http.StatusOK)
+	if err = bdata.ExportCurrent(ctx.Writer, format, filter); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//服务关闭时通知事件流结束
+var shutdown = make(chan struct{})
+
+//Shutdown 结束所有事件流, 需注册到http.Server.RegisterOnShutdown, 否则服务关闭时会等待事件流超时
+func Shutdown() {
+	close(shutdown)
+}
+
+//数据变化的事件流(Server-Sent Events), 通过Last-Event-ID请求头或since参数从该序号之后继续, 默认只推送新事件
+//每个事件的id为seq, event为type, data为bdata.ChangeEvent的json
+//收到reset事件时, 请求的序号之后的事件已不再保留, 客户端需全量同步数据, 之后从reset事件的id继续
+//连接在服务的WriteTimeout之前主动结束, 客户端按retry的间隔重连并通过Last-Event-ID继续
+func changes(ctx *gin.Context) {
+	since := bdata.LatestChangeSeq()
+	value := ctx.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = ctx.Query("since")
+	}
+	if value != "" {
+		var err error
+		if since, err = strconv.ParseInt(value, 10, 64); err != nil || since < 0 {
+			ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+			return
+		}
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	if _, err := fmt.Fprint(ctx.Writer, "retry: 1000\n\n"); err != nil {
+		return
+	}
+	ctx.Writer.Flush()
+
+	var deadline <-chan time.Time
+	if streamTimeout > 0 {
+		timer := time.NewTimer(streamTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		events, changed := bdata.ChangesSince(since, 100)
+		for _, e := range events {
+			data, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(ctx.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data); err != nil {
+				return
+			}
+			since = e.Seq
+		}
+		if len(events) > 0 {
+			ctx.Writer.Flush()
+			continue
+		}
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-shutdown:
+			return
+		case <-deadline:
+			return
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+//注册webhook, 参数url, secret(为空时生成并只返回一次), types(逗号分隔)
+func webhookAdd(ctx *gin.Context) {
+	var params struct {
+		Url    string `json:"url"`
+		Secret string `json:"secret"`
+		Types  string `json:"types"`
+	}
+	if err := ctx.BindJSON(&params); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return
+	}
+	var types []string
+	for _, t := range strings.Split(params.Types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	hook, err := bdata.AddWebhook(params.Url, params.Secret, types)
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: hook})
+}
+
+//已注册的webhook及投递状态
+func webhookList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: bdata.ListWebhooks()})
+}
+
+//删除webhook
+func webhookRemove(ctx *gin.Context) {
+	if err := bdata.RemoveWebhook(ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
+}
@@ -0,0 +1,82 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+)
+
+//事件流中的id
+func eventIds(body string) []int64 {
+	var ids []int64
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			id, _ := strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestChanges(t *testing.T) {
+	savedConfig, savedTimeout := bdata.Config, streamTimeout
+	t.Cleanup(func() { bdata.Config, streamTimeout = savedConfig, savedTimeout })
+	bdata.Config.DataDir = t.TempDir()
+	streamTimeout = 100 * time.Millisecond
+
+	base := bdata.LatestChangeSeq()
+	for _, key := range []string{"SSE BANK A", "SSE BANK B", "SSE BANK C"} {
+		if err := bdata.CreateBankNameMapping(mod.Actor{}, key, "测试银行"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/changes", changes)
+	cases := []struct {
+		name  string
+		query string
+		last  string
+		ids   []int64
+		code  int
+	}{
+		{"only new events", "", "", nil, 0},
+		{"last event id", "", strconv.FormatInt(base+1, 10), []int64{base + 2, base + 3}, 0},
+		{"since", "?since=" + strconv.FormatInt(base, 10), "", []int64{base + 1, base + 2, base + 3}, 0},
+		{"last event id before since", "?since=" + strconv.FormatInt(base, 10), strconv.FormatInt(base+2, 10), []int64{base + 3}, 0},
+		{"up to date", "", strconv.FormatInt(base+3, 10), nil, 0},
+		{"invalid since", "?since=abc", "", nil, mod.ResponseCodeInvalidParams},
+		{"negative last event id", "", "-1", nil, mod.ResponseCodeInvalidParams},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/changes"+c.query, nil)
+		if c.last != "" {
+			req.Header.Set("Last-Event-ID", c.last)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if c.code != 0 {
+			var resp mod.ResponseValue
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != c.code {
+				t.Errorf("%s: response %s", c.name, w.Body.String())
+			}
+			continue
+		}
+		if w.Header().Get("Content-Type") != "text/event-stream" || !strings.HasPrefix(w.Body.String(), "retry: 1000\n\n") {
+			t.Errorf("%s: not an event stream: %v %q", c.name, w.Header(), w.Body.String())
+		}
+		if ids := eventIds(w.Body.String()); !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: ids %v, want %v", c.name, ids, c.ids)
+		}
+	}
+}
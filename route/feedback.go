@@ -1,11 +1,14 @@
 package route
 
 import (
+	"errors"
 	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/middleware"
 	"kidshelloworld.com/bindb/mod"
 	"github.com/gin-gonic/gin"
 	logger "github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 )
 
 //bindata feeback approximate, not sure
@@ -14,18 +17,20 @@ func feedback(ctx *gin.Context) {
 	if err := ctx.BindJSON(&bindata); err != nil {
 		logger.Error(err)
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return
 	}
 	//判断入参是否合法
-	if !verifyBinData(bindata) {
-		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+	if err := verifyBinData(&bindata); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
 		return
 	}
-	if err := bdata.CreateBinData(ctx.Param("bin"), bindata, true); err != nil {
+	suggestions := matchBankName(&bindata)
+	if err := bdata.CreateBinData(newActor(ctx), ctx.Param("bin"), bindata, true); err != nil {
 		logger.Error(err)
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
+	feedbackSucceeded(ctx, suggestions)
 }
 
 //bindata feeback, sure
@@ -34,30 +39,103 @@ func feedback_t(ctx *gin.Context) {
 	if err := ctx.BindJSON(&bindata); err != nil {
 		logger.Error(err)
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return
 	}
 	//判断入参是否合法
-	if !verifyBinData(bindata) {
-		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+	if err := verifyBinData(&bindata); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
 		return
 	}
-	if err := bdata.CreateBinData(ctx.Param("bin"), bindata, false); err != nil {
+	suggestions := matchBankName(&bindata)
+	if err := bdata.CreateBinData(newActor(ctx), ctx.Param("bin"), bindata, false); err != nil {
 		logger.Error(err)
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
+	feedbackSucceeded(ctx, suggestions)
+}
+
+//管理接口替换bin已有的确切数据, 按重叠策略已有数据优先时返回失败
+func binReplace(ctx *gin.Context) {
+	var bindata mod.BinData
+	if err := ctx.BindJSON(&bindata); err != nil {
+		logger.Error(err)
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return
+	}
+	if err := verifyBinData(&bindata); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
+		return
+	}
+	suggestions := matchBankName(&bindata)
+	if err := bdata.ReplaceBinData(newActor(ctx), ctx.Param("bin"), bindata); err != nil {
+		logger.Error(err)
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
+		return
+	}
+	feedbackSucceeded(ctx, suggestions)
 }
 
-func verifyBinData(binData mod.BinData) bool {
+//校验feedback, country统一为ISO 3166-1 alpha-2, 未知的国家代码视为非法参数, 银行名称统一为发卡行注册表中的规范名称
+func verifyBinData(binData *mod.BinData) error {
 	if binData.BankName == "" || binData.CardType == "" {
-		return false
+		return errors.New("非法参数")
+	}
+	country, err := bdata.NormalizeCountry(binData.Country)
+	if err != nil {
+		return err
+	}
+	binData.Country = country
+	if err = bdata.NormalizeNumberFields(binData); err != nil {
+		return err
+	}
+	bdata.NormalizeIssuer(&binData.BaseBinData)
+	return nil
+}
+
+//银行名称与现有名称规范化后相同时使用现有名称, 否则返回相似的现有名称作为建议
+func matchBankName(binData *mod.BinData) []mod.BankNameMatch {
+	name, suggestions := bdata.MatchBankName(binData.BankName, 5)
+	if name != "" {
+		binData.BankName = name
+	}
+	return suggestions
+}
+
+//有建议的银行名称时在Data中返回
+func feedbackSucceeded(ctx *gin.Context, suggestions []mod.BankNameMatch) {
+	if len(suggestions) == 0 {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
+		return
 	}
-	return true
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: suggestions})
+}
+
+//容错的银行名称搜索, q为名称或名称的一部分
+func bankSearch(ctx *gin.Context) {
+	limit := 10
+	if value := ctx.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+			return
+		}
+	}
+	q := ctx.Query("q")
+	if q == "" {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: "非法参数"})
+		return
+	}
+	matches := bdata.SearchBankName(q, limit)
+	if matches == nil {
+		matches = []mod.BankNameMatch{}
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: matches})
 }
 
 //新增银行中文名称对应关系
 func addBankNameCn(ctx *gin.Context) {
-	if err := bdata.CreateBankNameMapping(ctx.Param("key"), ctx.Param("name")); err != nil {
+	if err := bdata.CreateBankNameMapping(newActor(ctx), ctx.Param("key"), ctx.Param("name")); err != nil {
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
 		return
 	}
@@ -66,9 +144,17 @@ func addBankNameCn(ctx *gin.Context) {
 
 //新增国家中文名称对应关系
 func addCountryCn(ctx *gin.Context) {
-	if err := bdata.CreateCountryCnNameMapping(ctx.Param("key"), ctx.Param("name")); err != nil {
+	if err := bdata.CreateCountryCnNameMapping(newActor(ctx), ctx.Param("key"), ctx.Param("name")); err != nil {
 		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"})
 }
+
+//修改数据的发起方, 记录到审计日志
+func newActor(ctx *gin.Context) mod.Actor {
+	return mod.Actor{
+		ApiKey:   bdata.ApiKeyFingerprint(ctx.GetHeader("X-Api-Key")),
+		ClientIp: middleware.RemoteIP(ctx),
+		Endpoint: ctx.Request.Method + " " + ctx.Request.URL.Path}
+}
@@ -0,0 +1,33 @@
+package route
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/mod"
+)
+
+func TestFeedbackInvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/bin/feedback/:bin", feedback)
+	r.POST("/bin_t/feedback/:bin", feedback_t)
+	for _, path := range []string{"/bin/feedback/400000", "/bin_t/feedback/400000"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{")))
+		//解析失败后只返回一次结果
+		decoder := json.NewDecoder(w.Body)
+		var value mod.ResponseValue
+		if err := decoder.Decode(&value); err != nil || value.Code != mod.ResponseCodeFailure || value.Msg != "无法解析request body" {
+			t.Errorf("%s: %+v %v", path, value, err)
+		}
+		if err := decoder.Decode(&value); err != io.EOF {
+			t.Errorf("%s: more than one response, %+v %v", path, value, err)
+		}
+	}
+}
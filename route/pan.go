@@ -0,0 +1,71 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/mod"
+	"kidshelloworld.com/bindb/pan"
+)
+
+//生成token的key, 为空时不提供token接口
+var panTokenKey []byte
+
+//读取并校验request body中的卡号
+func bindPan(ctx *gin.Context) (string, bool) {
+	var req mod.PanRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "无法解析request body"})
+		return "", false
+	}
+	number, err := pan.Normalize(req.Pan)
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
+		return "", false
+	}
+	return number, true
+}
+
+//按bin查询到的卡组织格式化卡号
+func panFormat(ctx *gin.Context) {
+	number, ok := bindPan(ctx)
+	if !ok {
+		return
+	}
+	result := mod.PanFormat{Bin: number[:6], Last4: number[len(number)-4:], Luhn: pan.Luhn(number)}
+	if data, bin, err := bdata.QueryPan(number); err == nil {
+		result.Bin, result.Schema, result.Inferred = bin, data.Schema, data.Inferred
+	}
+	result.Formatted = pan.Format(number, result.Schema)
+	result.Masked = pan.Mask(number)
+	result.MaskedFormatted = pan.Format(result.Masked, result.Schema)
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: result})
+}
+
+//卡号的keyed hash token
+func panToken(ctx *gin.Context) {
+	if len(panTokenKey) == 0 {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeFailure, Msg: "未配置token key"})
+		return
+	}
+	number, ok := bindPan(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: mod.PanToken{Masked: pan.Mask(number), Token: pan.Token(panTokenKey, number)}})
+}
+
+//按bin数据或卡组织规则校验卡号的长度及Luhn
+func panValidate(ctx *gin.Context) {
+	number, ok := bindPan(ctx)
+	if !ok {
+		return
+	}
+	result, err := bdata.ValidatePan(number)
+	if err != nil {
+		ctx.JSON(http.StatusOK, mod.ResponseValue{Code: mod.ResponseCodeInvalidParams, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, mod.ResponseData{ResponseValue: mod.ResponseValue{Code: mod.ResponseCodeSuccess, Msg: "成功"}, Data: result})
+}
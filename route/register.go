@@ -2,12 +2,32 @@ package route
 
 import (
 	"kidshelloworld.com/bindb/bdata"
+	"kidshelloworld.com/bindb/middleware"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"time"
 )
 
-func Register(r *gin.Engine) {
+//Options 路由配置
+type Options struct {
+	//管理接口的key, 为空时管理接口只允许本机访问
+	AdminKey string
+	//http服务的WriteTimeout, 事件流在此之前结束, 为0时不限制
+	WriteTimeout time.Duration
+	//生成卡号token的key, 为空时token接口不可用
+	PanTokenKey string
+}
+
+//事件流的最长时间
+var streamTimeout time.Duration
+
+func Register(r *gin.Engine, opts Options) {
+	if opts.WriteTimeout > 0 {
+		if streamTimeout = opts.WriteTimeout - 2*time.Second; streamTimeout < time.Second {
+			streamTimeout = opts.WriteTimeout / 2
+		}
+	}
+	panTokenKey = []byte(opts.PanTokenKey)
 	g := r.Group("/bindb")
 	{
 		g.GET("/index", func(context *gin.Context) {
@@ -17,9 +37,35 @@ func Register(r *gin.Engine) {
 		v1 := g.Group("/v1")
 
 		v1.GET("/bin/query/:bin", binQuery)
+		v1.GET("/bin/history/:bin", binHistory)
 		v1.POST("/bin/feedback/:bin", feedback)
 		v1.POST("/bin_t/feedback/:bin", feedback_t)
 		v1.POST("/bank/feedback/:key/:name", addBankNameCn)
+		v1.GET("/bank/search", bankSearch)
 		v1.POST("/country/feedback/:key/:name", addCountryCn)
+		v1.GET("/export", export)
+		v1.GET("/changes", changes)
+		v1.GET("/locales", locales)
+		v1.GET("/country/:code", countryQuery)
+		v1.GET("/scheme/rules", schemeRuleList)
+		v1.POST("/pan/format", panFormat)
+		v1.POST("/pan/token", panToken)
+		v1.POST("/pan/validate", panValidate)
+		v1.GET("/issuers", issuerList)
+		v1.GET("/issuers/:id", issuerQuery)
+
+		admin := g.Group("/admin", middleware.Admin(opts.AdminKey))
+		admin.GET("/audit", auditQuery)
+		admin.GET("/audit/verify", auditVerify)
+		admin.GET("/overlaps", overlapReport)
+		admin.GET("/provenance/:bin", provenanceQuery)
+		admin.POST("/bin/:bin", binReplace)
+		admin.GET("/cache", cacheStats)
+		admin.POST("/cache/purge", cachePurge)
+		admin.POST("/replication/apply", replicationApply)
+		admin.GET("/replication/status", replicationStatus)
+		admin.GET("/webhooks", webhookList)
+		admin.POST("/webhooks", webhookAdd)
+		admin.DELETE("/webhooks/:id", webhookRemove)
 	}
 }